@@ -15,12 +15,30 @@
 package identity
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"github.com/greenpau/go-identity/pkg/errors"
 	"github.com/greenpau/go-identity/pkg/requests"
 	"golang.org/x/crypto/bcrypt"
+	"net"
+	"strings"
 	"time"
 )
 
+const (
+	// apiKeyAlgorithmBcrypt is the algorithm of the legacy API keys hashed
+	// with bcrypt.
+	apiKeyAlgorithmBcrypt = "bcrypt"
+	// apiKeyAlgorithmHMAC is the algorithm of the API keys stored as
+	// HMAC-SHA256 digests.
+	apiKeyAlgorithmHMAC = "hmac-sha256"
+	// minAPIKeySecretLength is the minimum length, in bytes, of the secret
+	// key of HMAC-SHA256 digests of API keys.
+	minAPIKeySecretLength = 32
+)
+
 // APIKeyBundle is a collection of API keys.
 type APIKeyBundle struct {
 	keys []*APIKey
@@ -29,16 +47,58 @@ type APIKeyBundle struct {
 
 // APIKey is an API key.
 type APIKey struct {
+	ID        string `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	Prefix    string `json:"prefix,omitempty" xml:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Usage     string `json:"usage,omitempty" xml:"usage,omitempty" yaml:"usage,omitempty"`
+	Algorithm string `json:"algorithm,omitempty" xml:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Comment   string `json:"comment,omitempty" xml:"comment,omitempty" yaml:"comment,omitempty"`
+	Payload   string `json:"payload,omitempty" xml:"payload,omitempty" yaml:"payload,omitempty"`
+	// Scopes is the list of permissions granted to the key.
+	Scopes []string `json:"scopes,omitempty" xml:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// Roles is the list of the roles of the key owner granted to the key.
+	// When empty, the key is granted all the roles of the key owner.
+	Roles []string `json:"roles,omitempty" xml:"roles,omitempty" yaml:"roles,omitempty"`
+	// AllowedNetworks is the list of CIDR ranges the key is allowed to be
+	// used from. When empty, the key is allowed from any address.
+	AllowedNetworks []string `json:"allowed_networks,omitempty" xml:"allowed_networks,omitempty" yaml:"allowed_networks,omitempty"`
+	// AllowedMethods is the list of HTTP methods the key is allowed to be
+	// used with. When empty, the key is allowed with any method.
+	AllowedMethods []string  `json:"allowed_methods,omitempty" xml:"allowed_methods,omitempty" yaml:"allowed_methods,omitempty"`
+	Expired        bool      `json:"expired,omitempty" xml:"expired,omitempty" yaml:"expired,omitempty"`
+	ExpiredAt      time.Time `json:"expired_at,omitempty" xml:"expired_at,omitempty" yaml:"expired_at,omitempty"`
+	CreatedAt      time.Time `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
+	Disabled       bool      `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
+	DisabledAt     time.Time `json:"disabled_at,omitempty" xml:"disabled_at,omitempty" yaml:"disabled_at,omitempty"`
+	ModifiedAt     time.Time `json:"modified_at,omitempty" xml:"modified_at,omitempty" yaml:"modified_at,omitempty"`
+	RotatedAt      time.Time `json:"rotated_at,omitempty" xml:"rotated_at,omitempty" yaml:"rotated_at,omitempty"`
+	// LastUsedAt, LastUsedIP, and LastUsedUserAgent describe the last
+	// successful lookup of the key. UseCount is the number of successful
+	// lookups.
+	LastUsedAt        time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty" yaml:"last_used_at,omitempty"`
+	LastUsedIP        string    `json:"last_used_ip,omitempty" xml:"last_used_ip,omitempty" yaml:"last_used_ip,omitempty"`
+	LastUsedUserAgent string    `json:"last_used_user_agent,omitempty" xml:"last_used_user_agent,omitempty" yaml:"last_used_user_agent,omitempty"`
+	UseCount          int       `json:"use_count,omitempty" xml:"use_count,omitempty" yaml:"use_count,omitempty"`
+}
+
+// APIKeyUsage is the usage of an API key recorded since the last database
+// commit.
+type APIKeyUsage struct {
+	LastUsedAt        time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty" yaml:"last_used_at,omitempty"`
+	LastUsedIP        string    `json:"last_used_ip,omitempty" xml:"last_used_ip,omitempty" yaml:"last_used_ip,omitempty"`
+	LastUsedUserAgent string    `json:"last_used_user_agent,omitempty" xml:"last_used_user_agent,omitempty" yaml:"last_used_user_agent,omitempty"`
+	UseCount          int       `json:"use_count,omitempty" xml:"use_count,omitempty" yaml:"use_count,omitempty"`
+}
+
+// APIKeyReportEntry is an entry of API key usage report.
+type APIKeyReportEntry struct {
+	Username   string    `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
+	Email      string    `json:"email,omitempty" xml:"email,omitempty" yaml:"email,omitempty"`
 	ID         string    `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
 	Prefix     string    `json:"prefix,omitempty" xml:"prefix,omitempty" yaml:"prefix,omitempty"`
-	Usage      string    `json:"usage,omitempty" xml:"usage,omitempty" yaml:"usage,omitempty"`
 	Comment    string    `json:"comment,omitempty" xml:"comment,omitempty" yaml:"comment,omitempty"`
-	Payload    string    `json:"payload,omitempty" xml:"payload,omitempty" yaml:"payload,omitempty"`
-	Expired    bool      `json:"expired,omitempty" xml:"expired,omitempty" yaml:"expired,omitempty"`
-	ExpiredAt  time.Time `json:"expired_at,omitempty" xml:"expired_at,omitempty" yaml:"expired_at,omitempty"`
 	CreatedAt  time.Time `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
-	Disabled   bool      `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
-	DisabledAt time.Time `json:"disabled_at,omitempty" xml:"disabled_at,omitempty" yaml:"disabled_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty" yaml:"last_used_at,omitempty"`
+	UseCount   int       `json:"use_count,omitempty" xml:"use_count,omitempty" yaml:"use_count,omitempty"`
 }
 
 // NewAPIKeyBundle returns an instance of APIKeyBundle.
@@ -78,13 +138,55 @@ func NewAPIKey(r *requests.Request) (*APIKey, error) {
 	if r.Key.Comment == "" {
 		return nil, errors.ErrAPIKeyCommentEmpty
 	}
+	scopes, ok := normalizeAPIKeyEntries(r.Key.Scopes)
+	if !ok {
+		return nil, errors.ErrAPIKeyScopeEmpty
+	}
+	roles, ok := normalizeAPIKeyEntries(r.Key.Roles)
+	if !ok {
+		return nil, errors.ErrAPIKeyRoleEmpty
+	}
+	networks, err := normalizeAPIKeyNetworks(r.Key.AllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := normalizeAPIKeyMethods(r.Key.AllowedMethods)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := r.Key.Algorithm
+	switch algorithm {
+	case "":
+		algorithm = apiKeyAlgorithmBcrypt
+	case apiKeyAlgorithmBcrypt, apiKeyAlgorithmHMAC:
+	default:
+		return nil, errors.ErrAPIKeyAlgorithmUnsupported.WithArgs(algorithm)
+	}
 	p := &APIKey{
-		Comment:   r.Key.Comment,
-		ID:        GetRandomString(40),
-		Prefix:    r.Key.Prefix,
-		Payload:   r.Key.Payload,
-		Usage:     r.Key.Usage,
-		CreatedAt: time.Now().UTC(),
+		Algorithm:       algorithm,
+		Scopes:          scopes,
+		Roles:           roles,
+		AllowedNetworks: networks,
+		AllowedMethods:  methods,
+		Comment:         r.Key.Comment,
+		ID:              r.Key.ID,
+		Prefix:          r.Key.Prefix,
+		Payload:         r.Key.Payload,
+		Usage:           r.Key.Usage,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if p.ID == "" {
+		id, err := GenerateRandomString(40)
+		if err != nil {
+			return nil, err
+		}
+		p.ID = id
+	}
+	if r.Key.TTL < 0 {
+		return nil, errors.ErrAPIKeyTTLInvalid.WithArgs(r.Key.TTL)
+	}
+	if r.Key.TTL > 0 {
+		p.ExpiredAt = p.CreatedAt.Add(time.Duration(r.Key.TTL) * time.Second)
 	}
 	if r.Key.Disabled {
 		p.Disabled = true
@@ -101,10 +203,207 @@ func (p *APIKey) Disable() {
 	p.DisabledAt = time.Now().UTC()
 }
 
-// Match returns true when the provided API matches.
+// Suspend disables APIKey instance temporarily. Unlike Disable, it does not
+// expire the key, so the key can be re-enabled with Enable.
+func (p *APIKey) Suspend() {
+	p.Disabled = true
+	p.DisabledAt = time.Now().UTC()
+	p.ModifiedAt = p.DisabledAt
+}
+
+// Enable re-enables APIKey instance suspended with Suspend. The expired
+// key cannot be re-enabled.
+func (p *APIKey) Enable() error {
+	if p.Expired {
+		return errors.ErrCredentialExpired
+	}
+	p.Disabled = false
+	p.ModifiedAt = time.Now().UTC()
+	return nil
+}
+
+// SetComment changes the comment of APIKey instance.
+func (p *APIKey) SetComment(s string) {
+	p.Comment = s
+	p.ModifiedAt = time.Now().UTC()
+}
+
+// Rotate marks APIKey instance as rotated. The key remains valid for the
+// grace period, unless it expires earlier. The key with no grace period is
+// disabled.
+func (p *APIKey) Rotate(gracePeriod time.Duration) {
+	p.RotatedAt = time.Now().UTC()
+	if gracePeriod <= 0 {
+		p.Disable()
+		return
+	}
+	expiredAt := p.RotatedAt.Add(gracePeriod)
+	if p.ExpiredAt.IsZero() || expiredAt.Before(p.ExpiredAt) {
+		p.ExpiredAt = expiredAt
+	}
+}
+
+// IsValid returns true when APIKey instance is neither disabled nor expired.
+func (p *APIKey) IsValid() bool {
+	if p.Disabled || p.Expired {
+		return false
+	}
+	if !p.ExpiredAt.IsZero() && !time.Now().UTC().Before(p.ExpiredAt) {
+		return false
+	}
+	return true
+}
+
+// Authorize checks whether APIKey instance is allowed to be used from the
+// provided IP address with the provided HTTP method.
+func (p *APIKey) Authorize(addr, method string) error {
+	if len(p.AllowedNetworks) > 0 {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return errors.ErrLookupAPIKeyNetworkDenied.WithArgs(addr)
+		}
+		var allowed bool
+		for _, s := range p.AllowedNetworks {
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				continue
+			}
+			if network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.ErrLookupAPIKeyNetworkDenied.WithArgs(addr)
+		}
+	}
+	if len(p.AllowedMethods) > 0 {
+		method = strings.ToUpper(method)
+		for _, s := range p.AllowedMethods {
+			if s == method {
+				return nil
+			}
+		}
+		return errors.ErrLookupAPIKeyMethodDenied.WithArgs(method)
+	}
+	return nil
+}
+
+// Use records the usage of APIKey instance.
+func (p *APIKey) Use(u *APIKeyUsage) {
+	if u.LastUsedAt.After(p.LastUsedAt) {
+		p.LastUsedAt = u.LastUsedAt
+		p.LastUsedIP = u.LastUsedIP
+		p.LastUsedUserAgent = u.LastUsedUserAgent
+	}
+	p.UseCount += u.UseCount
+}
+
+// Match returns true when the provided API matches the bcrypt hash of the
+// key. The keys stored as HMAC-SHA256 digests are matched with MatchDigest.
 func (p *APIKey) Match(s string) bool {
+	if p.Algorithm == apiKeyAlgorithmHMAC {
+		return false
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(p.Payload), []byte(s)); err == nil {
 		return true
 	}
 	return false
 }
+
+// MatchDigest returns true when the provided HMAC-SHA256 digest of API key
+// matches the digest of the key. The comparison is constant-time.
+func (p *APIKey) MatchDigest(s string) bool {
+	if p.Algorithm != apiKeyAlgorithmHMAC {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(p.Payload), []byte(s)) == 1
+}
+
+// getAPIKeyDigest returns hex-encoded HMAC-SHA256 digest of API key.
+func getAPIKeyDigest(secret []byte, s string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GetRoles returns the roles granted to the key, i.e. the subset of the
+// provided roles of the key owner.
+func (p *APIKey) GetRoles(ownerRoles []string) []string {
+	if len(p.Roles) == 0 {
+		return ownerRoles
+	}
+	var roles []string
+	for _, role := range p.Roles {
+		for _, ownerRole := range ownerRoles {
+			if role == ownerRole {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// normalizeAPIKeyEntries trims and deduplicates the scopes or roles of
+// an API key. It returns false when any of the entries is empty.
+func normalizeAPIKeyEntries(arr []string) ([]string, bool) {
+	var entries []string
+	m := make(map[string]bool)
+	for _, s := range arr {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, false
+		}
+		if m[s] {
+			continue
+		}
+		m[s] = true
+		entries = append(entries, s)
+	}
+	return entries, true
+}
+
+// normalizeAPIKeyNetworks validates the CIDR ranges of an API key. The IP
+// addresses are converted to single-host ranges.
+func normalizeAPIKeyNetworks(arr []string) ([]string, error) {
+	var networks []string
+	for _, s := range arr {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.ErrAPIKeyNetworkInvalid.WithArgs(s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.ErrAPIKeyNetworkInvalid.WithArgs(s)
+		}
+		networks = append(networks, network.String())
+	}
+	return networks, nil
+}
+
+// normalizeAPIKeyMethods validates the HTTP methods of an API key.
+func normalizeAPIKeyMethods(arr []string) ([]string, error) {
+	var methods []string
+	for _, s := range arr {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		if s == "" {
+			return nil, errors.ErrAPIKeyMethodInvalid.WithArgs(s)
+		}
+		for _, c := range s {
+			if c < 'A' || c > 'Z' {
+				return nil, errors.ErrAPIKeyMethodInvalid.WithArgs(s)
+			}
+		}
+		methods = append(methods, s)
+	}
+	return methods, nil
+}
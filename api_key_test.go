@@ -20,6 +20,7 @@ import (
 	"github.com/greenpau/go-identity/pkg/errors"
 	"github.com/greenpau/go-identity/pkg/requests"
 	"testing"
+	"time"
 )
 
 func TestNewAPIKey(t *testing.T) {
@@ -61,6 +62,64 @@ func TestNewAPIKey(t *testing.T) {
 				"disabled": true,
 			},
 		},
+		{
+			name: "test api key with scopes and roles",
+			req: &requests.Request{
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "jsmith-api-key",
+					Payload: GetRandomStringFromRange(72, 96),
+					Scopes:  []string{"read:users", " write:users ", "read:users"},
+					Roles:   []string{"viewer"},
+				},
+			},
+			want: map[string]interface{}{
+				"usage":    "api",
+				"comment":  "jsmith-api-key",
+				"disabled": false,
+				"scopes":   []string{"read:users", "write:users"},
+				"roles":    []string{"viewer"},
+			},
+		},
+		{
+			name: "test api key with negative ttl",
+			req: &requests.Request{
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "jsmith-api-key",
+					Payload: GetRandomStringFromRange(72, 96),
+					TTL:     -1,
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAPIKeyTTLInvalid.WithArgs(-1),
+		},
+		{
+			name: "test api key with empty scope",
+			req: &requests.Request{
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "jsmith-api-key",
+					Payload: GetRandomStringFromRange(72, 96),
+					Scopes:  []string{"read:users", " "},
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAPIKeyScopeEmpty,
+		},
+		{
+			name: "test api key with empty role",
+			req: &requests.Request{
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "jsmith-api-key",
+					Payload: GetRandomStringFromRange(72, 96),
+					Roles:   []string{""},
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAPIKeyRoleEmpty,
+		},
 		{
 			name: "test api key with empty payload",
 			req: &requests.Request{
@@ -141,6 +200,10 @@ func TestNewAPIKey(t *testing.T) {
 			got["usage"] = key.Usage
 			got["comment"] = key.Comment
 			got["disabled"] = key.Disabled
+			if _, exists := tc.want["scopes"]; exists {
+				got["scopes"] = key.Scopes
+				got["roles"] = key.Roles
+			}
 
 			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
 			key.Disable()
@@ -152,3 +215,315 @@ func TestNewAPIKey(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeyGetRoles(t *testing.T) {
+	testcases := []struct {
+		name       string
+		roles      []string
+		ownerRoles []string
+		want       []string
+	}{
+		{
+			name:       "test unscoped api key",
+			ownerRoles: []string{"viewer", "editor"},
+			want:       []string{"viewer", "editor"},
+		},
+		{
+			name:       "test scoped api key",
+			roles:      []string{"editor"},
+			ownerRoles: []string{"viewer", "editor"},
+			want:       []string{"editor"},
+		},
+		{
+			name:       "test scoped api key with revoked owner role",
+			roles:      []string{"admin", "viewer"},
+			ownerRoles: []string{"viewer", "editor"},
+			want:       []string{"viewer"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			key := &APIKey{Roles: tc.roles}
+			tests.EvalObjectsWithLog(t, "roles", tc.want, key.GetRoles(tc.ownerRoles), msgs)
+		})
+	}
+}
+
+func TestAPIKeyValidity(t *testing.T) {
+	testcases := []struct {
+		name        string
+		ttl         int
+		disabled    bool
+		rotate      bool
+		gracePeriod time.Duration
+		shift       time.Duration
+		want        map[string]interface{}
+	}{
+		{
+			name: "test api key without ttl",
+			want: map[string]interface{}{
+				"valid":    true,
+				"expiring": false,
+			},
+		},
+		{
+			name: "test api key with ttl",
+			ttl:  3600,
+			want: map[string]interface{}{
+				"valid":    true,
+				"expiring": true,
+			},
+		},
+		{
+			name:  "test expired api key",
+			ttl:   3600,
+			shift: 2 * time.Hour,
+			want: map[string]interface{}{
+				"valid":    false,
+				"expiring": true,
+			},
+		},
+		{
+			name:     "test disabled api key",
+			disabled: true,
+			want: map[string]interface{}{
+				"valid":    false,
+				"expiring": false,
+			},
+		},
+		{
+			name:        "test rotated api key within grace period",
+			rotate:      true,
+			gracePeriod: time.Hour,
+			want: map[string]interface{}{
+				"valid":    true,
+				"expiring": true,
+			},
+		},
+		{
+			name:        "test rotated api key after grace period",
+			rotate:      true,
+			gracePeriod: time.Hour,
+			shift:       2 * time.Hour,
+			want: map[string]interface{}{
+				"valid":    false,
+				"expiring": true,
+			},
+		},
+		{
+			name:   "test rotated api key without grace period",
+			rotate: true,
+			want: map[string]interface{}{
+				"valid":    false,
+				"expiring": true,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			key, err := NewAPIKey(&requests.Request{
+				Key: requests.Key{
+					Usage:    "api",
+					Comment:  "jsmith-api-key",
+					Payload:  GetRandomStringFromRange(72, 96),
+					TTL:      tc.ttl,
+					Disabled: tc.disabled,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.rotate {
+				key.Rotate(tc.gracePeriod)
+			}
+			if tc.shift > 0 && !key.ExpiredAt.IsZero() {
+				key.ExpiredAt = key.ExpiredAt.Add(-tc.shift)
+			}
+			got := make(map[string]interface{})
+			got["valid"] = key.IsValid()
+			got["expiring"] = !key.ExpiredAt.IsZero()
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestAPIKeyMatch(t *testing.T) {
+	secret := []byte(GetRandomString(64))
+	payload := GetRandomStringFromRange(72, 96)
+	hk, err := NewPasswordWithOptions(payload, "generic", "bcrypt", map[string]interface{}{"pepper_id": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		name      string
+		algorithm string
+		payload   string
+		input     string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "test bcrypt api key",
+			algorithm: "bcrypt",
+			payload:   hk.Hash,
+			input:     payload,
+			want: map[string]interface{}{
+				"match":        true,
+				"match_digest": false,
+			},
+		},
+		{
+			name:      "test hmac api key",
+			algorithm: "hmac-sha256",
+			payload:   getAPIKeyDigest(secret, payload),
+			input:     payload,
+			want: map[string]interface{}{
+				"match":        false,
+				"match_digest": true,
+			},
+		},
+		{
+			name:      "test hmac api key with invalid input",
+			algorithm: "hmac-sha256",
+			payload:   getAPIKeyDigest(secret, payload),
+			input:     payload + "a",
+			want: map[string]interface{}{
+				"match":        false,
+				"match_digest": false,
+			},
+		},
+		{
+			name:      "test unsupported api key algorithm",
+			algorithm: "md5",
+			payload:   payload,
+			shouldErr: true,
+			err:       errors.ErrAPIKeyAlgorithmUnsupported.WithArgs("md5"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			key, err := NewAPIKey(&requests.Request{
+				Key: requests.Key{
+					Usage:     "api",
+					Comment:   "jsmith-api-key",
+					Algorithm: tc.algorithm,
+					Payload:   tc.payload,
+				},
+			})
+			if tests.EvalErrWithLog(t, err, "new api key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["match"] = key.Match(tc.input)
+			got["match_digest"] = key.MatchDigest(getAPIKeyDigest(secret, tc.input))
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestAPIKeyAuthorize(t *testing.T) {
+	testcases := []struct {
+		name      string
+		networks  []string
+		methods   []string
+		addr      string
+		method    string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "test unrestricted api key",
+			addr:   "203.0.113.10",
+			method: "DELETE",
+			want: map[string]interface{}{
+				"networks": []string(nil),
+				"methods":  []string(nil),
+			},
+		},
+		{
+			name:     "test api key from allowed network",
+			networks: []string{"10.1.0.0/16", "192.168.1.10", "2001:db8::/32"},
+			methods:  []string{"get", " POST "},
+			addr:     "10.1.2.3",
+			method:   "get",
+			want: map[string]interface{}{
+				"networks": []string{"10.1.0.0/16", "192.168.1.10/32", "2001:db8::/32"},
+				"methods":  []string{"GET", "POST"},
+			},
+		},
+		{
+			name:     "test api key from allowed ipv6 network",
+			networks: []string{"10.1.0.0/16", "2001:db8::/32"},
+			addr:     "2001:db8::1",
+			method:   "GET",
+			want: map[string]interface{}{
+				"networks": []string{"10.1.0.0/16", "2001:db8::/32"},
+				"methods":  []string(nil),
+			},
+		},
+		{
+			name:      "test api key from denied network",
+			networks:  []string{"10.1.0.0/16"},
+			addr:      "10.2.0.1",
+			method:    "GET",
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyNetworkDenied.WithArgs("10.2.0.1"),
+		},
+		{
+			name:      "test api key from unknown address",
+			networks:  []string{"10.1.0.0/16"},
+			method:    "GET",
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyNetworkDenied.WithArgs(""),
+		},
+		{
+			name:      "test api key with denied method",
+			methods:   []string{"GET"},
+			addr:      "10.1.2.3",
+			method:    "delete",
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyMethodDenied.WithArgs("DELETE"),
+		},
+		{
+			name:      "test api key with invalid network",
+			networks:  []string{"10.1.0.0/33"},
+			shouldErr: true,
+			err:       errors.ErrAPIKeyNetworkInvalid.WithArgs("10.1.0.0/33"),
+		},
+		{
+			name:      "test api key with invalid method",
+			methods:   []string{"GET /"},
+			shouldErr: true,
+			err:       errors.ErrAPIKeyMethodInvalid.WithArgs("GET /"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			key, err := NewAPIKey(&requests.Request{
+				Key: requests.Key{
+					Usage:           "api",
+					Comment:         "jsmith-api-key",
+					Payload:         GetRandomStringFromRange(72, 96),
+					AllowedNetworks: tc.networks,
+					AllowedMethods:  tc.methods,
+				},
+			})
+			if err == nil {
+				err = key.Authorize(tc.addr, tc.method)
+			}
+			if tests.EvalErrWithLog(t, err, "authorize", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["networks"] = key.AllowedNetworks
+			got["methods"] = key.AllowedMethods
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
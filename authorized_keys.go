@@ -0,0 +1,148 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"github.com/greenpau/go-identity/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"time"
+)
+
+// authorizedKeyOptions are the options of authorized_keys entries supported
+// by sshd. The value indicates whether the option takes an argument. The
+// cert-authority option, which turns a user key into a certificate
+// authority, and the environment option, which sets arbitrary variables,
+// e.g. LD_PRELOAD, are not allowed.
+var authorizedKeyOptions = map[string]bool{
+	"agent-forwarding":    false,
+	"command":             true,
+	"expiry-time":         true,
+	"from":                true,
+	"no-agent-forwarding": false,
+	"no-port-forwarding":  false,
+	"no-pty":              false,
+	"no-touch-required":   false,
+	"no-user-rc":          false,
+	"no-x11-forwarding":   false,
+	"permitlisten":        true,
+	"permitopen":          true,
+	"port-forwarding":     false,
+	"principals":          true,
+	"pty":                 false,
+	"restrict":            false,
+	"tunnel":              true,
+	"user-rc":             false,
+	"verify-required":     false,
+	"x11-forwarding":      false,
+}
+
+// authorizedKeyExpiryTimeFormats are the formats of expiry-time option,
+// i.e. YYYYMMDD[HHMM[SS]].
+var authorizedKeyExpiryTimeFormats = map[int]string{
+	8:  "20060102",
+	12: "200601021504",
+	14: "20060102150405",
+}
+
+// normalizeAuthorizedKeyOptions validates the options of authorized_keys
+// entries and returns them in canonical form, e.g. from="10.0.0.0/8".
+func normalizeAuthorizedKeyOptions(entries []string) ([]string, error) {
+	var options []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value := entry, ""
+		i := strings.Index(entry, "=")
+		if i >= 0 {
+			name, value = entry[:i], entry[i+1:]
+			if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = value[1 : len(value)-1]
+			}
+		}
+		name = strings.ToLower(name)
+		hasValue, exists := authorizedKeyOptions[name]
+		if !exists {
+			return nil, errors.ErrPublicKeyOptionUnsupported.WithArgs(name)
+		}
+		if hasValue != (i >= 0) || (hasValue && value == "") {
+			return nil, errors.ErrPublicKeyOptionInvalid.WithArgs(entry)
+		}
+		if strings.ContainsAny(value, "\"\\\r\n") {
+			return nil, errors.ErrPublicKeyOptionInvalid.WithArgs(entry)
+		}
+		if name == "expiry-time" {
+			layout, exists := authorizedKeyExpiryTimeFormats[len(value)]
+			if !exists {
+				return nil, errors.ErrPublicKeyOptionInvalid.WithArgs(entry)
+			}
+			if _, err := time.Parse(layout, value); err != nil {
+				return nil, errors.ErrPublicKeyOptionInvalid.WithArgs(entry)
+			}
+		}
+		if !hasValue {
+			options = append(options, name)
+			continue
+		}
+		options = append(options, name+"=\""+value+"\"")
+	}
+	return options, nil
+}
+
+// SetOptions sets the options of the authorized_keys entry of PublicKey
+// instance, e.g. from="10.0.0.0/8" or no-port-forwarding.
+func (p *PublicKey) SetOptions(entries []string) error {
+	options, err := normalizeAuthorizedKeyOptions(entries)
+	if err != nil {
+		return err
+	}
+	p.Options = options
+	p.ModifiedAt = time.Now().UTC()
+	return nil
+}
+
+// GetAuthorizedKey returns PublicKey instance in authorized_keys format,
+// prefixed with the options of the key.
+func (p *PublicKey) GetAuthorizedKey() (string, error) {
+	publicKey, err := p.getSSHPublicKey()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if len(p.Options) > 0 {
+		sb.WriteString(strings.Join(p.Options, ","))
+		sb.WriteString(" ")
+	}
+	sb.WriteString(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))))
+	if comment := strings.Join(strings.Fields(p.Comment), " "); comment != "" {
+		sb.WriteString(" ")
+		sb.WriteString(comment)
+	}
+	return sb.String(), nil
+}
+
+// isAuthorized returns true when PublicKey instance is an SSH key that is
+// neither disabled nor expired.
+func (p *PublicKey) isAuthorized() bool {
+	if p.Usage != "ssh" || p.Disabled || p.Expired {
+		return false
+	}
+	if !p.ExpiredAt.IsZero() && !time.Now().UTC().Before(p.ExpiredAt) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+)
+
+func TestNormalizeAuthorizedKeyOptions(t *testing.T) {
+	testcases := []struct {
+		name      string
+		options   []string
+		want      []string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test options with and without values",
+			options: []string{
+				`from="10.0.0.0/8,192.168.1.*"`,
+				"command=/usr/bin/backup",
+				"No-Port-Forwarding",
+				`expiry-time="20261231"`,
+				"",
+			},
+			want: []string{
+				`from="10.0.0.0/8,192.168.1.*"`,
+				`command="/usr/bin/backup"`,
+				"no-port-forwarding",
+				`expiry-time="20261231"`,
+			},
+		},
+		{
+			name:    "test expiry time with hours and minutes",
+			options: []string{"expiry-time=202612311530"},
+			want:    []string{`expiry-time="202612311530"`},
+		},
+		{
+			name:      "test unsupported option",
+			options:   []string{"foobar"},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionUnsupported.WithArgs("foobar"),
+		},
+		{
+			name:      "test cert authority option",
+			options:   []string{"cert-authority"},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionUnsupported.WithArgs("cert-authority"),
+		},
+		{
+			name:      "test environment option",
+			options:   []string{"environment=LD_PRELOAD=/tmp/x.so"},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionUnsupported.WithArgs("environment"),
+		},
+		{
+			name:      "test option without required value",
+			options:   []string{"command"},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionInvalid.WithArgs("command"),
+		},
+		{
+			name:      "test option with unexpected value",
+			options:   []string{"no-pty=yes"},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionInvalid.WithArgs("no-pty=yes"),
+		},
+		{
+			name:      "test option with embedded quote",
+			options:   []string{`command="/bin/sh" ,no-pty`},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionInvalid.WithArgs(`command="/bin/sh" ,no-pty`),
+		},
+		{
+			name:      "test malformed expiry time",
+			options:   []string{"expiry-time=20261345"},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyOptionInvalid.WithArgs("expiry-time=20261345"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			got, err := normalizeAuthorizedKeyOptions(tc.options)
+			if tests.EvalErrWithLog(t, err, "normalize", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "options", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseAuthorizedKeys(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseAuthorizedKeys")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user := requests.User{Username: testUser1, Email: testEmail1}
+	var entries []string
+	var keyIDs []string
+	for i, algo := range []string{"ed25519", "ecdsa", "rsa"} {
+		_, publicKey := tests.GetCryptoKeyPair(t, algo, "openssh")
+		r := &requests.Request{
+			User: user,
+			Key: requests.Key{
+				Usage:   "ssh",
+				Payload: publicKey,
+				Comment: fmt.Sprintf("jsmith key %d", i),
+			},
+		}
+		if i == 0 {
+			r.Key.Options = []string{"from=10.0.0.0/8", "no-port-forwarding"}
+		}
+		if err := db.AddPublicKey(r); err != nil {
+			t.Fatal(err)
+		}
+		u, _ := db.getUser(testUser1)
+		keyIDs = append(keyIDs, u.PublicKeys[len(u.PublicKeys)-1].ID)
+		entries = append(entries, strings.TrimSpace(publicKey)+" "+r.Key.Comment)
+	}
+	if err := db.DisablePublicKey(&requests.Request{User: user, Key: requests.Key{ID: keyIDs[2]}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPublicKeyOptions(&requests.Request{
+		User: user,
+		Key: requests.Key{
+			ID:      keyIDs[1],
+			Options: []string{"command=/usr/bin/backup", "expiry-time=20991231"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name      string
+		username  string
+		want      string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:     "get authorized keys of user",
+			username: testUser1,
+			want: `from="10.0.0.0/8",no-port-forwarding ` + entries[0] + "\n" +
+				`command="/usr/bin/backup",expiry-time="20991231" ` + entries[1] + "\n",
+		},
+		{
+			name:     "get authorized keys of user without keys",
+			username: testUser2,
+		},
+		{
+			name:      "get authorized keys of unknown user",
+			username:  "foobar",
+			shouldErr: true,
+			err:       errors.ErrGetAuthorizedKeys.WithArgs("foobar", errors.ErrDatabaseUserNotFound),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			r := &requests.Request{User: requests.User{Username: tc.username}}
+			err := db.GetAuthorizedKeys(r)
+			if tests.EvalErrWithLog(t, err, "get authorized keys", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "authorized keys", tc.want, r.Response.Payload.(string), msgs)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/greenpau/go-identity"
+	"github.com/greenpau/go-identity/pkg/requests"
+	"github.com/urfave/cli/v2"
+)
+
+func getAllowedSigners(c *cli.Context) error {
+	db, err := identity.NewDatabase(c.String("database"))
+	if err != nil {
+		return err
+	}
+	r := requests.NewRequest()
+	r.Signature.Namespace = c.String("namespace")
+	if err := db.GetAllowedSigners(r); err != nil {
+		return err
+	}
+	fmt.Fprint(c.App.Writer, r.Response.Payload.(string))
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/greenpau/go-identity"
+	"github.com/urfave/cli/v2"
+	"os"
+)
+
+// generateAPIKeySecret writes a random API key secret to a new file. The
+// file is loaded with LoadAPIKeySecret of the database.
+func generateAPIKeySecret(c *cli.Context) error {
+	if c.Int("length") < 32 {
+		return fmt.Errorf("api key secret is shorter than 32 characters")
+	}
+	secret, err := identity.GenerateRandomString(c.Int("length"))
+	if err != nil {
+		return err
+	}
+	fp := c.String("output")
+	f, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(secret); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "wrote api key secret to %s\n", fp)
+	return nil
+}
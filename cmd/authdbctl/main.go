@@ -45,6 +45,172 @@ func init() {
 		Usage:   "Sets path to configuration from `CONFIG_PATH` (default: ~/.config/authdbctl/config.json)",
 		EnvVars: []string{"AUTHDBCTL_CONFIG_PATH"},
 	})
+	sh.Commands = append(sh.Commands, &cli.Command{
+		Name:   "generate-password",
+		Usage:  "Generates a random password or passphrase compliant with the password policy of a database",
+		Action: generatePassword,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Sets path to the database from `DATABASE_PATH`",
+				EnvVars:  []string{"AUTHDBCTL_DATABASE_PATH"},
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "passphrase",
+				Usage: "Generates a diceware-style passphrase instead of a password",
+			},
+			&cli.IntFlag{
+				Name:  "length",
+				Usage: "Sets the length of the password (default: policy-based)",
+			},
+			&cli.IntFlag{
+				Name:  "words",
+				Usage: "Sets the number of words in the passphrase (default: 6)",
+			},
+			&cli.StringFlag{
+				Name:  "separator",
+				Usage: "Sets the separator of the words in the passphrase (default: -)",
+			},
+			&cli.IntFlag{
+				Name:  "count",
+				Usage: "Sets the number of passwords to generate",
+				Value: 1,
+			},
+		},
+	})
+	sh.Commands = append(sh.Commands, &cli.Command{
+		Name:   "issue-ssh-certificate",
+		Usage:  "Issues an OpenSSH user certificate for the SSH public key of a user",
+		Action: issueSSHCertificate,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Sets path to the database from `DATABASE_PATH`",
+				EnvVars:  []string{"AUTHDBCTL_DATABASE_PATH"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "ca-key",
+				Usage:    "Sets path to the private key of the certificate authority from `CA_KEY_PATH`",
+				EnvVars:  []string{"AUTHDBCTL_SSH_CA_KEY_PATH"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "username",
+				Aliases:  []string{"u"},
+				Usage:    "Sets the username of the key owner",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "email",
+				Usage: "Sets the email address of the key owner",
+			},
+			&cli.StringFlag{
+				Name:     "key-id",
+				Usage:    "Sets the id of the SSH public key",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "validity",
+				Usage: "Sets the validity period of the certificate, in seconds",
+				Value: 3600,
+			},
+			&cli.IntFlag{
+				Name:  "max-validity",
+				Usage: "Sets the maximum validity period of the certificate, in seconds",
+			},
+			&cli.StringSliceFlag{
+				Name:  "critical-option",
+				Usage: "Adds the critical option to the certificate, e.g. force-command=/usr/bin/true",
+			},
+			&cli.StringSliceFlag{
+				Name:  "extension",
+				Usage: "Adds the extension to the certificate, e.g. permit-pty (default: ssh-keygen defaults)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "role-principal",
+				Usage: "Maps the role of the user to the principal of the certificate, e.g. admin=root",
+			},
+		},
+	})
+	sh.Commands = append(sh.Commands, &cli.Command{
+		Name:      "authorized-keys",
+		Usage:     "Prints the enabled SSH keys of a user in authorized_keys format, e.g. for AuthorizedKeysCommand of sshd",
+		ArgsUsage: "USERNAME",
+		Action:    getAuthorizedKeys,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Sets path to the database from `DATABASE_PATH`",
+				EnvVars:  []string{"AUTHDBCTL_DATABASE_PATH"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "username",
+				Aliases: []string{"u"},
+				Usage:   "Sets the username of the key owner (default: the first argument)",
+			},
+		},
+	})
+	sh.Commands = append(sh.Commands, &cli.Command{
+		Name:   "allowed-signers",
+		Usage:  "Prints the enabled SSH keys of the users in allowed_signers format, e.g. for gpg.ssh.allowedSignersFile of git",
+		Action: getAllowedSigners,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Sets path to the database from `DATABASE_PATH`",
+				EnvVars:  []string{"AUTHDBCTL_DATABASE_PATH"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "namespace",
+				Aliases: []string{"n"},
+				Usage:   "Limits the keys to the comma-separated `NAMESPACES`, e.g. git",
+			},
+		},
+	})
+	sh.Commands = append(sh.Commands, &cli.Command{
+		Name:   "api-key-secret",
+		Usage:  "Generates the secret of API key digests to a new file, to be loaded with LoadAPIKeySecret of a database",
+		Action: generateAPIKeySecret,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "output",
+				Aliases:  []string{"o"},
+				Usage:    "Sets path to the new secret file to `SECRET_PATH`",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "length",
+				Usage: "Sets the length of the secret",
+				Value: 64,
+			},
+		},
+	})
+	sh.Commands = append(sh.Commands, &cli.Command{
+		Name:   "public-key-report",
+		Usage:  "Prints the enabled public keys violating the public key policy of a database, or registered by more than one user",
+		Action: getPublicKeyReport,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Sets path to the database from `DATABASE_PATH`",
+				EnvVars:  []string{"AUTHDBCTL_DATABASE_PATH"},
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "disable",
+				Usage: "Disables the reported keys",
+			},
+		},
+	})
 }
 
 func main() {
@@ -0,0 +1,41 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/greenpau/go-identity"
+	"github.com/urfave/cli/v2"
+)
+
+func generatePassword(c *cli.Context) error {
+	db, err := identity.NewDatabase(c.String("database"))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < c.Int("count"); i++ {
+		var s string
+		if c.Bool("passphrase") {
+			s, err = db.GeneratePassphrase(c.Int("words"), c.String("separator"))
+		} else {
+			s, err = db.GeneratePassword(c.Int("length"))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.App.Writer, s)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/greenpau/go-identity"
+	"github.com/urfave/cli/v2"
+)
+
+func getPublicKeyReport(c *cli.Context) error {
+	db, err := identity.NewDatabase(c.String("database"))
+	if err != nil {
+		return err
+	}
+	entries, err := db.GetNonCompliantPublicKeys(c.Bool("disable"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		status := "enabled"
+		if entry.Disabled {
+			status = "disabled"
+		}
+		fmt.Fprintf(c.App.Writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Username, entry.ID, entry.Usage, entry.Type, status, entry.Violation,
+		)
+	}
+	return nil
+}
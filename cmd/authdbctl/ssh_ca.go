@@ -0,0 +1,68 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/greenpau/go-identity"
+	"github.com/greenpau/go-identity/pkg/requests"
+	"github.com/urfave/cli/v2"
+	"strings"
+)
+
+func issueSSHCertificate(c *cli.Context) error {
+	db, err := identity.NewDatabase(c.String("database"))
+	if err != nil {
+		return err
+	}
+	ca, err := identity.NewSSHCertificateAuthority(c.String("ca-key"))
+	if err != nil {
+		return err
+	}
+	ca.MaxValidity = c.Int("max-validity")
+	ca.RolePrincipals = parseKeyValues(c.StringSlice("role-principal"))
+	db.SetSSHCertificateAuthority(ca)
+
+	r := requests.NewRequest()
+	r.User.Username = c.String("username")
+	r.User.Email = c.String("email")
+	r.Key.ID = c.String("key-id")
+	r.Certificate.Validity = c.Int("validity")
+	r.Certificate.CriticalOptions = parseKeyValues(c.StringSlice("critical-option"))
+	r.Certificate.Extensions = parseKeyValues(c.StringSlice("extension"))
+	if err := db.IssueSSHCertificate(r); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, r.Response.Payload.(string))
+	return nil
+}
+
+// parseKeyValues parses the key=value pairs, e.g. force-command=/bin/true.
+// The keys without values, e.g. permit-pty, have empty values.
+func parseKeyValues(entries []string) map[string]string {
+	if len(entries) == 0 {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, entry := range entries {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) == 1 {
+			m[kv[0]] = ""
+			continue
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
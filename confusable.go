@@ -0,0 +1,71 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"strings"
+)
+
+// confusableRunes maps the characters to the Latin characters they
+// visually resemble. See also Unicode Technical Standard #39.
+var confusableRunes = map[rune]string{
+	// Cyrillic
+	'а': "a", 'А': "a", 'В': "b", 'ь': "b", 'с': "c", 'С': "c", 'ԁ': "d",
+	'е': "e", 'Е': "e", 'ё': "e", 'һ': "h", 'Н': "h", 'і': "i", 'І': "i",
+	'ј': "j", 'Ј': "j", 'К': "k", 'к': "k", 'М': "m", 'о': "o", 'О': "o",
+	'р': "p", 'Р': "p", 'ԛ': "q", 'ѕ': "s", 'Ѕ': "s", 'Т': "t", 'у': "y",
+	'У': "y", 'ԝ': "w", 'х': "x", 'Х': "x",
+	// Greek
+	'α': "a", 'Α': "a", 'Β': "b", 'ε': "e", 'Ε': "e", 'Η': "h", 'ι': "i",
+	'Ι': "i", 'κ': "k", 'Κ': "k", 'Μ': "m", 'ν': "v", 'Ν': "n", 'ο': "o",
+	'Ο': "o", 'ρ': "p", 'Ρ': "p", 'τ': "t", 'Τ': "t", 'υ': "u", 'Υ': "y",
+	'χ': "x", 'Χ': "x", 'Ζ': "z",
+	// Latin
+	'ı': "i", 'ℓ': "l", 'ß': "ss",
+	// ASCII. The uppercase I resembles the lowercase l, unlike the
+	// lowercase i.
+	'0': "o", '1': "l", 'I': "l", '|': "l",
+}
+
+// confusableSequences maps the character sequences to the Latin characters
+// they visually resemble.
+var confusableSequences = strings.NewReplacer(
+	"rn", "m",
+	"vv", "w",
+	"cl", "d",
+)
+
+// getUsernameSkeleton returns the skeleton of a username. The usernames
+// having the same skeleton are visually confusable.
+func getUsernameSkeleton(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		// Fullwidth ASCII variants.
+		if c >= 0xFF01 && c <= 0xFF5E {
+			c = c - 0xFF01 + 0x21
+		}
+		if v, exists := confusableRunes[c]; exists {
+			sb.WriteString(v)
+			continue
+		}
+		lc := []rune(strings.ToLower(string(c)))[0]
+		if v, exists := confusableRunes[lc]; exists {
+			sb.WriteString(v)
+			continue
+		}
+		sb.WriteRune(lc)
+	}
+	return confusableSequences.Replace(sb.String())
+}
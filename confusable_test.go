@@ -0,0 +1,52 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+)
+
+func TestUsernameSkeleton(t *testing.T) {
+	testcases := []struct {
+		name string
+		a    string
+		b    string
+		want bool
+	}{
+		{name: "same usernames", a: "jsmith", b: "jsmith", want: true},
+		{name: "different usernames", a: "jsmith", b: "bjones", want: false},
+		{name: "uppercase letters", a: "JSmith", b: "jsmith", want: true},
+		{name: "digit one and letter l", a: "pau1", b: "paul", want: true},
+		{name: "digit zero and letter o", a: "r00t", b: "root", want: true},
+		{name: "uppercase letter i and letter l", a: "admIn", b: "admln", want: true},
+		{name: "lowercase letter i and letter l", a: "ian", b: "lan", want: false},
+		{name: "lowercase letter i and reserved name", a: "apl", b: "api", want: false},
+		{name: "cyrillic letters", a: "аdmin", b: "admin", want: true},
+		{name: "greek letters", a: "rοοt", b: "root", want: true},
+		{name: "fullwidth letters", a: "ａdmin", b: "admin", want: true},
+		{name: "letters rn and m", a: "jsrnith", b: "jsmith", want: true},
+		{name: "letters vv and w", a: "vvebmaster", b: "webmaster", want: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			got := getUsernameSkeleton(tc.a) == getUsernameSkeleton(tc.b)
+			tests.EvalObjectsWithLog(t, "skeleton", tc.want, got, msgs)
+		})
+	}
+}
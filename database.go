@@ -15,12 +15,16 @@
 package identity
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/greenpau/go-identity/internal/utils"
+	"github.com/greenpau/go-identity/pkg/apikey"
 	"github.com/greenpau/go-identity/pkg/errors"
 	"github.com/greenpau/go-identity/pkg/requests"
 	"github.com/greenpau/versioned"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -42,6 +46,12 @@ var (
 			MaxLength:            50,
 			AllowNonAlphaNumeric: false,
 			AllowUppercase:       false,
+			ReservedNames: []string{
+				"abuse", "admin", "administrator", "anonymous", "api", "auth",
+				"billing", "daemon", "help", "helpdesk", "hostmaster", "info",
+				"nobody", "noreply", "operator", "postmaster", "root", "security",
+				"superuser", "support", "sysadmin", "system", "webmaster",
+			},
 		},
 		Password: PasswordPolicy{
 			KeepVersions:           10,
@@ -54,6 +64,12 @@ var (
 			BlockReuse:             false,
 			BlockPasswordChange:    false,
 		},
+		APIKey: APIKeyPolicy{
+			Prefix: apikey.DefaultPrefix,
+		},
+		MfaToken: MfaTokenPolicy{
+			TOTPSkew: intPtr(defaultTOTPSkew),
+		},
 	}
 )
 
@@ -70,8 +86,64 @@ func init() {
 
 // Policy represents database usage policy.
 type Policy struct {
-	Password PasswordPolicy `json:"password,omitempty" xml:"password,omitempty" yaml:"password,omitempty"`
-	User     UserPolicy     `json:"user,omitempty" xml:"user,omitempty" yaml:"user,omitempty"`
+	Password  PasswordPolicy  `json:"password,omitempty" xml:"password,omitempty" yaml:"password,omitempty"`
+	User      UserPolicy      `json:"user,omitempty" xml:"user,omitempty" yaml:"user,omitempty"`
+	APIKey    APIKeyPolicy    `json:"api_key,omitempty" xml:"api_key,omitempty" yaml:"api_key,omitempty"`
+	PublicKey PublicKeyPolicy `json:"public_key,omitempty" xml:"public_key,omitempty" yaml:"public_key,omitempty"`
+	MfaToken  MfaTokenPolicy  `json:"mfa_token,omitempty" xml:"mfa_token,omitempty" yaml:"mfa_token,omitempty"`
+}
+
+// MfaTokenPolicy represents database MFA token policy.
+type MfaTokenPolicy struct {
+	// TOTPSkew is the number of time steps before and after the current one
+	// within which the passcodes of TOTP tokens are accepted, to allow for
+	// clock drift. The value of 0 accepts the passcodes of the current time
+	// step only. The value is between 0 and 10. When the value is not set,
+	// it defaults to 1 time step.
+	TOTPSkew *int `json:"totp_skew" xml:"totp_skew" yaml:"totp_skew"`
+}
+
+// intPtr returns a pointer to the provided value.
+func intPtr(i int) *int {
+	return &i
+}
+
+// PublicKeyPolicy represents database public key policy. The keys violating
+// the policy are rejected when added or re-enabled. The empty values disable
+// the respective checks.
+type PublicKeyPolicy struct {
+	// MinRSABits is the minimum size of RSA keys, in bits, e.g. 3072. The
+	// size of a GPG key is the size of its smallest RSA key or subkey.
+	MinRSABits int `json:"min_rsa_bits" xml:"min_rsa_bits" yaml:"min_rsa_bits"`
+	// AllowedTypes is the list of allowed key types, i.e. rsa, dsa, ecdsa,
+	// ed25519, elgamal, or ecdh. The keys backed by FIDO security keys have
+	// the type of their algorithm, e.g. ed25519.
+	AllowedTypes []string `json:"allowed_types" xml:"allowed_types" yaml:"allowed_types"`
+	// AllowedAlgorithms is the list of allowed key algorithms, i.e. the type
+	// of PublicKey, e.g. ssh-ed25519 or sk-ssh-ed25519@openssh.com.
+	AllowedAlgorithms []string `json:"allowed_algorithms" xml:"allowed_algorithms" yaml:"allowed_algorithms"`
+	// MaxAge is the maximum age of keys, in seconds. The age of GPG keys and
+	// X.509 certificates counts from their creation, and the age of SSH
+	// keys counts from their addition to the database.
+	MaxAge int `json:"max_age" xml:"max_age" yaml:"max_age"`
+}
+
+// APIKeyPolicy represents database API key policy.
+type APIKeyPolicy struct {
+	// MaxLifetime is the maximum lifetime of API keys, in seconds. The keys
+	// created without TTL expire after the maximum lifetime. The value of 0
+	// disables the limit.
+	MaxLifetime int `json:"max_lifetime" xml:"max_lifetime" yaml:"max_lifetime"`
+	// GracePeriod is the default period of time, in seconds, a rotated API
+	// key remains valid after the rotation.
+	GracePeriod int `json:"grace_period" xml:"grace_period" yaml:"grace_period"`
+	// Prefix is the product prefix of API keys, e.g. gik. The prefix
+	// allows secret scanners to recognize the keys.
+	Prefix string `json:"prefix" xml:"prefix" yaml:"prefix"`
+	// UsageFlushInterval is the minimum period of time, in seconds, between
+	// the database commits triggered by API key usage tracking. The value of
+	// 0 defaults to 60 seconds.
+	UsageFlushInterval int `json:"usage_flush_interval" xml:"usage_flush_interval" yaml:"usage_flush_interval"`
 }
 
 // PasswordPolicy represents database password policy.
@@ -85,6 +157,9 @@ type PasswordPolicy struct {
 	RequireNonAlphaNumeric bool `json:"require_non_alpha_numeric" xml:"require_non_alpha_numeric" yaml:"require_non_alpha_numeric"`
 	BlockReuse             bool `json:"block_reuse" xml:"block_reuse" yaml:"block_reuse"`
 	BlockPasswordChange    bool `json:"block_password_change" xml:"block_password_change" yaml:"block_password_change"`
+	// MinScore is the minimum password strength score, from 0 (too
+	// guessable) to 4 (very unguessable). The score of 0 disables the check.
+	MinScore int `json:"min_score" xml:"min_score" yaml:"min_score"`
 }
 
 // UserPolicy represents database username policy
@@ -93,32 +168,65 @@ type UserPolicy struct {
 	MaxLength            int  `json:"max_length" xml:"max_length" yaml:"max_length"`
 	AllowNonAlphaNumeric bool `json:"allow_non_alpha_numeric" xml:"allow_non_alpha_numeric" yaml:"allow_non_alpha_numeric"`
 	AllowUppercase       bool `json:"allow_uppercase" xml:"allow_uppercase" yaml:"allow_uppercase"`
+	// ReservedNames is the list of usernames that cannot be used, e.g.
+	// admin, root, etc. The usernames visually confusable with the reserved
+	// names cannot be used either.
+	ReservedNames []string `json:"reserved_names" xml:"reserved_names" yaml:"reserved_names"`
 }
 
 // Database is user identity database.
 type Database struct {
-	mu              *sync.RWMutex
-	Version         string    `json:"version,omitempty" xml:"version,omitempty" yaml:"version,omitempty"`
-	Policy          Policy    `json:"policy,omitempty" xml:"policy,omitempty" yaml:"policy,omitempty"`
-	Revision        uint64    `json:"revision,omitempty" xml:"revision,omitempty" yaml:"revision,omitempty"`
-	LastModified    time.Time `json:"last_modified,omitempty" xml:"last_modified,omitempty" yaml:"last_modified,omitempty"`
-	Users           []*User   `json:"users,omitempty" xml:"users,omitempty" yaml:"users,omitempty"`
-	refEmailAddress map[string]*User
-	refUsername     map[string]*User
-	refID           map[string]*User
-	refAPIKey       map[string]*User
-	path            string
+	mu           *sync.RWMutex
+	Version      string    `json:"version,omitempty" xml:"version,omitempty" yaml:"version,omitempty"`
+	Policy       Policy    `json:"policy,omitempty" xml:"policy,omitempty" yaml:"policy,omitempty"`
+	Revision     uint64    `json:"revision,omitempty" xml:"revision,omitempty" yaml:"revision,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty" xml:"last_modified,omitempty" yaml:"last_modified,omitempty"`
+	Users        []*User   `json:"users,omitempty" xml:"users,omitempty" yaml:"users,omitempty"`
+	// APIKeySecret is the secret key of HMAC-SHA256 digests of API keys. It
+	// is kept outside of the database and set with SetAPIKeySecret or
+	// LoadAPIKeySecret.
+	APIKeySecret []byte `json:"-" xml:"-" yaml:"-"`
+	// legacyAPIKeySecret is the secret key stored in the databases created
+	// by earlier versions. It is used until the secret is set, and is not
+	// written back to the database.
+	legacyAPIKeySecret string
+	refEmailAddress    map[string]*User
+	refUsername        map[string]*User
+	refID              map[string]*User
+	refAPIKey          map[string]*User
+	refSkeleton        map[string]*User
+	refPublicKey       map[string]*User
+	path               string
+	usageMu            *sync.Mutex
+	usage              map[*APIKey]*APIKeyUsage
+	usageFlushedAt     time.Time
+	sshCA              *SSHCertificateAuthority
+	x509Pool           *x509.CertPool
+	challengeMu        *sync.Mutex
+	sshChallenges      map[string]*SSHChallenge
+	sshChallengeQueue  []*SSHChallenge
+	sshChallengeCounts map[string]int
+	peppers            *PasswordPeppers
 }
 
 // NewDatabase return an instance of Database.
 func NewDatabase(fp string) (*Database, error) {
 	db := &Database{
-		mu:              &sync.RWMutex{},
-		path:            fp,
-		refUsername:     make(map[string]*User),
-		refID:           make(map[string]*User),
-		refEmailAddress: make(map[string]*User),
-		refAPIKey:       make(map[string]*User),
+		mu:                 &sync.RWMutex{},
+		path:               fp,
+		refUsername:        make(map[string]*User),
+		refID:              make(map[string]*User),
+		refEmailAddress:    make(map[string]*User),
+		refAPIKey:          make(map[string]*User),
+		refSkeleton:        make(map[string]*User),
+		refPublicKey:       make(map[string]*User),
+		usageMu:            &sync.Mutex{},
+		usage:              make(map[*APIKey]*APIKeyUsage),
+		usageFlushedAt:     time.Now().UTC(),
+		challengeMu:        &sync.Mutex{},
+		sshChallenges:      make(map[string]*SSHChallenge),
+		sshChallengeCounts: make(map[string]int),
+		peppers:            NewPasswordPeppers(),
 	}
 	fileInfo, err := os.Stat(fp)
 	if err != nil {
@@ -144,11 +252,21 @@ func NewDatabase(fp string) (*Database, error) {
 		if err := json.Unmarshal(b, db); err != nil {
 			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
 		}
-		if changed := db.enforceDefaultPolicy(); changed {
+		legacy := struct {
+			APIKeySecret string `json:"api_key_secret"`
+		}{}
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
+		}
+		db.legacyAPIKeySecret = legacy.APIKeySecret
+		if db.enforceDefaultPolicy() {
 			if err := db.commit(); err != nil {
 				return nil, errors.ErrNewDatabase.WithArgs(fp, err)
 			}
 		}
+		if _, err := db.getTOTPSkew(); err != nil {
+			return nil, errors.ErrNewDatabase.WithArgs(fp, err)
+		}
 	}
 
 	// db.mu = &sync.RWMutex{}
@@ -168,6 +286,9 @@ func NewDatabase(fp string) (*Database, error) {
 		}
 		db.refUsername[username] = user
 		db.refID[user.ID] = user
+		if _, exists := db.refSkeleton[getUsernameSkeleton(username)]; !exists {
+			db.refSkeleton[getUsernameSkeleton(username)] = user
+		}
 		for _, email := range user.EmailAddresses {
 			emailAddress := strings.ToLower(email.Address)
 			if _, exists := db.refEmailAddress[emailAddress]; exists {
@@ -181,11 +302,26 @@ func NewDatabase(fp string) (*Database, error) {
 			}
 		}
 		for _, apiKey := range user.APIKeys {
+			if apiKey.Algorithm == "" {
+				apiKey.Algorithm = apiKeyAlgorithmBcrypt
+			}
 			if _, exists := db.refAPIKey[apiKey.Prefix]; exists {
 				return nil, errors.ErrNewDatabaseDuplicateAPIKey.WithArgs(apiKey.Prefix, user)
 			}
 			db.refAPIKey[apiKey.Prefix] = user
 		}
+		for _, k := range user.PublicKeys {
+			fingerprint := normalizePublicKeyFingerprint(k.Fingerprint)
+			if fingerprint == "" {
+				continue
+			}
+			// The keys registered by more than one user are indexed by
+			// the first user, and reported by GetNonCompliantPublicKeys.
+			if _, exists := db.refPublicKey[fingerprint]; exists {
+				continue
+			}
+			db.refPublicKey[fingerprint] = user
+		}
 	}
 	return db, nil
 }
@@ -212,33 +348,153 @@ func (db *Database) enforceDefaultPolicy() bool {
 		db.Policy.User.MaxLength = defaultPolicy.User.MaxLength
 		changes++
 	}
+	if db.Policy.APIKey.Prefix == "" {
+		db.Policy.APIKey.Prefix = defaultPolicy.APIKey.Prefix
+		changes++
+	}
+	if db.Policy.MfaToken.TOTPSkew == nil {
+		db.Policy.MfaToken.TOTPSkew = intPtr(*defaultPolicy.MfaToken.TOTPSkew)
+		changes++
+	}
+	if db.Policy.User.ReservedNames == nil {
+		db.Policy.User.ReservedNames = append([]string{}, defaultPolicy.User.ReservedNames...)
+		changes++
+	}
 	if changes > 0 {
 		return true
 	}
 	return false
 }
 
-func (db *Database) checkPolicyCompliance(username, password string) error {
+// SetAPIKeySecret sets the secret key of HMAC-SHA256 digests of API keys.
+// The secret must be kept outside of the database, so that the readers of
+// the database cannot verify guessed keys offline. The databases created by
+// earlier versions stored the secret in the "api_key_secret" field. The
+// secret must be moved from the field to a file, because the field is not
+// written back to the database.
+func (db *Database) SetAPIKeySecret(secret []byte) error {
+	if len(secret) < minAPIKeySecretLength {
+		return errors.ErrAPIKeySecretTooShort.WithArgs(minAPIKeySecretLength)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.APIKeySecret = append([]byte{}, secret...)
+	return nil
+}
+
+// LoadAPIKeySecret reads the secret key of HMAC-SHA256 digests of API keys
+// from a file and sets it. The contents of the file are used as is.
+func (db *Database) LoadAPIKeySecret(fp string) error {
+	b, err := utils.ReadFileBytes(fp)
+	if err != nil {
+		return errors.ErrAPIKeySecretLoad.WithArgs(fp, err)
+	}
+	return db.SetAPIKeySecret(b)
+}
+
+// getAPIKeySecret returns the secret key of API key digests.
+func (db *Database) getAPIKeySecret() ([]byte, error) {
+	if len(db.APIKeySecret) > 0 {
+		return db.APIKeySecret, nil
+	}
+	if db.legacyAPIKeySecret != "" {
+		return []byte(db.legacyAPIKeySecret), nil
+	}
+	return nil, errors.ErrAPIKeySecretNotFound
+}
+
+func (db *Database) checkPolicyCompliance(username, password string, userInputs ...string) error {
 	if err := db.checkUserPolicyCompliance(username); err != nil {
 		return err
 	}
-	if err := db.checkPasswordPolicyCompliance(password); err != nil {
+	if err := db.checkPasswordPolicyCompliance(password, userInputs...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPublicKeyPolicyCompliance returns an error if the public key violates
+// the public key policy of the database.
+func (db *Database) checkPublicKeyPolicyCompliance(k *PublicKey, now time.Time) error {
+	policy := db.Policy.PublicKey
+	keyType, rsaBits, createdAt, err := k.getKeyAttributes()
+	if err != nil {
 		return err
 	}
+	if len(policy.AllowedTypes) > 0 && !containsFold(policy.AllowedTypes, keyType) {
+		return errors.ErrPublicKeyPolicyType.WithArgs(keyType)
+	}
+	if len(policy.AllowedAlgorithms) > 0 && !containsFold(policy.AllowedAlgorithms, k.Type) {
+		return errors.ErrPublicKeyPolicyAlgorithm.WithArgs(k.Type)
+	}
+	if policy.MinRSABits > 0 && rsaBits > 0 && rsaBits < policy.MinRSABits {
+		return errors.ErrPublicKeyPolicyRSABits.WithArgs(rsaBits, policy.MinRSABits)
+	}
+	if policy.MaxAge > 0 && now.Sub(createdAt) > time.Duration(policy.MaxAge)*time.Second {
+		return errors.ErrPublicKeyPolicyMaxAge.WithArgs(createdAt, policy.MaxAge)
+	}
 	return nil
 }
 
+func containsFold(items []string, s string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
 func (db *Database) checkUserPolicyCompliance(s string) error {
 	if len(s) > db.Policy.User.MaxLength || len(s) < db.Policy.User.MinLength {
 		return errors.ErrUserPolicyCompliance
 	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= 'A' && c <= 'Z':
+			if !db.Policy.User.AllowUppercase {
+				return errors.ErrUserPolicyUppercase
+			}
+		case i == 0:
+			return errors.ErrUserPolicyStartChar
+		case c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.':
+			if !db.Policy.User.AllowNonAlphaNumeric {
+				return errors.ErrUserPolicyNonAlphaNumeric
+			}
+		default:
+			return errors.ErrUserPolicyInvalidChar.WithArgs(c)
+		}
+	}
+	skeleton := getUsernameSkeleton(s)
+	for _, name := range db.Policy.User.ReservedNames {
+		if strings.EqualFold(s, name) || skeleton == getUsernameSkeleton(name) {
+			return errors.ErrUserPolicyReserved.WithArgs(s)
+		}
+	}
+	return nil
+}
+
+// checkUsernameConfusable checks whether a username is visually confusable
+// with the username of another user.
+func (db *Database) checkUsernameConfusable(s string, user *User) error {
+	if existingUser, exists := db.refSkeleton[getUsernameSkeleton(s)]; exists && existingUser != user {
+		return errors.ErrUserPolicyConfusable.WithArgs(s, existingUser.Username)
+	}
 	return nil
 }
 
-func (db *Database) checkPasswordPolicyCompliance(s string) error {
+func (db *Database) checkPasswordPolicyCompliance(s string, userInputs ...string) error {
 	if len(s) > db.Policy.Password.MaxLength || len(s) < db.Policy.Password.MinLength {
 		return errors.ErrPasswordPolicyCompliance
 	}
+	if db.Policy.Password.MinScore > 0 {
+		ps := NewPasswordStrength(s, userInputs)
+		if ps.Score < db.Policy.Password.MinScore {
+			return errors.ErrPasswordPolicyMinScore.WithArgs(ps.Score, db.Policy.Password.MinScore)
+		}
+	}
 	return nil
 }
 
@@ -252,18 +508,25 @@ func (db *Database) AddUser(r *requests.Request) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	if err := db.checkPolicyCompliance(r.User.Username, r.User.Password); err != nil {
+	if err := db.checkPolicyCompliance(r.User.Username, r.User.Password, r.User.Username, r.User.Email, r.User.FullName); err != nil {
 		return errors.ErrAddUser.WithArgs(r.User.Username, err)
 	}
 
-	user, err := NewUserWithRoles(
-		r.User.Username, r.User.Password,
+	password, err := db.peppers.NewPassword(r.User.Password)
+	if err != nil {
+		return errors.ErrAddUser.WithArgs(r.User.Username, err)
+	}
+	user, err := newUserWithRoles(
+		r.User.Username, password,
 		r.User.Email, r.User.FullName,
 		r.User.Roles,
 	)
 	if err != nil {
 		return errors.ErrAddUser.WithArgs(r.User.Username, err)
 	}
+	if r.Flags.MustChangePassword && len(user.Passwords) > 0 {
+		user.Passwords[0].MustChange = true
+	}
 	for i := 0; i < 10; i++ {
 		id := NewID()
 		if _, exists := db.refID[id]; !exists {
@@ -275,6 +538,9 @@ func (db *Database) AddUser(r *requests.Request) error {
 	if _, exists := db.refUsername[username]; exists {
 		return errors.ErrAddUser.WithArgs(username, "username already in use")
 	}
+	if err := db.checkUsernameConfusable(username, nil); err != nil {
+		return errors.ErrAddUser.WithArgs(username, err)
+	}
 
 	emailAddresses := []string{}
 	for _, email := range user.EmailAddresses {
@@ -287,6 +553,7 @@ func (db *Database) AddUser(r *requests.Request) error {
 
 	db.refUsername[username] = user
 	db.refID[user.ID] = user
+	db.refSkeleton[getUsernameSkeleton(username)] = user
 	for _, emailAddress := range emailAddresses {
 		db.refEmailAddress[emailAddress] = user
 	}
@@ -298,6 +565,83 @@ func (db *Database) AddUser(r *requests.Request) error {
 	return nil
 }
 
+// AddServiceAccount adds a service account to the database. The account is
+// owned either by the user identified by the owner field of the request or by
+// the group in the owner group field. The roles of the account owned by a
+// user must be assigned to the user.
+func (db *Database) AddServiceAccount(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.checkUserPolicyCompliance(r.User.Username); err != nil {
+		return errors.ErrAddServiceAccount.WithArgs(r.User.Username, err)
+	}
+	owner, err := db.getServiceAccountOwner(r)
+	if err != nil {
+		return errors.ErrAddServiceAccount.WithArgs(r.User.Username, err)
+	}
+	user, err := NewServiceAccount(r.User.Username, owner, r.User.Roles)
+	if err != nil {
+		return errors.ErrAddServiceAccount.WithArgs(r.User.Username, err)
+	}
+	for i := 0; i < 10; i++ {
+		id := NewID()
+		if _, exists := db.refID[id]; !exists {
+			user.ID = id
+			break
+		}
+	}
+	username := strings.ToLower(user.Username)
+	if _, exists := db.refUsername[username]; exists {
+		return errors.ErrAddServiceAccount.WithArgs(username, "username already in use")
+	}
+	if err := db.checkUsernameConfusable(username, nil); err != nil {
+		return errors.ErrAddServiceAccount.WithArgs(username, err)
+	}
+
+	db.refUsername[username] = user
+	db.refID[user.ID] = user
+	db.refSkeleton[getUsernameSkeleton(username)] = user
+	db.Users = append(db.Users, user)
+
+	if err := db.commit(); err != nil {
+		return errors.ErrAddServiceAccount.WithArgs(username, err)
+	}
+	return nil
+}
+
+// getServiceAccountOwner returns the owner of a service account being added.
+func (db *Database) getServiceAccountOwner(r *requests.Request) (*ServiceAccountOwner, error) {
+	switch {
+	case r.User.Owner != "" && r.User.OwnerGroup != "":
+		return nil, errors.ErrServiceAccountOwnerAmbiguous
+	case r.User.OwnerGroup != "":
+		return &ServiceAccountOwner{
+			Type: ServiceAccountOwnerGroup,
+			Name: strings.TrimSpace(r.User.OwnerGroup),
+		}, nil
+	case r.User.Owner != "":
+		user, err := db.getUser(r.User.Owner)
+		if err != nil {
+			return nil, errors.ErrServiceAccountOwnerNotFound
+		}
+		if user.IsServiceAccount() {
+			return nil, errors.ErrServiceAccountOwnerInvalid.WithArgs(user.Username)
+		}
+		for _, role := range r.User.Roles {
+			if !user.HasRole(role) {
+				return nil, errors.ErrServiceAccountRoleNotAssigned.WithArgs(role, user.Username)
+			}
+		}
+		return &ServiceAccountOwner{
+			Type: ServiceAccountOwnerUser,
+			ID:   user.ID,
+			Name: user.Username,
+		}, nil
+	}
+	return nil, errors.ErrServiceAccountOwnerAmbiguous
+}
+
 // GetUsers return a list of user identities.
 func (db *Database) GetUsers(r *requests.Request) error {
 	db.mu.RLock()
@@ -349,8 +693,69 @@ func (db *Database) DeleteUser(r *requests.Request) error {
 	*/
 }
 
-// AuthenticateUser adds user identity to the database.
+// AddPasswordPepper adds a pepper, i.e. a secret applied to passwords prior
+// to hashing. The pepper must be kept outside of the database.
+func (db *Database) AddPasswordPepper(id string, secret []byte) error {
+	return db.peppers.Add(id, secret)
+}
+
+// LoadPasswordPepper reads a pepper from a file and adds it.
+func (db *Database) LoadPasswordPepper(id, fp string) error {
+	return db.peppers.Load(id, fp)
+}
+
+// SetActivePasswordPepper sets the pepper applied to new passwords. The
+// passwords hashed with previous peppers are rehashed with the active pepper
+// upon login. The empty id disables peppering of new passwords.
+func (db *Database) SetActivePasswordPepper(id string) error {
+	return db.peppers.SetActive(id)
+}
+
+// GetActivePasswordPepperID returns the id of the pepper applied to new
+// passwords.
+func (db *Database) GetActivePasswordPepperID() string {
+	return db.peppers.GetActiveID()
+}
+
+// RemovePasswordPepper removes a pepper. The passwords hashed with the pepper
+// no longer match.
+func (db *Database) RemovePasswordPepper(id string) {
+	db.peppers.Remove(id)
+}
+
+// AuthenticateUser adds user identity to the database. The password stored
+// with a pepper other than the active one is rehashed with the active pepper.
 func (db *Database) AuthenticateUser(r *requests.Request) error {
+	user, password, err := db.authenticateUser(r)
+	if err != nil {
+		return err
+	}
+	if password == nil || password.PepperID == db.peppers.GetActiveID() {
+		return nil
+	}
+	return db.rehashPassword(user, password, r.User.Password)
+}
+
+func (db *Database) rehashPassword(user *User, password *Password, s string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if password.Disabled {
+		// The password was changed after the authentication.
+		return nil
+	}
+	if err := db.peppers.Rehash(password, s); err != nil {
+		return errors.ErrRehashPassword.WithArgs(err)
+	}
+	user.Revise()
+	if err := db.commit(); err != nil {
+		return errors.ErrRehashPassword.WithArgs(err)
+	}
+	return nil
+}
+
+// authenticateUser authenticates a user. It returns the password of the
+// user, if the user is authenticated with a password.
+func (db *Database) authenticateUser(r *requests.Request) (*User, *Password, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	user, err := db.getUser(r.User.Username)
@@ -358,27 +763,52 @@ func (db *Database) AuthenticateUser(r *requests.Request) error {
 		r.Response.Code = 400
 		// Calculate password hash as the means to prevent user discovery.
 		NewPassword(r.User.Password)
-		return errors.ErrAuthFailed.WithArgs(err)
+		return nil, nil, errors.ErrAuthFailed.WithArgs(err)
 	}
-
 	switch {
 	case r.User.Password != "":
-		if err := user.VerifyPassword(r.User.Password); err != nil {
+		if user.IsServiceAccount() {
+			r.Response.Code = 400
+			NewPassword(r.User.Password)
+			return nil, nil, errors.ErrAuthFailed.WithArgs(errors.ErrServiceAccountInteractiveLogin.WithArgs(user.Username))
+		}
+		password, err := user.verifyPassword(r.User.Password, db.peppers)
+		if err != nil {
 			r.Response.Code = 400
-			return errors.ErrAuthFailed.WithArgs(err)
+			return nil, nil, errors.ErrAuthFailed.WithArgs(err)
+		}
+		if user.mustChangePassword() {
+			r.Flags.MustChangePassword = true
 		}
+		r.Response.Code = 200
+		return user, password, nil
 	case r.WebAuthn.Request != "":
+		if user.IsServiceAccount() {
+			r.Response.Code = 400
+			return nil, nil, errors.ErrAuthFailed.WithArgs(errors.ErrServiceAccountInteractiveLogin.WithArgs(user.Username))
+		}
 		if err := user.VerifyWebAuthnRequest(r); err != nil {
 			r.Response.Code = 400
-			return errors.ErrAuthFailed.WithArgs(err)
+			return nil, nil, errors.ErrAuthFailed.WithArgs(err)
 		}
+	case r.Signature.Payload != "":
+		if err := db.consumeSSHChallenge(user, string(r.Signature.Data)); err != nil {
+			r.Response.Code = 400
+			return nil, nil, errors.ErrAuthFailed.WithArgs(err)
+		}
+		key, err := user.VerifySSHChallengeResponse(r.Signature.Data, r.Signature.Payload)
+		if err != nil {
+			r.Response.Code = 400
+			return nil, nil, errors.ErrAuthFailed.WithArgs(err)
+		}
+		r.Key.ID = key.ID
 	default:
 		r.Response.Code = 400
-		return errors.ErrAuthFailed.WithArgs("malformed auth request")
+		return nil, nil, errors.ErrAuthFailed.WithArgs("malformed auth request")
 	}
 
 	r.Response.Code = 200
-	return nil
+	return user, nil, nil
 }
 
 // getUser return User by either email address or username.
@@ -433,11 +863,12 @@ func (db *Database) GetUserCount() int {
 	return len(db.Users)
 }
 
-// Save saves the database.
+// Save saves the database, together with the recorded usage of API keys.
+// It should be called on shutdown, so that the buffered usage is not lost.
 func (db *Database) Save() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.commit()
+	return db.flushAPIKeyUsage(true)
 }
 
 // Copy copies the database to another file.
@@ -453,6 +884,7 @@ func (db *Database) Copy(fp string) error {
 
 // commit writes the database contents to a file.
 func (db *Database) commit() error {
+	db.applyAPIKeyUsage()
 	db.Revision++
 	db.LastModified = time.Now().UTC()
 	data, err := json.MarshalIndent(db, "", "  ")
@@ -470,6 +902,10 @@ func (db *Database) validateUserIdentity(username, email string) (*User, error)
 	if err != nil {
 		return nil, err
 	}
+	if user1.IsServiceAccount() && email == "" {
+		// The service accounts have no email addresses.
+		return user1, nil
+	}
 	user2, err := db.getUserByEmailAddress(email)
 	if err != nil {
 		return nil, err
@@ -488,9 +924,21 @@ func (db *Database) AddPublicKey(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
 	}
-	if err := user.AddPublicKey(r); err != nil {
+	key, err := NewPublicKey(r)
+	if err != nil {
+		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
+	}
+	if err := db.checkPublicKeyPolicyCompliance(key, time.Now().UTC()); err != nil {
+		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
+	}
+	fingerprint := normalizePublicKeyFingerprint(key.Fingerprint)
+	if existingUser, exists := db.refPublicKey[fingerprint]; exists && existingUser != user {
+		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, errors.ErrPublicKeyRegistered.WithArgs(key.Fingerprint))
+	}
+	if err := user.addPublicKey(r, key); err != nil {
 		return err
 	}
+	db.refPublicKey[fingerprint] = user
 	if err := db.commit(); err != nil {
 		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
 	}
@@ -510,7 +958,7 @@ func (db *Database) GetPublicKeys(r *requests.Request) error {
 		if k.Usage != r.Key.Usage {
 			continue
 		}
-		if k.Disabled {
+		if k.Disabled && !r.Flags.IncludeDisabled {
 			continue
 		}
 		bundle.Add(k)
@@ -527,164 +975,1018 @@ func (db *Database) DeletePublicKey(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrDeletePublicKey.WithArgs(r.Key.ID, err)
 	}
+	key := user.getPublicKey(r.Key.ID)
 	if err := user.DeletePublicKey(r); err != nil {
 		return err
 	}
+	if fingerprint := normalizePublicKeyFingerprint(key.Fingerprint); db.refPublicKey[fingerprint] == user {
+		if _, k := db.lookupPublicKey(fingerprint); k == nil {
+			delete(db.refPublicKey, fingerprint)
+		}
+	}
 	if err := db.commit(); err != nil {
 		return errors.ErrDeletePublicKey.WithArgs(r.Key.Usage, err)
 	}
 	return nil
 }
 
-// AddAPIKey adds API key for a user.
-func (db *Database) AddAPIKey(r *requests.Request) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
-	if err != nil {
-		return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
-	}
-	s := GetRandomStringFromRange(72, 96)
-	failCount := 0
-	for {
-		hk, err := NewPassword(s)
-		if err != nil {
-			if failCount > 10 {
-				return err
-			}
-			failCount++
-			continue
-		}
-		keyPrefix := string(s[:24])
-		if _, exists := db.refAPIKey[keyPrefix]; exists {
-			continue
-		}
-		r.Response.Payload = s
-		r.Key.Payload = hk.Hash
-		r.Key.Prefix = keyPrefix
-		if err := user.AddAPIKey(r); err != nil {
+// DisablePublicKey disables a public key associated with a user by key id.
+// The disabled key is kept and can be re-enabled with EnablePublicKey.
+func (db *Database) DisablePublicKey(r *requests.Request) error {
+	return db.updatePublicKey(r, errors.ErrDisablePublicKey, func(k *PublicKey) error {
+		k.Suspend()
+		return nil
+	})
+}
+
+// EnablePublicKey re-enables a public key associated with a user by key id.
+func (db *Database) EnablePublicKey(r *requests.Request) error {
+	return db.updatePublicKey(r, errors.ErrEnablePublicKey, func(k *PublicKey) error {
+		if err := db.checkPublicKeyPolicyCompliance(k, time.Now().UTC()); err != nil {
 			return err
 		}
-		db.refAPIKey[keyPrefix] = user
-		break
-	}
+		return k.Enable()
+	})
+}
 
-	if err := db.commit(); err != nil {
-		return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
-	}
-	return nil
+// UpdatePublicKey changes the comment of a public key associated with a
+// user by key id.
+func (db *Database) UpdatePublicKey(r *requests.Request) error {
+	return db.updatePublicKey(r, errors.ErrUpdatePublicKey, func(k *PublicKey) error {
+		k.SetComment(r.Key.Comment)
+		return nil
+	})
 }
 
-// DeleteAPIKey deletes an API key associated with a user by key id.
-func (db *Database) DeleteAPIKey(r *requests.Request) error {
+func (db *Database) updatePublicKey(r *requests.Request, e errors.StandardError, f func(*PublicKey) error) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
 	if err != nil {
-		return errors.ErrDeleteAPIKey.WithArgs(r.Key.ID, err)
+		return e.WithArgs(r.Key.ID, err)
 	}
-	if err := user.DeleteAPIKey(r); err != nil {
-		return err
+	key := user.getPublicKey(r.Key.ID)
+	if key == nil {
+		return e.WithArgs(r.Key.ID, "not found")
 	}
-	delete(db.refAPIKey, r.Key.Prefix)
+	if err := f(key); err != nil {
+		return e.WithArgs(r.Key.ID, err)
+	}
+	user.Revise()
 	if err := db.commit(); err != nil {
-		return errors.ErrDeleteAPIKey.WithArgs(r.Key.Usage, err)
+		return e.WithArgs(r.Key.ID, err)
 	}
 	return nil
 }
 
-// GetAPIKeys returns a list of API keys associated with a user.
-func (db *Database) GetAPIKeys(r *requests.Request) error {
+// SetPublicKeyOptions sets the options of the authorized_keys entry of an
+// SSH key associated with a user by key id, e.g. from="10.0.0.0/8".
+func (db *Database) SetPublicKeyOptions(r *requests.Request) error {
+	return db.updatePublicKey(r, errors.ErrUpdatePublicKey, func(k *PublicKey) error {
+		if k.Usage != "ssh" {
+			return errors.ErrPublicKeyUsagePayloadMismatch.WithArgs(k.Usage)
+		}
+		return k.SetOptions(r.Key.Options)
+	})
+}
+
+// GetAuthorizedKeys returns the enabled SSH keys of a user in authorized_keys
+// format, e.g. for AuthorizedKeysCommand of sshd. The user is identified by
+// username only, because sshd does not provide email address.
+func (db *Database) GetAuthorizedKeys(r *requests.Request) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	user, err := db.getUserByUsername(r.User.Username)
 	if err != nil {
-		return errors.ErrGetAPIKeys.WithArgs(r.Key.Usage, err)
+		return errors.ErrGetAuthorizedKeys.WithArgs(r.User.Username, err)
 	}
-	bundle := NewAPIKeyBundle()
-	for _, k := range user.APIKeys {
-		if k.Usage != r.Key.Usage {
+	var sb strings.Builder
+	for _, k := range user.PublicKeys {
+		if !k.isAuthorized() {
 			continue
 		}
-		if k.Disabled {
+		entry, err := k.GetAuthorizedKey()
+		if err != nil {
+			// The malformed key must not prevent the use of the other keys.
 			continue
 		}
-		bundle.Add(k)
+		sb.WriteString(entry + "\n")
 	}
-	r.Response.Payload = bundle
+	r.Response.Payload = sb.String()
 	return nil
 }
 
-// ChangeUserPassword change user password.
-func (db *Database) ChangeUserPassword(r *requests.Request) error {
+// SetSSHCertificateAuthority sets the certificate authority issuing SSH
+// certificates for the public keys of the users in the database.
+func (db *Database) SetSSHCertificateAuthority(ca *SSHCertificateAuthority) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.sshCA = ca
+}
+
+// IssueSSHCertificate issues OpenSSH user certificate for the SSH public key
+// of a user by key id. The certificate is returned in authorized keys format.
+func (db *Database) IssueSSHCertificate(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.sshCA == nil {
+		return errors.ErrIssueSSHCertificate.WithArgs(r.Key.ID, errors.ErrSSHCertificateAuthorityNotConfigured)
+	}
 	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
 	if err != nil {
-		return errors.ErrChangeUserPassword.WithArgs(err)
-	}
-	if err := db.checkPasswordPolicyCompliance(r.User.Password); err != nil {
-		return errors.ErrChangeUserPassword.WithArgs(err)
+		return errors.ErrIssueSSHCertificate.WithArgs(r.Key.ID, err)
 	}
-	if err := user.ChangePassword(r, db.Policy.Password.KeepVersions); err != nil {
-		return err
+	key := user.getPublicKey(r.Key.ID)
+	if key == nil {
+		return errors.ErrIssueSSHCertificate.WithArgs(r.Key.ID, "not found")
 	}
-	// if db.Policy.Password.KeepVersions
-	if err := db.commit(); err != nil {
-		return errors.ErrChangeUserPassword.WithArgs(err)
+	cert, err := db.sshCA.IssueUserCertificate(user, key, r)
+	if err != nil {
+		return errors.ErrIssueSSHCertificate.WithArgs(r.Key.ID, err)
 	}
+	r.Response.Payload = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert)))
 	return nil
 }
 
-// IdentifyUser returns user identity and a list of challenges that should be
-// satisfied prior to successfully authenticating a user.
-func (db *Database) IdentifyUser(r *requests.Request) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	user, err := db.getUser(r.User.Username)
+// VerifyPGPSignature verifies a detached armored PGP signature of the data in
+// the request with the gpg public keys of a user. The verified signature is
+// returned in the response payload.
+func (db *Database) VerifyPGPSignature(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
 	if err != nil {
-		r.User.Username = "nobody"
-		r.User.Email = "nobody@localhost"
-		r.User.Challenges = []string{"password"}
-		return nil
+		return errors.ErrVerifySignature.WithArgs("gpg", err)
 	}
-	if r.Flags.Enabled {
-		user.GetFlags(r)
+	signature, err := user.VerifyPGPSignature(r.Signature.Data, r.Signature.Payload)
+	if err != nil {
+		return errors.ErrVerifySignature.WithArgs("gpg", err)
 	}
-	r.User.Username = user.Username
-	r.User.Email = user.GetMailClaim()
-	r.User.FullName = user.GetNameClaim()
-	r.User.Roles = user.GetRolesClaim()
-	r.User.Challenges = user.GetChallenges()
-	r.Response.Code = 200
+	r.Response.Payload = signature
 	return nil
 }
 
-// LookupAPIKey returns username and email associated with the provided API
-// key.
-func (db *Database) LookupAPIKey(r *requests.Request) error {
-	if r.Key.Payload == "" {
-		return errors.ErrLookupAPIKeyPayloadEmpty
+// VerifySSHSignature verifies an armored OpenSSH signature of the data in the
+// request with the ssh public keys of a user. The verified signature is
+// returned in the response payload.
+func (db *Database) VerifySSHSignature(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrVerifySignature.WithArgs("ssh", err)
+	}
+	signature, err := user.VerifySSHSignature(r.Signature.Data, r.Signature.Payload, r.Signature.Namespace)
+	if err != nil {
+		return errors.ErrVerifySignature.WithArgs("ssh", err)
+	}
+	r.Response.Payload = signature
+	return nil
+}
+
+// GetAllowedSigners returns the ssh public keys of the users in the database
+// in allowed_signers format, i.e. the format of the file verifying the SSH
+// signatures of git commits. The namespaces of the entries are limited to the
+// namespace in the request, when provided.
+func (db *Database) GetAllowedSigners(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if err := validateAllowedSignersNamespaces(r.Signature.Namespace); err != nil {
+		return errors.ErrGetAllowedSigners.WithArgs(err)
+	}
+	var sb strings.Builder
+	for _, user := range db.Users {
+		entries, err := user.GetAllowedSigners(r.Signature.Namespace)
+		if err != nil {
+			return errors.ErrGetAllowedSigners.WithArgs(err)
+		}
+		for _, entry := range entries {
+			sb.WriteString(entry + "\n")
+		}
+	}
+	r.Response.Payload = sb.String()
+	return nil
+}
+
+// IssueSSHChallenge issues a nonce for SSH challenge-response authentication
+// of a user. The challenge is returned in the response payload, and the user
+// signs the data returned by its SignedData method. The nonce is issued for
+// the usernames not in the database too, to prevent user discovery. The
+// number of outstanding nonces is limited per username and overall.
+func (db *Database) IssueSSHChallenge(r *requests.Request) error {
+	if r.User.Username == "" {
+		return errors.ErrIssueSSHChallenge.WithArgs(errors.ErrDatabaseUserNotFound)
+	}
+	username := strings.ToLower(r.User.Username)
+	db.mu.RLock()
+	if user, err := db.getUser(r.User.Username); err == nil {
+		// The nonce issued for the email address of a user is consumed
+		// by the user.
+		username = strings.ToLower(user.Username)
+	}
+	db.mu.RUnlock()
+
+	now := time.Now().UTC()
+	db.challengeMu.Lock()
+	defer db.challengeMu.Unlock()
+	db.expireSSHChallenges(now)
+	if len(db.sshChallengeQueue) >= maxSSHChallenges {
+		return errors.ErrIssueSSHChallenge.WithArgs(errors.ErrSSHChallengeLimit)
+	}
+	if db.sshChallengeCounts[username] >= maxSSHChallengesPerUser {
+		return errors.ErrIssueSSHChallenge.WithArgs(errors.ErrSSHChallengeLimit)
+	}
+	nonce, err := GenerateRandomString(64)
+	if err != nil {
+		return errors.ErrIssueSSHChallenge.WithArgs(err)
+	}
+	challenge := &SSHChallenge{
+		Nonce:     nonce,
+		ExpiresAt: now.Add(sshChallengeLifetime),
+		username:  username,
+	}
+	db.sshChallenges[challenge.Nonce] = challenge
+	db.sshChallengeQueue = append(db.sshChallengeQueue, challenge)
+	db.sshChallengeCounts[username]++
+	r.Response.Payload = challenge
+	return nil
+}
+
+// expireSSHChallenges removes the expired nonces. The nonces expire in the
+// order they were issued, so only the expired head of the queue is visited.
+// The queue keeps the consumed nonces until they expire. The function is
+// called under the challenge lock.
+func (db *Database) expireSSHChallenges(now time.Time) {
+	var i int
+	for i < len(db.sshChallengeQueue) && now.After(db.sshChallengeQueue[i].ExpiresAt) {
+		challenge := db.sshChallengeQueue[i]
+		if _, exists := db.sshChallenges[challenge.Nonce]; exists {
+			db.removeSSHChallenge(challenge)
+		}
+		db.sshChallengeQueue[i] = nil
+		i++
+	}
+	db.sshChallengeQueue = db.sshChallengeQueue[i:]
+}
+
+// removeSSHChallenge removes an outstanding nonce. The function is called
+// under the challenge lock.
+func (db *Database) removeSSHChallenge(challenge *SSHChallenge) {
+	delete(db.sshChallenges, challenge.Nonce)
+	db.sshChallengeCounts[challenge.username]--
+	if db.sshChallengeCounts[challenge.username] <= 0 {
+		delete(db.sshChallengeCounts, challenge.username)
+	}
+}
+
+// consumeSSHChallenge removes the nonce issued to a user. It returns an error
+// when the nonce was not issued to the user, or when it expired.
+func (db *Database) consumeSSHChallenge(user *User, nonce string) error {
+	db.challengeMu.Lock()
+	defer db.challengeMu.Unlock()
+	challenge, exists := db.sshChallenges[nonce]
+	if !exists || challenge.username != strings.ToLower(user.Username) {
+		return errors.ErrSSHChallengeNotFound
+	}
+	db.removeSSHChallenge(challenge)
+	if time.Now().UTC().After(challenge.ExpiresAt) {
+		return errors.ErrSSHChallengeExpired
+	}
+	return nil
+}
+
+// SetX509CertificateAuthorities sets the certificate authorities verifying
+// the chains of X.509 client certificates looked up in the database.
+func (db *Database) SetX509CertificateAuthorities(pool *x509.CertPool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.x509Pool = pool
+}
+
+// LookupX509Certificate returns username and email associated with the X.509
+// client certificate, e.g. presented in mTLS handshake, or with the SHA-256
+// fingerprint of its subject public key info. The presented certificate, or
+// else the registered one, must be valid and, when the certificate
+// authorities are set, chain to one of them. The key is returned in the
+// response payload. The registration past the expiry of the registered
+// certificate is accepted only with the presented certificate of the same
+// key, i.e. a renewed one, which chains to the certificate authorities and
+// has the registered issuer.
+func (db *Database) LookupX509Certificate(r *requests.Request) error {
+	var cert *x509.Certificate
+	fingerprint := normalizePublicKeyFingerprint(r.Key.Fingerprint)
+	if r.Key.Payload != "" {
+		var err error
+		cert, err = parseX509Certificate(r.Key.Payload)
+		if err != nil {
+			return errors.ErrLookupX509Certificate.WithArgs(err)
+		}
+		fingerprint = getX509CertificateFingerprint(cert)
+	}
+	if fingerprint == "" {
+		return errors.ErrLookupX509CertificateEmptyPayload
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	user, key := db.lookupPublicKey(fingerprint)
+	if key == nil || key.Usage != "x509" || key.Disabled || key.Expired {
+		return errors.ErrLookupX509Certificate.WithArgs("not found")
+	}
+	if !key.ExpiredAt.IsZero() && time.Now().After(key.ExpiredAt) {
+		if cert == nil || db.x509Pool == nil || cert.Issuer.String() != key.Issuer {
+			return errors.ErrLookupX509Certificate.WithArgs(errors.ErrPublicKeyExpired.WithArgs(key.Fingerprint, key.ExpiredAt))
+		}
+	}
+	if cert == nil {
+		var err error
+		cert, err = parseX509Certificate(key.Payload)
+		if err != nil {
+			return errors.ErrLookupX509Certificate.WithArgs(err)
+		}
+	}
+	if err := verifyX509Certificate(cert, db.x509Pool, time.Now()); err != nil {
+		return errors.ErrLookupX509Certificate.WithArgs(err)
+	}
+	r.User.Username = user.Username
+	r.User.Email = user.GetMailClaim()
+	r.Key.ID = key.ID
+	r.Key.Fingerprint = key.Fingerprint
+	r.Response.Code = 200
+	r.Response.Payload = key
+	return nil
+}
+
+// LookupPublicKey returns username and email associated with the public key,
+// e.g. SSH or GPG, by its payload or fingerprint. The key is returned in the
+// response payload. The payload requires the usage of the key.
+func (db *Database) LookupPublicKey(r *requests.Request) error {
+	fingerprint := normalizePublicKeyFingerprint(r.Key.Fingerprint)
+	if r.Key.Payload != "" {
+		key, err := NewPublicKey(r)
+		if err != nil {
+			return errors.ErrLookupPublicKey.WithArgs(err)
+		}
+		fingerprint = normalizePublicKeyFingerprint(key.Fingerprint)
+	}
+	if fingerprint == "" {
+		return errors.ErrLookupPublicKeyEmptyPayload
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	user, key := db.lookupPublicKey(fingerprint)
+	if key == nil {
+		return errors.ErrLookupPublicKey.WithArgs("not found")
+	}
+	r.User.Username = user.Username
+	r.User.Email = user.GetMailClaim()
+	r.Key.ID = key.ID
+	r.Key.Usage = key.Usage
+	r.Key.Fingerprint = key.Fingerprint
+	r.Key.Disabled = key.Disabled
+	r.Response.Code = 200
+	r.Response.Payload = key
+	return nil
+}
+
+// lookupPublicKey returns the user and the public key by the normalized
+// fingerprint of the key. When the user has several keys with the same
+// fingerprint, e.g. renewed X.509 certificates, the enabled key expiring
+// last is returned.
+func (db *Database) lookupPublicKey(fingerprint string) (*User, *PublicKey) {
+	user, exists := db.refPublicKey[fingerprint]
+	if !exists {
+		return nil, nil
+	}
+	var key *PublicKey
+	for _, k := range user.PublicKeys {
+		if normalizePublicKeyFingerprint(k.Fingerprint) != fingerprint {
+			continue
+		}
+		if key == nil || isPreferredPublicKey(k, key) {
+			key = k
+		}
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return user, key
+}
+
+// isPreferredPublicKey returns true when the public key a is preferred to
+// the public key b having the same fingerprint.
+func isPreferredPublicKey(a, b *PublicKey) bool {
+	aEnabled, bEnabled := !a.Disabled && !a.Expired, !b.Disabled && !b.Expired
+	if aEnabled != bEnabled {
+		return aEnabled
+	}
+	if a.ExpiredAt.IsZero() || b.ExpiredAt.IsZero() {
+		return a.ExpiredAt.IsZero() && !b.ExpiredAt.IsZero()
+	}
+	return a.ExpiredAt.After(b.ExpiredAt)
+}
+
+// AddAPIKey adds API key for a user.
+func (db *Database) AddAPIKey(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
+	}
+	if err := db.addAPIKey(user, r); err != nil {
+		return err
+	}
+	if err := db.commit(); err != nil {
+		return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
+	}
+	return nil
+}
+
+// addAPIKey generates API key and adds it to a user. The generated key is
+// returned in the response payload.
+func (db *Database) addAPIKey(user *User, r *requests.Request) error {
+	if db.Policy.APIKey.MaxLifetime > 0 {
+		if r.Key.TTL > db.Policy.APIKey.MaxLifetime {
+			return errors.ErrAddAPIKey.WithArgs(r.Key.Usage,
+				errors.ErrAPIKeyPolicyMaxLifetime.WithArgs(r.Key.TTL, db.Policy.APIKey.MaxLifetime),
+			)
+		}
+		if r.Key.TTL == 0 {
+			r.Key.TTL = db.Policy.APIKey.MaxLifetime
+		}
+	}
+	// Without the secret, the keys are hashed with bcrypt. The keys are
+	// migrated to HMAC-SHA256 digests once the secret is loaded.
+	secret, _ := db.getAPIKeySecret()
+	failCount := 0
+	for {
+		id, err := GenerateRandomString(apikey.IDLength)
+		if err != nil {
+			return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
+		}
+		keySecret, err := GenerateRandomString(apikey.SecretLength)
+		if err != nil {
+			return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
+		}
+		k, err := apikey.NewKey(db.Policy.APIKey.Prefix, id, keySecret)
+		if err != nil {
+			return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
+		}
+		keyPrefix := k.Identifier()
+		if _, exists := db.refAPIKey[keyPrefix]; exists {
+			if failCount > 10 {
+				return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, "failed generating unique key prefix")
+			}
+			failCount++
+			continue
+		}
+		s := k.String()
+		r.Response.Payload = s
+		r.Key.ID = k.ID
+		if secret != nil {
+			r.Key.Payload = getAPIKeyDigest(secret, s)
+			r.Key.Algorithm = apiKeyAlgorithmHMAC
+		} else {
+			hk, err := NewPasswordWithOptions(s, "generic", "bcrypt", map[string]interface{}{"pepper_id": ""})
+			if err != nil {
+				return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
+			}
+			r.Key.Payload = hk.Hash
+			r.Key.Algorithm = apiKeyAlgorithmBcrypt
+		}
+		r.Key.Prefix = keyPrefix
+		if err := user.AddAPIKey(r); err != nil {
+			return err
+		}
+		db.refAPIKey[keyPrefix] = user
+		break
+	}
+	return nil
+}
+
+// RotateAPIKey issues a replacement of an API key associated with a user by
+// key id. The replacement inherits the usage, comment, scopes, roles, and
+// network restrictions of the rotated key. The rotated key remains valid for the grace period.
+func (db *Database) RotateAPIKey(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrRotateAPIKey.WithArgs(r.Key.ID, err)
+	}
+	key := user.getAPIKey(r.Key.ID)
+	if key == nil {
+		return errors.ErrRotateAPIKey.WithArgs(r.Key.ID, "not found")
+	}
+	if !key.IsValid() {
+		return errors.ErrRotateAPIKey.WithArgs(r.Key.ID, "disabled or expired")
+	}
+	gracePeriod := r.Key.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = db.Policy.APIKey.GracePeriod
+	}
+	req := &requests.Request{
+		Key: requests.Key{
+			Usage:           key.Usage,
+			Comment:         key.Comment,
+			Scopes:          key.Scopes,
+			Roles:           key.Roles,
+			AllowedNetworks: key.AllowedNetworks,
+			AllowedMethods:  key.AllowedMethods,
+			TTL:             r.Key.TTL,
+		},
+	}
+	if req.Key.TTL == 0 && !key.ExpiredAt.IsZero() {
+		req.Key.TTL = int(key.ExpiredAt.Sub(key.CreatedAt).Seconds())
+	}
+	if err := db.addAPIKey(user, req); err != nil {
+		return errors.ErrRotateAPIKey.WithArgs(r.Key.ID, err)
+	}
+	key.Rotate(time.Duration(gracePeriod) * time.Second)
+	if err := db.commit(); err != nil {
+		return errors.ErrRotateAPIKey.WithArgs(r.Key.ID, err)
+	}
+	r.Key.ID = req.Key.ID
+	r.Key.Prefix = req.Key.Prefix
+	r.Response.Payload = req.Response.Payload
+	return nil
+}
+
+// DeleteAPIKey deletes an API key associated with a user by key id.
+func (db *Database) DeleteAPIKey(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrDeleteAPIKey.WithArgs(r.Key.ID, err)
+	}
+	if err := user.DeleteAPIKey(r); err != nil {
+		return err
+	}
+	delete(db.refAPIKey, r.Key.Prefix)
+	if err := db.commit(); err != nil {
+		return errors.ErrDeleteAPIKey.WithArgs(r.Key.Usage, err)
+	}
+	return nil
+}
+
+// GetAPIKeys returns a list of API keys associated with a user.
+func (db *Database) GetAPIKeys(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrGetAPIKeys.WithArgs(r.Key.Usage, err)
+	}
+	bundle := NewAPIKeyBundle()
+	for _, k := range user.APIKeys {
+		if k.Usage != r.Key.Usage {
+			continue
+		}
+		if k.Disabled && !r.Flags.IncludeDisabled {
+			continue
+		}
+		bundle.Add(k)
+	}
+	r.Response.Payload = bundle
+	return nil
+}
+
+// DisableAPIKey disables an API key associated with a user by key id. The
+// disabled key is kept and can be re-enabled with EnableAPIKey.
+func (db *Database) DisableAPIKey(r *requests.Request) error {
+	return db.updateAPIKey(r, errors.ErrDisableAPIKey, func(k *APIKey) error {
+		k.Suspend()
+		return nil
+	})
+}
+
+// EnableAPIKey re-enables an API key associated with a user by key id.
+func (db *Database) EnableAPIKey(r *requests.Request) error {
+	return db.updateAPIKey(r, errors.ErrEnableAPIKey, func(k *APIKey) error {
+		return k.Enable()
+	})
+}
+
+// UpdateAPIKey changes the comment of an API key associated with a user by
+// key id.
+func (db *Database) UpdateAPIKey(r *requests.Request) error {
+	return db.updateAPIKey(r, errors.ErrUpdateAPIKey, func(k *APIKey) error {
+		if r.Key.Comment == "" {
+			return errors.ErrAPIKeyCommentEmpty
+		}
+		k.SetComment(r.Key.Comment)
+		return nil
+	})
+}
+
+func (db *Database) updateAPIKey(r *requests.Request, e errors.StandardError, f func(*APIKey) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return e.WithArgs(r.Key.ID, err)
+	}
+	key := user.getAPIKey(r.Key.ID)
+	if key == nil {
+		return e.WithArgs(r.Key.ID, "not found")
+	}
+	if err := f(key); err != nil {
+		return e.WithArgs(r.Key.ID, err)
+	}
+	user.Revise()
+	if err := db.commit(); err != nil {
+		return e.WithArgs(r.Key.ID, err)
 	}
-	if len(r.Key.Payload) < 72 {
-		return errors.ErrLookupAPIKeyMalformedPayload
+	return nil
+}
+
+// ChangeUserPassword change user password.
+func (db *Database) ChangeUserPassword(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return errors.ErrChangeUserPassword.WithArgs(err)
+	}
+	if err := db.checkPasswordPolicyCompliance(r.User.Password, user.getPasswordStrengthInputs()...); err != nil {
+		return errors.ErrChangeUserPassword.WithArgs(err)
+	}
+	if err := user.changePassword(r, db.Policy.Password.KeepVersions, db.peppers); err != nil {
+		return err
 	}
-	r.Key.Prefix = string(r.Key.Payload[:24])
+	// if db.Policy.Password.KeepVersions
+	if err := db.commit(); err != nil {
+		return errors.ErrChangeUserPassword.WithArgs(err)
+	}
+	return nil
+}
+
+// ChangeUsername changes the username of a user. The user is identified by
+// the old username and email address.
+func (db *Database) ChangeUsername(r *requests.Request) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.OldUsername, r.User.Email)
+	if err != nil {
+		return errors.ErrChangeUsername.WithArgs(err)
+	}
+	if err := db.checkUserPolicyCompliance(r.User.Username); err != nil {
+		return errors.ErrChangeUsername.WithArgs(err)
+	}
+	username := strings.ToLower(r.User.Username)
+	if existingUser, exists := db.refUsername[username]; exists && existingUser != user {
+		return errors.ErrChangeUsername.WithArgs("username already in use")
+	}
+	if err := db.checkUsernameConfusable(username, user); err != nil {
+		return errors.ErrChangeUsername.WithArgs(err)
+	}
+	oldUsername := strings.ToLower(user.Username)
+	delete(db.refUsername, oldUsername)
+	if db.refSkeleton[getUsernameSkeleton(oldUsername)] == user {
+		delete(db.refSkeleton, getUsernameSkeleton(oldUsername))
+	}
+	user.Username = r.User.Username
+	user.Revise()
+	db.refUsername[username] = user
+	db.refSkeleton[getUsernameSkeleton(username)] = user
+	for _, account := range db.Users {
+		if account.Owner == nil || account.Owner.Type != ServiceAccountOwnerUser {
+			continue
+		}
+		if account.Owner.ID == user.ID {
+			account.Owner.Name = user.Username
+		}
+	}
+	if err := db.commit(); err != nil {
+		return errors.ErrChangeUsername.WithArgs(err)
+	}
+	return nil
+}
+
+// IdentifyUser returns user identity and a list of challenges that should be
+// satisfied prior to successfully authenticating a user.
+func (db *Database) IdentifyUser(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.getUser(r.User.Username)
+	if err != nil || user.IsServiceAccount() {
+		r.User.Username = "nobody"
+		r.User.Email = "nobody@localhost"
+		r.User.Challenges = []string{"password"}
+		return nil
+	}
+	if r.Flags.Enabled {
+		user.GetFlags(r)
+	}
+	r.User.Username = user.Username
+	r.User.Email = user.GetMailClaim()
+	r.User.FullName = user.GetNameClaim()
+	r.User.Roles = user.GetRolesClaim()
+	r.User.Challenges = user.GetChallenges()
+	r.Response.Code = 200
+	return nil
+}
+
+// LookupAPIKey returns username and email associated with the provided API
+// key, together with the scopes of the key and the roles granted to it.
+//
+// The keys stored as HMAC-SHA256 digests are verified under the read lock.
+// The legacy keys hashed with bcrypt are verified under the write lock and
+// migrated to HMAC-SHA256 digests upon the first successful lookup. When the
+// API key secret is not loaded, the keys hashed with bcrypt are verified
+// under the read lock and are not migrated.
+func (db *Database) LookupAPIKey(r *requests.Request) error {
+	if r.Key.Payload == "" {
+		return errors.ErrLookupAPIKeyPayloadEmpty
+	}
+	keyPrefix, err := getAPIKeyPrefix(r.Key.Payload)
+	if err != nil {
+		return err
+	}
+	r.Key.Prefix = keyPrefix
+	var legacy bool
+	var key *APIKey
+	db.mu.RLock()
+	secret, secretErr := db.getAPIKeySecret()
+	user, err := db.lookupAPIKey(r, func(k *APIKey) bool {
+		key = k
+		if k.Algorithm != apiKeyAlgorithmHMAC {
+			if secretErr != nil {
+				return k.Match(r.Key.Payload)
+			}
+			legacy = true
+			return false
+		}
+		if secretErr != nil {
+			return false
+		}
+		return k.MatchDigest(getAPIKeyDigest(secret, r.Key.Payload))
+	})
+	db.mu.RUnlock()
+	if legacy {
+		return db.migrateAPIKey(r)
+	}
+	if err != nil {
+		if key != nil && key.Algorithm == apiKeyAlgorithmHMAC && secretErr != nil {
+			return secretErr
+		}
+		return err
+	}
+	r.User.Username = user.Username
+	r.User.Email = user.GetMailClaim()
+	r.Response.Code = 200
+	if db.recordAPIKeyUsage(key, r) {
+		// The usage tracking is best-effort and does not fail the lookup.
+		if err := db.flushDueAPIKeyUsage(); err != nil && r.Logger != nil {
+			r.Logger.Warn("failed flushing api key usage", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// getAPIKeyPrefix returns the prefix of API key used to index the key. The
+// keys in the self-identifying format are indexed by the product prefix and
+// key ID, and their checksums are validated. The legacy keys are indexed by
+// the first 24 characters.
+func getAPIKeyPrefix(s string) (string, error) {
+	if strings.Contains(s, "_") {
+		k, err := apikey.Parse(s)
+		if err != nil {
+			return "", errors.ErrLookupAPIKeyMalformedPayload
+		}
+		return k.Identifier(), nil
+	}
+	if len(s) < 72 || len(s) > 96 {
+		return "", errors.ErrLookupAPIKeyMalformedPayload
+	}
+	for _, c := range s {
+		if !strings.ContainsRune(charset, c) {
+			return "", errors.ErrLookupAPIKeyMalformedPayload
+		}
+	}
+	return s[:24], nil
+}
+
+// lookupAPIKey performs the lookup of API key by prefix and matches it with
+// the provided function.
+func (db *Database) lookupAPIKey(r *requests.Request, match func(*APIKey) bool) (*User, error) {
 	user, exists := db.refAPIKey[r.Key.Prefix]
 	if !exists {
-		return errors.ErrLookupAPIKeyFailed
+		return nil, errors.ErrLookupAPIKeyFailed
+	}
+	if err := user.lookupAPIKey(r, match); err != nil {
+		return nil, err
 	}
-	if err := user.LookupAPIKey(r); err != nil {
+	return user, nil
+}
+
+// migrateAPIKey performs the lookup of the legacy API key hashed with bcrypt
+// and replaces the hash with HMAC-SHA256 digest. When the database commit
+// fails, the key keeps the bcrypt hash and the lookup fails.
+func (db *Database) migrateAPIKey(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	secret, err := db.getAPIKeySecret()
+	if err != nil {
+		return err
+	}
+	var key *APIKey
+	user, err := db.lookupAPIKey(r, func(k *APIKey) bool {
+		key = k
+		if k.Algorithm == apiKeyAlgorithmHMAC {
+			// The key has been migrated by a concurrent lookup.
+			return k.MatchDigest(getAPIKeyDigest(secret, r.Key.Payload))
+		}
+		return k.Match(r.Key.Payload)
+	})
+	if err != nil {
 		return err
 	}
+	if key.Algorithm == apiKeyAlgorithmBcrypt {
+		payload := key.Payload
+		key.Algorithm = apiKeyAlgorithmHMAC
+		key.Payload = getAPIKeyDigest(secret, r.Key.Payload)
+		user.Revise()
+		if err := db.commit(); err != nil {
+			key.Algorithm = apiKeyAlgorithmBcrypt
+			key.Payload = payload
+			return errors.ErrLookupAPIKeyMigrate.WithArgs(err)
+		}
+	}
+	db.recordAPIKeyUsage(key, r)
 	r.User.Username = user.Username
 	r.User.Email = user.GetMailClaim()
 	r.Response.Code = 200
 	return nil
 }
 
+// recordAPIKeyUsage records the usage of API key. The usage is applied to
+// the key upon the next database commit. The function returns true when
+// the usage should be flushed to the database.
+func (db *Database) recordAPIKeyUsage(key *APIKey, r *requests.Request) bool {
+	db.usageMu.Lock()
+	defer db.usageMu.Unlock()
+	u, exists := db.usage[key]
+	if !exists {
+		u = &APIKeyUsage{}
+		db.usage[key] = u
+	}
+	u.LastUsedAt = time.Now().UTC()
+	u.LastUsedIP = r.Upstream.GetAddress()
+	u.LastUsedUserAgent = r.Upstream.GetUserAgent()
+	u.UseCount++
+	return db.isAPIKeyUsageFlushDue()
+}
+
+// isAPIKeyUsageFlushDue returns true when the flush interval of the usage of
+// API keys has elapsed. The function is called under the usage lock.
+func (db *Database) isAPIKeyUsageFlushDue() bool {
+	interval := time.Duration(db.Policy.APIKey.UsageFlushInterval) * time.Second
+	if interval == 0 {
+		interval = 60 * time.Second
+	}
+	return time.Since(db.usageFlushedAt) >= interval
+}
+
+// flushDueAPIKeyUsage writes the recorded usage of API keys to the database
+// when the flush interval has elapsed. The interval is checked again under
+// the write lock, so that only one of the concurrent lookups commits.
+func (db *Database) flushDueAPIKeyUsage() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.usageMu.Lock()
+	due := db.isAPIKeyUsageFlushDue()
+	db.usageMu.Unlock()
+	if !due {
+		return nil
+	}
+	return db.flushAPIKeyUsage(false)
+}
+
+// applyAPIKeyUsage applies the recorded usage to API keys. The function is
+// called under the write lock.
+func (db *Database) applyAPIKeyUsage() {
+	db.usageMu.Lock()
+	defer db.usageMu.Unlock()
+	for key, u := range db.usage {
+		key.Use(u)
+	}
+	db.usage = make(map[*APIKey]*APIKeyUsage)
+	db.usageFlushedAt = time.Now().UTC()
+}
+
+// FlushAPIKeyUsage writes the recorded usage of API keys to the database.
+func (db *Database) FlushAPIKeyUsage() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.flushAPIKeyUsage(false)
+}
+
+// flushAPIKeyUsage commits the database when there is recorded usage of API
+// keys, or when force is true. The function is called under the write lock.
+// When the commit fails, the usage remains applied to the keys and is
+// written upon the next commit.
+func (db *Database) flushAPIKeyUsage(force bool) error {
+	db.usageMu.Lock()
+	pending := len(db.usage)
+	db.usageMu.Unlock()
+	if pending == 0 && !force {
+		return nil
+	}
+	return db.commit()
+}
+
+// GetUnusedAPIKeys returns the report of the enabled API keys that have not
+// been used for the provided number of days. The keys that have never been
+// used are reported when they were created earlier than that.
+func (db *Database) GetUnusedAPIKeys(days int) []*APIKeyReportEntry {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.applyAPIKeyUsage()
+	cutoff := time.Now().UTC().Add(-time.Duration(days) * 24 * time.Hour)
+	entries := []*APIKeyReportEntry{}
+	for _, user := range db.Users {
+		for _, k := range user.APIKeys {
+			if k.Disabled {
+				continue
+			}
+			lastUsedAt := k.LastUsedAt
+			if lastUsedAt.IsZero() {
+				lastUsedAt = k.CreatedAt
+			}
+			if lastUsedAt.After(cutoff) {
+				continue
+			}
+			entries = append(entries, &APIKeyReportEntry{
+				Username:   user.Username,
+				Email:      user.GetMailClaim(),
+				ID:         k.ID,
+				Prefix:     k.Prefix,
+				Comment:    k.Comment,
+				CreatedAt:  k.CreatedAt,
+				LastUsedAt: k.LastUsedAt,
+				UseCount:   k.UseCount,
+			})
+		}
+	}
+	return entries
+}
+
+// GetNonCompliantPublicKeys returns the report of the enabled public keys
+// violating the public key policy of the database, and of the ones
+// registered by another user too. If disable is true, the keys are
+// suspended, and can be re-enabled after the policy changes.
+func (db *Database) GetNonCompliantPublicKeys(disable bool) ([]*PublicKeyReportEntry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now().UTC()
+	entries := []*PublicKeyReportEntry{}
+	for _, user := range db.Users {
+		var suspended bool
+		for _, k := range user.PublicKeys {
+			if k.Disabled || k.Payload == "" {
+				continue
+			}
+			err := db.checkPublicKeyPolicyCompliance(k, now)
+			if err == nil {
+				fingerprint := normalizePublicKeyFingerprint(k.Fingerprint)
+				if owner, exists := db.refPublicKey[fingerprint]; exists && owner != user {
+					err = errors.ErrPublicKeyRegistered.WithArgs(k.Fingerprint)
+				}
+			}
+			if err == nil {
+				continue
+			}
+			if disable {
+				k.Suspend()
+				suspended = true
+			}
+			entries = append(entries, &PublicKeyReportEntry{
+				Username:    user.Username,
+				Email:       user.GetMailClaim(),
+				ID:          k.ID,
+				Usage:       k.Usage,
+				Type:        k.Type,
+				Fingerprint: k.Fingerprint,
+				Comment:     k.Comment,
+				CreatedAt:   k.CreatedAt,
+				Violation:   err.Error(),
+				Disabled:    k.Disabled,
+			})
+		}
+		if suspended {
+			user.Revise()
+		}
+	}
+	if disable && len(entries) > 0 {
+		if err := db.commit(); err != nil {
+			return entries, err
+		}
+	}
+	return entries, nil
+}
+
 // AddMfaToken adds MFA token for a user.
 func (db *Database) AddMfaToken(r *requests.Request) error {
 	db.mu.Lock()
@@ -712,7 +2014,7 @@ func (db *Database) GetMfaTokens(r *requests.Request) error {
 	}
 	bundle := NewMfaTokenBundle()
 	for _, token := range user.MfaTokens {
-		if token.Disabled {
+		if token.Disabled && !r.Flags.IncludeDisabled {
 			continue
 		}
 		bundle.Add(token)
@@ -738,6 +2040,120 @@ func (db *Database) DeleteMfaToken(r *requests.Request) error {
 	return nil
 }
 
+// DisableMfaToken disables MFA token associated with a user by token id.
+// The disabled token is kept and can be re-enabled with EnableMfaToken.
+func (db *Database) DisableMfaToken(r *requests.Request) error {
+	return db.updateMfaToken(r, errors.ErrDisableMfaToken, func(user *User, token *MfaToken) error {
+		token.Suspend()
+		return nil
+	})
+}
+
+// EnableMfaToken re-enables MFA token associated with a user by token id.
+func (db *Database) EnableMfaToken(r *requests.Request) error {
+	return db.updateMfaToken(r, errors.ErrEnableMfaToken, func(user *User, token *MfaToken) error {
+		return token.Enable()
+	})
+}
+
+// UpdateMfaToken changes the comment of MFA token associated with a user by
+// token id.
+func (db *Database) UpdateMfaToken(r *requests.Request) error {
+	return db.updateMfaToken(r, errors.ErrUpdateMfaToken, func(user *User, token *MfaToken) error {
+		for _, k := range user.MfaTokens {
+			if k != token && k.Comment == r.MfaToken.Comment {
+				return errors.ErrDuplicateMfaTokenComment
+			}
+		}
+		token.SetComment(r.MfaToken.Comment)
+		return nil
+	})
+}
+
+// VerifyMfaToken validates the passcode of the TOTP or HOTP token of a user.
+// The counter of HOTP token and the time step of TOTP token accepting the
+// passcode are persisted, so the passcode cannot be reused.
+func (db *Database) VerifyMfaToken(r *requests.Request) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.getUser(r.User.Username)
+	if err != nil {
+		r.Response.Code = 400
+		return errors.ErrVerifyMfaToken.WithArgs(err)
+	}
+	skew, err := db.getTOTPSkew()
+	if err != nil {
+		r.Response.Code = 400
+		return errors.ErrVerifyMfaToken.WithArgs(err)
+	}
+	states := user.getMfaTokenStates()
+	token, err := user.VerifyMfaPasscode(r, skew)
+	if err != nil {
+		r.Response.Code = 400
+		// The failed attempts of HOTP tokens are persisted.
+		if user.isMfaTokenStateChanged(states) {
+			user.Revise()
+			if commitErr := db.commit(); commitErr != nil {
+				return errors.ErrVerifyMfaToken.WithArgs(commitErr)
+			}
+		}
+		return errors.ErrVerifyMfaToken.WithArgs(err)
+	}
+	// The counter of HOTP token and the last time step of TOTP token are
+	// persisted.
+	if user.isMfaTokenStateChanged(states) {
+		user.Revise()
+		if err := db.commit(); err != nil {
+			return errors.ErrVerifyMfaToken.WithArgs(err)
+		}
+	}
+	r.MfaToken.ID = token.ID
+	r.Response.Code = 200
+	return nil
+}
+
+// getTOTPSkew returns the number of time steps before and after the current
+// one within which the passcodes of TOTP tokens are accepted.
+func (db *Database) getTOTPSkew() (int, error) {
+	if db.Policy.MfaToken.TOTPSkew == nil {
+		return defaultTOTPSkew, nil
+	}
+	skew := *db.Policy.MfaToken.TOTPSkew
+	if skew < 0 || skew > maxTOTPSkew {
+		return 0, errors.ErrMfaTokenPolicyTOTPSkew.WithArgs(skew, maxTOTPSkew)
+	}
+	return skew, nil
+}
+
+// ResyncMfaToken resynchronizes the counter of HOTP token associated with a
+// user by token id. The request has two consecutive passcodes of the token.
+func (db *Database) ResyncMfaToken(r *requests.Request) error {
+	return db.updateMfaToken(r, errors.ErrResyncMfaToken, func(user *User, token *MfaToken) error {
+		return token.Resync(r.MfaToken.Passcode, r.MfaToken.NextPasscode)
+	})
+}
+
+func (db *Database) updateMfaToken(r *requests.Request, e errors.StandardError, f func(*User, *MfaToken) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user, err := db.validateUserIdentity(r.User.Username, r.User.Email)
+	if err != nil {
+		return e.WithArgs(r.MfaToken.ID, err)
+	}
+	token := user.getMfaToken(r.MfaToken.ID)
+	if token == nil {
+		return e.WithArgs(r.MfaToken.ID, "not found")
+	}
+	if err := f(user, token); err != nil {
+		return e.WithArgs(r.MfaToken.ID, err)
+	}
+	user.Revise()
+	if err := db.commit(); err != nil {
+		return e.WithArgs(r.MfaToken.ID, err)
+	}
+	return nil
+}
+
 // GetUsernamePolicySummary returns the summary of username policy.
 func (db *Database) GetUsernamePolicySummary() string {
 	var sb strings.Builder
@@ -794,9 +2210,26 @@ func (db *Database) GetPasswordPolicySummary() string {
 	if len(charRestrictions) > 0 {
 		sb.WriteString(fmt.Sprintf(" with %s characters", strings.Join(charRestrictions, ", ")))
 	}
+	if db.Policy.Password.MinScore > 0 {
+		sb.WriteString(fmt.Sprintf(" and strength score of at least %d out of 4", db.Policy.Password.MinScore))
+	}
 	return sb.String()
 }
 
+// GetPasswordStrength returns the estimated strength of the password in
+// the request. The username, email address and name in the request, and the
+// ones of the matching user, are treated as guessable words.
+func (db *Database) GetPasswordStrength(r *requests.Request) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	userInputs := []string{r.User.Username, r.User.Email, r.User.FullName}
+	if user, err := db.getUser(r.User.Username); err == nil {
+		userInputs = append(userInputs, user.getPasswordStrengthInputs()...)
+	}
+	r.Response.Payload = NewPasswordStrength(r.User.Password, userInputs)
+	return nil
+}
+
 // GetPasswordPolicyRegex returns regex for passwords.
 func (db *Database) GetPasswordPolicyRegex() string {
 	var allowedChars string
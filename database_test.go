@@ -18,10 +18,14 @@ import (
 	"fmt"
 	"github.com/google/go-cmp/cmp"
 	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/apikey"
 	"github.com/greenpau/go-identity/pkg/errors"
 	"github.com/greenpau/go-identity/pkg/requests"
+	"go.uber.org/zap"
+	"net/http"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -37,6 +41,9 @@ var (
 	testPwd2      = NewRandomString(16)
 	testFullName2 = ""
 	testRoles2    = []string{"viewer"}
+	// testAPIKeySecret is the secret key of API key digests kept outside of
+	// the test databases.
+	testAPIKeySecret = []byte("a9f0c7e2b5d14e6f8c3b2a1d0e9f8a7b")
 )
 
 func createTestDatabase(s string) (*Database, error) {
@@ -69,6 +76,9 @@ func createTestDatabase(s string) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := db.SetAPIKeySecret(testAPIKeySecret); err != nil {
+		return nil, err
+	}
 
 	for _, req := range reqs {
 		if err := db.AddUser(req); err != nil {
@@ -407,6 +417,84 @@ func TestDatabaseAddUser(t *testing.T) {
 			shouldErr: true,
 			err:       errors.ErrAddUser.WithArgs("", errors.ErrUserPolicyCompliance),
 		},
+		{
+			name: "add user with uppercase username",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "FooBar",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("FooBar", errors.ErrUserPolicyUppercase),
+		},
+		{
+			name: "add user with non alpha-numeric username",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foo.bar",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("foo.bar", errors.ErrUserPolicyNonAlphaNumeric),
+		},
+		{
+			name: "add user with username starting with number",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "1foobar",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("1foobar", errors.ErrUserPolicyStartChar),
+		},
+		{
+			name: "add user with username having invalid character",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foo@bar",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("foo@bar", errors.ErrUserPolicyInvalidChar.WithArgs('@')),
+		},
+		{
+			name: "add user with reserved username",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "admin",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("admin", errors.ErrUserPolicyReserved.WithArgs("admin")),
+		},
+		{
+			name: "add user with username confusable with reserved username",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "adrnin",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("adrnin", errors.ErrUserPolicyReserved.WithArgs("adrnin")),
+		},
+		{
+			name: "add user with username confusable with existing username",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "jsrnith",
+					Password: testPwd1,
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("jsrnith", errors.ErrUserPolicyConfusable.WithArgs("jsrnith", testUser1)),
+		},
 		{
 			name: "add user with used email",
 			req: &requests.Request{
@@ -562,194 +650,1289 @@ func TestDatabaseChangeUserPassword(t *testing.T) {
 	}
 }
 
-func TestDatabaseUserPublicKey(t *testing.T) {
+func TestDatabaseChangeUsername(t *testing.T) {
 	var databasePath string
-	db, err := createTestDatabase("TestDatabaseUserPublicKey")
+	db, err := createTestDatabase("TestDatabaseChangeUsername")
 	if err != nil {
 		t.Fatalf("failed to create temp dir: %v", err)
 	}
 	databasePath = db.path
 	testcases := []struct {
-		name           string
-		operation      string
-		usage          string
-		overwriteUsage string
-		overwritePath  string
-		keyID          string
-		keyAlgorithm   string
-		pubKeyType     string
-		comment        string
-		username       string
-		email          string
-		want           map[string]interface{}
-		shouldErr      bool
-		err            error
+		name          string
+		req           *requests.Request
+		overwritePath string
+		want          map[string]interface{}
+		shouldErr     bool
+		err           error
 	}{
 		{
-			name:         "add disabled openssh public key",
-			operation:    "add",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			comment:      testEmail1,
-			username:     testUser1,
-			email:        testEmail1,
-			want: map[string]interface{}{
-				"key_count": 1,
+			name: "change username of invalid user",
+			req: &requests.Request{
+				User: requests.User{
+					OldUsername: "foobar",
+					Username:    "barfoo",
+					Email:       "foobar@barfoo",
+				},
 			},
+			shouldErr: true,
+			err:       errors.ErrChangeUsername.WithArgs(errors.ErrDatabaseUserNotFound),
 		},
-
 		{
-			name:         "add openssh public key",
-			operation:    "add",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			comment:      testEmail1,
-			username:     testUser1,
-			email:        testEmail1,
-			want: map[string]interface{}{
-				"key_count": 2,
+			name: "change username to reserved username",
+			req: &requests.Request{
+				User: requests.User{
+					OldUsername: testUser1,
+					Username:    "root",
+					Email:       testEmail1,
+				},
 			},
+			shouldErr: true,
+			err:       errors.ErrChangeUsername.WithArgs(errors.ErrUserPolicyReserved.WithArgs("root")),
 		},
 		{
-			name:         "add rsa public key",
-			operation:    "add",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			comment:      testEmail1,
-			username:     testUser1,
-			email:        testEmail1,
-			want: map[string]interface{}{
-				"key_count": 3,
+			name: "change username to used username",
+			req: &requests.Request{
+				User: requests.User{
+					OldUsername: testUser1,
+					Username:    testUser2,
+					Email:       testEmail1,
+				},
 			},
+			shouldErr: true,
+			err:       errors.ErrChangeUsername.WithArgs("username already in use"),
 		},
 		{
-			name:      "delete all public keys",
-			operation: "delete",
-			username:  testUser1,
-			email:     testEmail1,
-			usage:     "ssh",
-			want: map[string]interface{}{
-				"key_count": 0,
+			name: "change username to username confusable with existing username",
+			req: &requests.Request{
+				User: requests.User{
+					OldUsername: testUser1,
+					Username:    "bj0nes",
+					Email:       testEmail1,
+				},
 			},
+			shouldErr: true,
+			err:       errors.ErrChangeUsername.WithArgs(errors.ErrUserPolicyConfusable.WithArgs("bj0nes", testUser2)),
 		},
 		{
-			name:         "readd rsa public key",
-			operation:    "add",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			comment:      testEmail1,
-			username:     testUser1,
-			email:        testEmail1,
+			name: "change username to username confusable with own username",
+			req: &requests.Request{
+				User: requests.User{
+					OldUsername: testUser1,
+					Username:    "jsrnith",
+					Email:       testEmail1,
+				},
+			},
 			want: map[string]interface{}{
-				"key_count": 1,
+				"username":  "jsrnith",
+				"old_found": false,
 			},
 		},
 		{
-			name:      "delete non-existing public key",
-			operation: "delete",
-			username:  testUser1,
-			email:     testEmail1,
-			usage:     "ssh",
-			keyID:     "foobar",
-			shouldErr: true,
-			err:       errors.ErrDeletePublicKey.WithArgs("foobar", "not found"),
+			name: "fail committing after change username",
+			req: &requests.Request{
+				User: requests.User{
+					OldUsername: testUser2,
+					Username:    "foobar",
+					Email:       testEmail2,
+				},
+			},
+			overwritePath: path.Dir(databasePath),
+			shouldErr:     true,
+			err: errors.ErrChangeUsername.WithArgs(
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+			),
 		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			db.path = databasePath
+			if tc.overwritePath != "" {
+				db.path = tc.overwritePath
+			}
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			err = db.ChangeUsername(tc.req)
+			if tests.EvalErrWithLog(t, err, "change username", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			user, err := db.getUser(tc.req.User.Username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, oldFound := db.refUsername[tc.req.User.OldUsername]
+			got := make(map[string]interface{})
+			got["username"] = user.Username
+			got["old_found"] = oldFound
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseUserAPIKey(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseUserAPIKey")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	testcases := []struct {
+		name      string
+		req       *requests.Request
+		payload   string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
 		{
-			name:         "add rsa public key with non-existing username",
-			operation:    "add",
-			username:     "foobar",
-			email:        "foobar@barfoo",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			shouldErr:    true,
-			err:          errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrDatabaseUserNotFound),
+			name: "add unscoped api key",
+			req: &requests.Request{
+				User: requests.User{Username: testUser1, Email: testEmail1},
+				Key:  requests.Key{Usage: "api", Comment: "unscoped"},
+			},
+			want: map[string]interface{}{
+				"username": testUser1,
+				"email":    testEmail1,
+				"roles":    testRoles1,
+			},
 		},
 		{
-			name:         "add rsa public key with mismatch user and email",
-			operation:    "add",
-			username:     testUser1,
-			email:        testEmail2,
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			shouldErr:    true,
-			err:          errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrDatabaseInvalidUser),
+			name: "add scoped api key",
+			req: &requests.Request{
+				User: requests.User{Username: testUser1, Email: testEmail1},
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "scoped",
+					Scopes:  []string{"read:users"},
+					Roles:   []string{"viewer"},
+				},
+			},
+			want: map[string]interface{}{
+				"username": testUser1,
+				"email":    testEmail1,
+				"scopes":   []string{"read:users"},
+				"roles":    []string{"viewer"},
+			},
 		},
 		{
-			name:         "add rsa public key with non-existing email address",
-			operation:    "add",
-			username:     testUser1,
-			email:        "foobar@barfoo",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			shouldErr:    true,
-			err:          errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrDatabaseUserNotFound),
+			name: "add api key with role not assigned to user",
+			req: &requests.Request{
+				User: requests.User{Username: testUser2, Email: testEmail2},
+				Key: requests.Key{
+					Usage:   "api",
+					Comment: "scoped",
+					Roles:   []string{"admin"},
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddAPIKey.WithArgs("api", errors.ErrAPIKeyRoleNotAssigned.WithArgs("admin")),
 		},
 		{
-			name:         "get public keys with non-existing email address",
-			operation:    "get",
-			username:     testUser1,
-			email:        "foobar@barfoo",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			pubKeyType:   "openssh",
-			shouldErr:    true,
-			err:          errors.ErrGetPublicKeys.WithArgs("ssh", errors.ErrDatabaseUserNotFound),
+			name: "lookup invalid api key",
+			req: &requests.Request{
+				User: requests.User{Username: testUser2, Email: testEmail2},
+				Key:  requests.Key{Usage: "api", Comment: "unscoped"},
+			},
+			payload:   GetRandomStringFromRange(72, 96),
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
 		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := db.AddAPIKey(tc.req)
+			if tc.payload == "" {
+				if tests.EvalErrWithLog(t, err, "add api key", tc.shouldErr, tc.err, msgs) {
+					return
+				}
+				tc.payload = tc.req.Response.Payload.(string)
+			}
+			r := requests.NewRequest()
+			r.Key.Payload = tc.payload
+			err = db.LookupAPIKey(r)
+			if tests.EvalErrWithLog(t, err, "lookup api key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["username"] = r.User.Username
+			got["email"] = r.User.Email
+			if len(r.Key.Scopes) > 0 {
+				got["scopes"] = r.Key.Scopes
+			}
+			got["roles"] = r.User.Roles
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseRotateAPIKey(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseRotateAPIKey")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db.Policy.APIKey.MaxLifetime = 86400
+	testcases := []struct {
+		name        string
+		ttl         int
+		gracePeriod int
+		expire      bool
+		want        map[string]interface{}
+		shouldErr   bool
+		err         error
+	}{
+		{
+			name:        "rotate api key with grace period",
+			gracePeriod: 3600,
+			want: map[string]interface{}{
+				"old_key": nil,
+				"new_key": nil,
+				"ttl":     86400,
+			},
+		},
+		{
+			name: "rotate api key without grace period",
+			ttl:  3600,
+			want: map[string]interface{}{
+				"old_key": errors.ErrLookupAPIKeyDisabled.Error(),
+				"new_key": nil,
+				"ttl":     3600,
+			},
+		},
+		{
+			name:        "rotate api key after grace period",
+			gracePeriod: 3600,
+			expire:      true,
+			want: map[string]interface{}{
+				"old_key": errors.ErrLookupAPIKeyExpired.Error(),
+				"new_key": nil,
+				"ttl":     86400,
+			},
+		},
+		{
+			name:      "add api key exceeding maximum lifetime",
+			ttl:       172800,
+			shouldErr: true,
+			err:       errors.ErrAddAPIKey.WithArgs("api", errors.ErrAPIKeyPolicyMaxLifetime.WithArgs(172800, 86400)),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			r := &requests.Request{
+				User: requests.User{Username: testUser1, Email: testEmail1},
+				Key:  requests.Key{Usage: "api", Comment: tc.name, TTL: tc.ttl},
+			}
+			err := db.AddAPIKey(r)
+			if tests.EvalErrWithLog(t, err, "add api key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			oldPayload := r.Response.Payload.(string)
+			r = &requests.Request{
+				User: requests.User{Username: testUser1, Email: testEmail1},
+				Key:  requests.Key{ID: r.Key.ID, GracePeriod: tc.gracePeriod},
+			}
+			if err := db.RotateAPIKey(r); err != nil {
+				t.Fatal(err)
+			}
+			newPayload := r.Response.Payload.(string)
+			user, err := db.getUser(testUser1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newKey := user.getAPIKey(r.Key.ID)
+			if tc.expire {
+				for _, k := range user.APIKeys {
+					if k.Prefix == oldPayload[:24] {
+						k.ExpiredAt = time.Now().UTC().Add(-time.Second)
+					}
+				}
+			}
+			got := make(map[string]interface{})
+			got["ttl"] = int(newKey.ExpiredAt.Sub(newKey.CreatedAt).Seconds())
+			for k, payload := range map[string]string{"old_key": oldPayload, "new_key": newPayload} {
+				lookupReq := requests.NewRequest()
+				lookupReq.Key.Payload = payload
+				if err := db.LookupAPIKey(lookupReq); err != nil {
+					got[k] = err.Error()
+				} else {
+					got[k] = nil
+				}
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseAPIKeyFormat(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseAPIKeyFormat")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	testcases := []struct {
+		name      string
+		prefix    string
+		corrupt   func(string) string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "lookup api key with default prefix",
+			want: map[string]interface{}{
+				"prefix":   "gik",
+				"username": testUser1,
+			},
+		},
+		{
+			name:   "lookup api key with custom prefix",
+			prefix: "acme",
+			want: map[string]interface{}{
+				"prefix":   "acme",
+				"username": testUser1,
+			},
+		},
+		{
+			name: "lookup api key with corrupted checksum",
+			corrupt: func(s string) string {
+				return s[:len(s)-6] + "000000"
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyMalformedPayload,
+		},
+		{
+			name: "lookup truncated api key",
+			corrupt: func(s string) string {
+				return s[:len(s)-1]
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyMalformedPayload,
+		},
+		{
+			name: "lookup legacy api key with invalid characters",
+			corrupt: func(s string) string {
+				return GetRandomString(71) + "!"
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyMalformedPayload,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			db.Policy.APIKey.Prefix = "gik"
+			if tc.prefix != "" {
+				db.Policy.APIKey.Prefix = tc.prefix
+			}
+			r := &requests.Request{
+				User: requests.User{Username: testUser1, Email: testEmail1},
+				Key:  requests.Key{Usage: "api", Comment: tc.name},
+			}
+			if err := db.AddAPIKey(r); err != nil {
+				t.Fatal(err)
+			}
+			payload := r.Response.Payload.(string)
+			k, err := apikey.Parse(payload)
+			if err != nil {
+				t.Fatalf("failed parsing api key %q: %v", payload, err)
+			}
+			if k.ID != r.Key.ID {
+				t.Fatalf("api key id mismatch: %s (embedded) vs. %s", k.ID, r.Key.ID)
+			}
+			if tc.corrupt != nil {
+				payload = tc.corrupt(payload)
+			}
+			lookupReq := requests.NewRequest()
+			lookupReq.Key.Payload = payload
+			err = db.LookupAPIKey(lookupReq)
+			if tests.EvalErrWithLog(t, err, "lookup api key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["prefix"] = k.Prefix
+			got["username"] = lookupReq.User.Username
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseAPIKeyRestrictions(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseAPIKeyRestrictions")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	r := &requests.Request{
+		User: requests.User{Username: testUser1, Email: testEmail1},
+		Key: requests.Key{
+			Usage:           "api",
+			Comment:         "ci",
+			AllowedNetworks: []string{"10.20.0.0/16"},
+			AllowedMethods:  []string{"GET", "POST"},
+		},
+	}
+	if err := db.AddAPIKey(r); err != nil {
+		t.Fatal(err)
+	}
+	payload := r.Response.Payload.(string)
+	testcases := []struct {
+		name       string
+		remoteAddr string
+		method     string
+		want       map[string]interface{}
+		shouldErr  bool
+		err        error
+	}{
+		{
+			name:       "lookup api key from runner subnet",
+			remoteAddr: "10.20.1.5:51000",
+			method:     "POST",
+			want: map[string]interface{}{
+				"code":     200,
+				"username": testUser1,
+			},
+		},
+		{
+			name:       "lookup api key from other subnet",
+			remoteAddr: "10.30.1.5:51000",
+			method:     "GET",
+			want: map[string]interface{}{
+				"code": 403,
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyNetworkDenied.WithArgs("10.30.1.5"),
+		},
+		{
+			name:       "lookup api key with disallowed method",
+			remoteAddr: "10.20.1.5:51000",
+			method:     "DELETE",
+			want: map[string]interface{}{
+				"code": 403,
+			},
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyMethodDenied.WithArgs("DELETE"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			httpReq, err := http.NewRequest(tc.method, "https://localhost/api", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			httpReq.RemoteAddr = tc.remoteAddr
+			lookupReq := requests.NewRequest()
+			lookupReq.Key.Payload = payload
+			lookupReq.Upstream.Request = httpReq
+			err = db.LookupAPIKey(lookupReq)
+			got := make(map[string]interface{})
+			got["code"] = lookupReq.Response.Code
+			if err == nil {
+				got["username"] = lookupReq.User.Username
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+			tests.EvalErrWithLog(t, err, "lookup api key", tc.shouldErr, tc.err, msgs)
+		})
+	}
+}
+
+func TestDatabaseMigrateAPIKey(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseMigrateAPIKey")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user, err := db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := GetRandomStringFromRange(72, 96)
+	hk, err := NewPasswordWithOptions(payload, "generic", "bcrypt", map[string]interface{}{"pepper_id": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &requests.Request{
+		Key: requests.Key{
+			Usage:   "api",
+			Comment: "legacy",
+			Prefix:  payload[:24],
+			Payload: hk.Hash,
+		},
+	}
+	if err := user.AddAPIKey(r); err != nil {
+		t.Fatal(err)
+	}
+	db.refAPIKey[payload[:24]] = user
+	key := user.getAPIKey(r.Key.ID)
+
+	testcases := []struct {
+		name      string
+		payload   string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "lookup legacy api key with invalid payload",
+			payload:   payload[:24] + GetRandomString(len(payload)-24),
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name:    "lookup and migrate legacy api key",
+			payload: payload,
+			want: map[string]interface{}{
+				"username":  testUser1,
+				"algorithm": "hmac-sha256",
+			},
+		},
+		{
+			name:    "lookup migrated api key",
+			payload: payload,
+			want: map[string]interface{}{
+				"username":  testUser1,
+				"algorithm": "hmac-sha256",
+			},
+		},
+		{
+			name:      "lookup migrated api key with invalid payload",
+			payload:   payload[:24] + GetRandomString(len(payload)-24),
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			r := requests.NewRequest()
+			r.Key.Payload = tc.payload
+			err := db.LookupAPIKey(r)
+			if tests.EvalErrWithLog(t, err, "lookup api key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["username"] = r.User.Username
+			got["algorithm"] = key.Algorithm
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseAPIKeyWithoutSecret(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseAPIKeyWithoutSecret")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db.APIKeySecret = nil
+	r := requests.NewRequest()
+	r.User.Username = testUser1
+	r.User.Email = testEmail1
+	r.Key.Usage = "api"
+	r.Key.Comment = "no secret"
+	if err := db.AddAPIKey(r); err != nil {
+		t.Fatalf("failed adding api key without secret: %v", err)
+	}
+	payload := r.Response.Payload.(string)
+	user, err := db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := user.getAPIKey(r.Key.ID)
+	k, err := apikey.Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidKey, err := apikey.NewKey(k.Prefix, k.ID, GetRandomString(apikey.SecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name      string
+		payload   string
+		secret    []byte
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:    "lookup api key hashed with bcrypt without secret",
+			payload: payload,
+			want: map[string]interface{}{
+				"username":  testUser1,
+				"algorithm": "bcrypt",
+			},
+		},
+		{
+			name:      "lookup api key with invalid payload without secret",
+			payload:   invalidKey.String(),
+			shouldErr: true,
+			err:       errors.ErrLookupAPIKeyFailed,
+		},
+		{
+			name:    "lookup and migrate api key after loading secret",
+			payload: payload,
+			secret:  testAPIKeySecret,
+			want: map[string]interface{}{
+				"username":  testUser1,
+				"algorithm": "hmac-sha256",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if tc.secret != nil {
+				if err := db.SetAPIKeySecret(tc.secret); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := requests.NewRequest()
+			r.Key.Payload = tc.payload
+			err := db.LookupAPIKey(r)
+			if tests.EvalErrWithLog(t, err, "lookup api key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["username"] = r.User.Username
+			got["algorithm"] = key.Algorithm
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseAPIKeyUsage(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseAPIKeyUsage")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db.Policy.APIKey.UsageFlushInterval = 3600
+	var payloads []string
+	for _, comment := range []string{"used", "stale"} {
+		r := &requests.Request{
+			User: requests.User{Username: testUser1, Email: testEmail1},
+			Key:  requests.Key{Usage: "api", Comment: comment},
+		}
+		if err := db.AddAPIKey(r); err != nil {
+			t.Fatal(err)
+		}
+		payloads = append(payloads, r.Response.Payload.(string))
+	}
+	user, err := db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedKey := user.APIKeys[0]
+	staleKey := user.APIKeys[1]
+	staleKey.CreatedAt = time.Now().UTC().Add(-60 * 24 * time.Hour)
+
+	httpReq, err := http.NewRequest("GET", "https://localhost/api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.RemoteAddr = "192.168.1.10:43210"
+	httpReq.Header.Set("User-Agent", "curl/7.68.0")
+
+	testcases := []struct {
+		name     string
+		upstream requests.Upstream
+		flush    bool
+		want     map[string]interface{}
+	}{
+		{
+			name:     "lookup api key with upstream address",
+			upstream: requests.Upstream{Address: "10.0.0.1", UserAgent: "foobar/1.0"},
+			want: map[string]interface{}{
+				"use_count":            0,
+				"last_used_ip":         "",
+				"last_used_user_agent": "",
+				"revision":             db.Revision,
+			},
+		},
+		{
+			name:     "lookup api key with upstream request",
+			upstream: requests.Upstream{Request: httpReq},
+			flush:    true,
+			want: map[string]interface{}{
+				"use_count":            2,
+				"last_used_ip":         "192.168.1.10",
+				"last_used_user_agent": "curl/7.68.0",
+				"revision":             db.Revision + 1,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			r := requests.NewRequest()
+			r.Key.Payload = payloads[0]
+			r.Upstream = tc.upstream
+			if err := db.LookupAPIKey(r); err != nil {
+				t.Fatal(err)
+			}
+			if tc.flush {
+				if err := db.FlushAPIKeyUsage(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := make(map[string]interface{})
+			got["use_count"] = usedKey.UseCount
+			got["last_used_ip"] = usedKey.LastUsedIP
+			got["last_used_user_agent"] = usedKey.LastUsedUserAgent
+			got["revision"] = db.Revision
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+
+	r := requests.NewRequest()
+	r.Key.Payload = payloads[0]
+	if err := db.LookupAPIKey(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	savedDB, err := NewDatabase(db.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedUser, err := savedDB.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []string{"test name: save recorded api key usage"}
+	tests.EvalObjectsWithLog(t, "use count", 3, savedUser.APIKeys[0].UseCount, msgs)
+
+	msgs = []string{"test name: get unused api keys"}
+	var got []string
+	for _, entry := range db.GetUnusedAPIKeys(30) {
+		got = append(got, entry.Username+"/"+entry.Comment)
+	}
+	tests.EvalObjectsWithLog(t, "unused keys", []string{testUser1 + "/stale"}, got, msgs)
+
+	// The lookup succeeds when the usage cannot be flushed.
+	msgs = []string{"test name: lookup api key with failed usage flush"}
+	databasePath := db.path
+	db.path = path.Dir(databasePath)
+	db.usageFlushedAt = time.Time{}
+	r = requests.NewRequest()
+	r.Key.Payload = payloads[0]
+	r.Logger = zap.NewNop()
+	if err := db.LookupAPIKey(r); err != nil {
+		t.Fatalf("%s: unexpected error: %v", msgs[0], err)
+	}
+	db.path = databasePath
+	tests.EvalObjectsWithLog(t, "response code", 200, r.Response.Code, msgs)
+	tests.EvalObjectsWithLog(t, "use count", 4, usedKey.UseCount, msgs)
+}
+
+func TestDatabaseUserPublicKey(t *testing.T) {
+	var databasePath string
+	db, err := createTestDatabase("TestDatabaseUserPublicKey")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	databasePath = db.path
+	testcases := []struct {
+		name           string
+		operation      string
+		usage          string
+		overwriteUsage string
+		overwritePath  string
+		keyID          string
+		keyAlgorithm   string
+		pubKeyType     string
+		comment        string
+		username       string
+		email          string
+		want           map[string]interface{}
+		shouldErr      bool
+		err            error
+	}{
+		{
+			name:         "add disabled openssh public key",
+			operation:    "add",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			comment:      testEmail1,
+			username:     testUser1,
+			email:        testEmail1,
+			want: map[string]interface{}{
+				"key_count": 1,
+			},
+		},
+
+		{
+			name:         "add openssh public key",
+			operation:    "add",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			comment:      testEmail1,
+			username:     testUser1,
+			email:        testEmail1,
+			want: map[string]interface{}{
+				"key_count": 2,
+			},
+		},
+		{
+			name:         "add rsa public key",
+			operation:    "add",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			comment:      testEmail1,
+			username:     testUser1,
+			email:        testEmail1,
+			want: map[string]interface{}{
+				"key_count": 3,
+			},
+		},
+		{
+			name:      "delete all public keys",
+			operation: "delete",
+			username:  testUser1,
+			email:     testEmail1,
+			usage:     "ssh",
+			want: map[string]interface{}{
+				"key_count": 0,
+			},
+		},
+		{
+			name:         "readd rsa public key",
+			operation:    "add",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			comment:      testEmail1,
+			username:     testUser1,
+			email:        testEmail1,
+			want: map[string]interface{}{
+				"key_count": 1,
+			},
+		},
+		{
+			name:      "delete non-existing public key",
+			operation: "delete",
+			username:  testUser1,
+			email:     testEmail1,
+			usage:     "ssh",
+			keyID:     "foobar",
+			shouldErr: true,
+			err:       errors.ErrDeletePublicKey.WithArgs("foobar", "not found"),
+		},
+		{
+			name:         "add rsa public key with non-existing username",
+			operation:    "add",
+			username:     "foobar",
+			email:        "foobar@barfoo",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			shouldErr:    true,
+			err:          errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrDatabaseUserNotFound),
+		},
+		{
+			name:         "add rsa public key with mismatch user and email",
+			operation:    "add",
+			username:     testUser1,
+			email:        testEmail2,
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			shouldErr:    true,
+			err:          errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrDatabaseInvalidUser),
+		},
+		{
+			name:         "add rsa public key with non-existing email address",
+			operation:    "add",
+			username:     testUser1,
+			email:        "foobar@barfoo",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			shouldErr:    true,
+			err:          errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrDatabaseUserNotFound),
+		},
+		{
+			name:         "get public keys with non-existing email address",
+			operation:    "get",
+			username:     testUser1,
+			email:        "foobar@barfoo",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			pubKeyType:   "openssh",
+			shouldErr:    true,
+			err:          errors.ErrGetPublicKeys.WithArgs("ssh", errors.ErrDatabaseUserNotFound),
+		},
+
+		{
+			name:         "delete public key with non-existing email address",
+			operation:    "delete",
+			username:     testUser1,
+			email:        "foobar@barfoo",
+			usage:        "ssh",
+			keyAlgorithm: "rsa",
+			shouldErr:    true,
+			keyID:        "barfoo",
+			err:          errors.ErrDeletePublicKey.WithArgs("barfoo", errors.ErrDatabaseUserNotFound),
+		},
+		{
+			name:           "add invalid public key usage",
+			operation:      "add",
+			username:       testUser1,
+			email:          testEmail1,
+			usage:          "ssh",
+			overwriteUsage: "foobar",
+			keyAlgorithm:   "rsa",
+			pubKeyType:     "openssh",
+			shouldErr:      true,
+			err:            errors.ErrAddPublicKey.WithArgs("foobar", errors.ErrPublicKeyInvalidUsage.WithArgs("foobar")),
+		},
+		{
+			name:          "fail to commit when adding rsa public key",
+			operation:     "add",
+			usage:         "ssh",
+			keyAlgorithm:  "rsa",
+			pubKeyType:    "openssh",
+			comment:       testEmail1,
+			username:      testUser1,
+			email:         testEmail1,
+			overwritePath: path.Dir(databasePath),
+			shouldErr:     true,
+			err: errors.ErrAddPublicKey.WithArgs("ssh",
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+			),
+		},
+		{
+			name:          "fail to commit when deleting rsa public key",
+			operation:     "delete",
+			username:      testUser1,
+			email:         testEmail1,
+			usage:         "ssh",
+			overwritePath: path.Dir(databasePath),
+			shouldErr:     true,
+			err: errors.ErrDeletePublicKey.WithArgs("ssh",
+				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			db.path = databasePath
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			switch tc.operation {
+			case "add":
+				r := requests.NewRequest()
+				r.User.Username = tc.username
+				r.User.Email = tc.email
+				r.Key.Usage = tc.usage
+				r.Key.Comment = tc.comment
+				_, publicKey := tests.GetCryptoKeyPair(t, tc.keyAlgorithm, tc.pubKeyType)
+				r.Key.Payload = publicKey
+				if tc.overwriteUsage != "" {
+					r.Key.Usage = tc.overwriteUsage
+				}
+				if tc.overwritePath != "" {
+					db.path = tc.overwritePath
+				}
+				err = db.AddPublicKey(r)
+				if tests.EvalErrWithLog(t, err, "add public key", tc.shouldErr, tc.err, msgs) {
+					return
+				}
+			case "get":
+			case "delete":
+				r := requests.NewRequest()
+				r.User.Username = tc.username
+				r.User.Email = tc.email
+				r.Key.Usage = tc.usage
+				err = db.GetPublicKeys(r)
+				if tc.keyID != "" {
+					// Delete specific key.
+					r.Key.ID = tc.keyID
+					err = db.DeletePublicKey(r)
+					if tests.EvalErrWithLog(t, err, "delete public key by id", tc.shouldErr, tc.err, msgs) {
+						return
+					}
+					break
+				}
+				// Delete all keys.
+				if tc.overwritePath != "" {
+					db.path = tc.overwritePath
+				}
+				bundle := r.Response.Payload.(*PublicKeyBundle)
+				var arr []string
+				for _, k := range bundle.Get() {
+					arr = append(arr, k.ID)
+				}
+				for _, k := range arr {
+					r.Key.ID = k
+					err = db.DeletePublicKey(r)
+					if tests.EvalErrWithLog(t, err, "delete public key", tc.shouldErr, tc.err, msgs) {
+						return
+					}
+				}
+			case "":
+				t.Fatal("empty test operation")
+			default:
+				t.Fatalf("unsupported test operation: %s", tc.operation)
+			}
+
+			r := requests.NewRequest()
+			r.User.Username = tc.username
+			r.User.Email = tc.email
+			r.Key.Usage = tc.usage
+			err = db.GetPublicKeys(r)
+			if tests.EvalErrWithLog(t, err, "get public keys", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			bundle := r.Response.Payload.(*PublicKeyBundle)
+			got := make(map[string]interface{})
+			got["key_count"] = bundle.Size()
+			tests.EvalObjectsWithLog(t, "user", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseUserMfaToken(t *testing.T) {
+	var databasePath string
+	db, err := createTestDatabase("TestDatabaseUserMfaToken")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	databasePath = db.path
+	/*
+	   t.Logf("%v", db.path)
+	   for _, u := range db.Users {
+	           for _, n := range u.Names {
+	                   t.Logf("user %s, name: %v", u.Username, n)
+	           }
+	           for _, p := range u.Passwords {
+	                   t.Logf("user %s, password: %v", u.Username, p)
+	           }
+	   }
+	*/
 
+	testcases := []struct {
+		name          string
+		operation     string
+		req           *requests.Request
+		overwritePath string
+		want          map[string]interface{}
+		shouldErr     bool
+		err           error
+	}{
 		{
-			name:         "delete public key with non-existing email address",
-			operation:    "delete",
-			username:     testUser1,
-			email:        "foobar@barfoo",
-			usage:        "ssh",
-			keyAlgorithm: "rsa",
-			shouldErr:    true,
-			keyID:        "barfoo",
-			err:          errors.ErrDeletePublicKey.WithArgs("barfoo", errors.ErrDatabaseUserNotFound),
+			name:      "add disabled totp app token with sha1",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app 30",
+					Type:      "totp",
+					Secret:    "c71ca4c68bc14ec5b4ab8d3c3be02ddd2c",
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+					Disabled:  true,
+				},
+			},
+			want: map[string]interface{}{
+				"token_count": 0,
+			},
 		},
 		{
-			name:           "add invalid public key usage",
-			operation:      "add",
-			username:       testUser1,
-			email:          testEmail1,
-			usage:          "ssh",
-			overwriteUsage: "foobar",
-			keyAlgorithm:   "rsa",
-			pubKeyType:     "openssh",
-			shouldErr:      true,
-			err:            errors.ErrAddPublicKey.WithArgs("foobar", errors.ErrPublicKeyInvalidUsage.WithArgs("foobar")),
+			name:      "add totp app token with sha1",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app",
+					Type:      "totp",
+					Secret:    "c71ca4c68bc14ec5b4ab8d3c3b63802c",
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+				},
+			},
+			want: map[string]interface{}{
+				"token_count": 1,
+			},
+		},
+		{
+			name:      "remove all mfa tokens",
+			operation: "delete",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{},
+			},
+			want: map[string]interface{}{
+				"token_count": 0,
+			},
+		},
+		{
+			name:      "readd totp app token with sha1",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app",
+					Type:      "totp",
+					Secret:    "c71ca4c68bc14ec5b4ab8d3c3b63802c",
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+				},
+			},
+			want: map[string]interface{}{
+				"token_count": 1,
+			},
+		},
+		{
+			name:      "delete non-existing mfa token",
+			operation: "delete",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					ID: "foobar",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrDeleteMfaToken.WithArgs("foobar", "not found"),
+		},
+		{
+			name:      "add token with non-existing username",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foobar",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddMfaToken.WithArgs(errors.ErrDatabaseUserNotFound),
+		},
+		{
+			name:      "add token with duplicate secret",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app",
+					Type:      "totp",
+					Secret:    "c71ca4c68bc14ec5b4ab8d3c3b63802c",
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddMfaToken.WithArgs(errors.ErrDuplicateMfaTokenSecret),
+		},
+		{
+			name:      "add token with duplicate comment",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app",
+					Type:      "totp",
+					Secret:    "d71ca4c68bc14ec5b4ab8d3c3b63802c1",
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddMfaToken.WithArgs(errors.ErrDuplicateMfaTokenComment),
+		},
+
+		{
+			name:      "get tokens with mismatch user and email",
+			operation: "get",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail2,
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrGetMfaTokens.WithArgs(errors.ErrDatabaseInvalidUser),
 		},
+
 		{
-			name:          "fail to commit when adding rsa public key",
-			operation:     "add",
-			usage:         "ssh",
-			keyAlgorithm:  "rsa",
-			pubKeyType:    "openssh",
-			comment:       testEmail1,
-			username:      testUser1,
-			email:         testEmail1,
+			name:      "delete mfa token with mismatch user and email",
+			operation: "delete",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail2,
+				},
+				MfaToken: requests.MfaToken{
+					ID: "foobar",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrDeleteMfaToken.WithArgs("foobar", errors.ErrDatabaseInvalidUser),
+		},
+		{
+			name:      "fail to commit when adding mfa token",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					Comment:   "ms auth app 20",
+					Type:      "totp",
+					Secret:    "dd71ca4c68bc14ec5b4ab8d3c3b63802c",
+					Algorithm: "sha1",
+					Period:    30,
+					Digits:    6,
+				},
+			},
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
-			err: errors.ErrAddPublicKey.WithArgs("ssh",
+			err: errors.ErrAddMfaToken.WithArgs(
 				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
 		{
-			name:          "fail to commit when deleting rsa public key",
-			operation:     "delete",
-			username:      testUser1,
-			email:         testEmail1,
-			usage:         "ssh",
+			name:      "fail to commit when deleting mfa token",
+			operation: "delete",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+				MfaToken: requests.MfaToken{
+					ID: "zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa",
+				},
+			},
 			overwritePath: path.Dir(databasePath),
 			shouldErr:     true,
-			err: errors.ErrDeletePublicKey.WithArgs("ssh",
+			err: errors.ErrDeleteMfaToken.WithArgs("zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa",
 				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
 			),
 		},
@@ -762,52 +1945,50 @@ func TestDatabaseUserPublicKey(t *testing.T) {
 			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
 			switch tc.operation {
 			case "add":
-				r := requests.NewRequest()
-				r.User.Username = tc.username
-				r.User.Email = tc.email
-				r.Key.Usage = tc.usage
-				r.Key.Comment = tc.comment
-				_, publicKey := tests.GetCryptoKeyPair(t, tc.keyAlgorithm, tc.pubKeyType)
-				r.Key.Payload = publicKey
-				if tc.overwriteUsage != "" {
-					r.Key.Usage = tc.overwriteUsage
-				}
 				if tc.overwritePath != "" {
 					db.path = tc.overwritePath
 				}
-				err = db.AddPublicKey(r)
-				if tests.EvalErrWithLog(t, err, "add public key", tc.shouldErr, tc.err, msgs) {
+				if tc.req.MfaToken.Type == "totp" && tc.req.MfaToken.Passcode == "" {
+					if err := generateTestPasscode(tc.req, true); err != nil {
+						t.Fatalf("unexpected failure during passcode generation: %v", err)
+					}
+				}
+				err = db.AddMfaToken(tc.req)
+				if tests.EvalErrWithLog(t, err, "add mfa token", tc.shouldErr, tc.err, msgs) {
 					return
 				}
 			case "get":
 			case "delete":
-				r := requests.NewRequest()
-				r.User.Username = tc.username
-				r.User.Email = tc.email
-				r.Key.Usage = tc.usage
-				err = db.GetPublicKeys(r)
-				if tc.keyID != "" {
+				if tc.overwritePath != "" {
+					db.path = tc.overwritePath
+				}
+				err = db.GetMfaTokens(tc.req)
+				if tc.req.MfaToken.ID != "" {
 					// Delete specific key.
-					r.Key.ID = tc.keyID
-					err = db.DeletePublicKey(r)
-					if tests.EvalErrWithLog(t, err, "delete public key by id", tc.shouldErr, tc.err, msgs) {
+					if tc.req.MfaToken.ID == "zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa" {
+						user, err := db.getUser(tc.req.User.Username)
+						if err != nil {
+							t.Fatal(err)
+						}
+						token := user.MfaTokens[0]
+						token.ID = tc.req.MfaToken.ID
+					}
+					err = db.DeleteMfaToken(tc.req)
+					if tests.EvalErrWithLog(t, err, "delete mfa token by id", tc.shouldErr, tc.err, msgs) {
 						return
 					}
 					break
 				}
 				// Delete all keys.
-				if tc.overwritePath != "" {
-					db.path = tc.overwritePath
-				}
-				bundle := r.Response.Payload.(*PublicKeyBundle)
+				bundle := tc.req.Response.Payload.(*MfaTokenBundle)
 				var arr []string
 				for _, k := range bundle.Get() {
 					arr = append(arr, k.ID)
 				}
 				for _, k := range arr {
-					r.Key.ID = k
-					err = db.DeletePublicKey(r)
-					if tests.EvalErrWithLog(t, err, "delete public key", tc.shouldErr, tc.err, msgs) {
+					tc.req.MfaToken.ID = k
+					err = db.DeleteMfaToken(tc.req)
+					if tests.EvalErrWithLog(t, err, "delete mfa token", tc.shouldErr, tc.err, msgs) {
 						return
 					}
 				}
@@ -817,468 +1998,883 @@ func TestDatabaseUserPublicKey(t *testing.T) {
 				t.Fatalf("unsupported test operation: %s", tc.operation)
 			}
 
-			r := requests.NewRequest()
-			r.User.Username = tc.username
-			r.User.Email = tc.email
-			r.Key.Usage = tc.usage
-			err = db.GetPublicKeys(r)
-			if tests.EvalErrWithLog(t, err, "get public keys", tc.shouldErr, tc.err, msgs) {
+			err = db.GetMfaTokens(tc.req)
+			if tests.EvalErrWithLog(t, err, "get mfa tokens", tc.shouldErr, tc.err, msgs) {
 				return
 			}
-			bundle := r.Response.Payload.(*PublicKeyBundle)
+			bundle := tc.req.Response.Payload.(*MfaTokenBundle)
 			got := make(map[string]interface{})
-			got["key_count"] = bundle.Size()
-			tests.EvalObjectsWithLog(t, "user", tc.want, got, msgs)
+			got["token_count"] = bundle.Size()
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseGetUsers(t *testing.T) {
+	var databasePath string
+	db, err := createTestDatabase("TestDatabaseGetUsers")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	ts := time.Now()
+	databasePath = db.path
+	testcases := []struct {
+		name          string
+		operation     string
+		req           *requests.Request
+		overwritePath string
+		want          map[string]interface{}
+		shouldErr     bool
+		err           error
+	}{
+		{
+			name: "get users",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Email:    testEmail1,
+				},
+			},
+			want: map[string]interface{}{
+				"user_count": 2,
+				"users": []*UserMetadata{
+					{
+						ID:           "000000000000000000000000000000000001",
+						Type:         "human",
+						Username:     "jsmith",
+						Name:         "Smith, John",
+						Email:        "jsmith@gmail.com",
+						LastModified: ts,
+						Created:      ts,
+					},
+					{
+						ID:           "000000000000000000000000000000000002",
+						Type:         "human",
+						Username:     "bjones",
+						Email:        "bjones@gmail.com",
+						LastModified: ts,
+						Created:      ts,
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			db.path = databasePath
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+
+			err = db.GetUsers(tc.req)
+			if tests.EvalErrWithLog(t, err, "get users", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			bundle := tc.req.Response.Payload.(*UserMetadataBundle)
+			got := make(map[string]interface{})
+			got["user_count"] = bundle.Size()
+			users := bundle.Get()
+			for i, user := range users {
+				user.ID = fmt.Sprintf("%036d", i+1)
+				user.LastModified = ts
+				user.Created = ts
+			}
+			got["users"] = bundle.Get()
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabasePolicy(t *testing.T) {
+	var databasePath string
+	db, err := createTestDatabase("TestDatabasePolicy")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	databasePath = db.path
+	testcases := []struct {
+		name          string
+		operation     string
+		req           *requests.Request
+		overwritePath string
+		want          map[string]interface{}
+		shouldErr     bool
+		err           error
+	}{
+		{
+			name: "get username and password policies",
+			want: map[string]interface{}{
+				"username_policy": UserPolicy{
+					MinLength:            3,
+					MaxLength:            50,
+					AllowNonAlphaNumeric: false,
+					AllowUppercase:       false,
+					ReservedNames:        defaultPolicy.User.ReservedNames,
+				},
+				"password_policy": PasswordPolicy{
+					KeepVersions:           10,
+					MinLength:              8,
+					MaxLength:              128,
+					RequireUppercase:       false,
+					RequireLowercase:       false,
+					RequireNumber:          false,
+					RequireNonAlphaNumeric: false,
+					BlockReuse:             false,
+					BlockPasswordChange:    false,
+				},
+				"username_policy_summary": "A username should be 3-50 character long string with lowercase, alpha-numeric characters",
+				"username_policy_regex":   "^[a-z][a-z0-9]{2,49}$",
+				"password_policy_summary": "A password should be 8-128 character long string",
+				"password_policy_regex":   "^.{8,128}$",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.path = databasePath
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
+			got := make(map[string]interface{})
+			got["username_policy"] = db.Policy.User
+			got["password_policy"] = db.Policy.Password
+			got["username_policy_regex"] = db.GetUsernamePolicyRegex()
+			got["password_policy_regex"] = db.GetPasswordPolicyRegex()
+			got["username_policy_summary"] = db.GetUsernamePolicySummary()
+			got["password_policy_summary"] = db.GetPasswordPolicySummary()
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
 		})
 	}
 }
 
-func TestDatabaseUserMfaToken(t *testing.T) {
-	var databasePath string
-	db, err := createTestDatabase("TestDatabaseUserMfaToken")
+func TestDatabaseServiceAccounts(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseServiceAccounts")
 	if err != nil {
 		t.Fatalf("failed to create temp dir: %v", err)
 	}
-	databasePath = db.path
-	/*
-	   t.Logf("%v", db.path)
-	   for _, u := range db.Users {
-	           for _, n := range u.Names {
-	                   t.Logf("user %s, name: %v", u.Username, n)
-	           }
-	           for _, p := range u.Passwords {
-	                   t.Logf("user %s, password: %v", u.Username, p)
-	           }
-	   }
-	*/
-
 	testcases := []struct {
-		name          string
-		operation     string
-		req           *requests.Request
-		overwritePath string
-		want          map[string]interface{}
-		shouldErr     bool
-		err           error
+		name      string
+		req       *requests.Request
+		shouldErr bool
+		err       error
 	}{
 		{
-			name:      "add disabled totp app token with sha1",
-			operation: "add",
+			name: "add service account owned by user",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					Comment:   "ms auth app 30",
-					Type:      "totp",
-					Secret:    "c71ca4c68bc14ec5b4ab8d3c3be02ddd2c",
-					Algorithm: "sha1",
-					Period:    30,
-					Digits:    6,
-					Disabled:  true,
+					Username: "deployer",
+					Owner:    testEmail1,
+					Roles:    []string{"editor"},
 				},
 			},
-			want: map[string]interface{}{
-				"token_count": 0,
-			},
 		},
 		{
-			name:      "add totp app token with sha1",
-			operation: "add",
+			name: "add service account owned by group",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					Comment:   "ms auth app",
-					Type:      "totp",
-					Secret:    "c71ca4c68bc14ec5b4ab8d3c3b63802c",
-					Algorithm: "sha1",
-					Period:    30,
-					Digits:    6,
+					Username:   "backup",
+					OwnerGroup: "ops",
 				},
 			},
-			want: map[string]interface{}{
-				"token_count": 1,
-			},
 		},
 		{
-			name:      "remove all mfa tokens",
-			operation: "delete",
+			name: "add service account with role not assigned to owner",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
+					Username: "reporter",
+					Owner:    testUser2,
+					Roles:    []string{"admin"},
 				},
-				MfaToken: requests.MfaToken{},
-			},
-			want: map[string]interface{}{
-				"token_count": 0,
 			},
+			shouldErr: true,
+			err: errors.ErrAddServiceAccount.WithArgs("reporter",
+				errors.ErrServiceAccountRoleNotAssigned.WithArgs("admin", testUser2),
+			),
 		},
 		{
-			name:      "readd totp app token with sha1",
-			operation: "add",
+			name: "add service account owned by service account",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					Comment:   "ms auth app",
-					Type:      "totp",
-					Secret:    "c71ca4c68bc14ec5b4ab8d3c3b63802c",
-					Algorithm: "sha1",
-					Period:    30,
-					Digits:    6,
+					Username: "reporter",
+					Owner:    "backup",
 				},
 			},
-			want: map[string]interface{}{
-				"token_count": 1,
-			},
+			shouldErr: true,
+			err: errors.ErrAddServiceAccount.WithArgs("reporter",
+				errors.ErrServiceAccountOwnerInvalid.WithArgs("backup"),
+			),
 		},
 		{
-			name:      "delete non-existing mfa token",
-			operation: "delete",
+			name: "add service account owned by unknown user",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					ID: "foobar",
+					Username: "reporter",
+					Owner:    "foobar",
 				},
 			},
 			shouldErr: true,
-			err:       errors.ErrDeleteMfaToken.WithArgs("foobar", "not found"),
+			err: errors.ErrAddServiceAccount.WithArgs("reporter",
+				errors.ErrServiceAccountOwnerNotFound,
+			),
 		},
 		{
-			name:      "add token with non-existing username",
-			operation: "add",
+			name: "add service account owned by both user and group",
 			req: &requests.Request{
 				User: requests.User{
-					Username: "foobar",
-					Email:    "foobar@barfoo",
+					Username:   "reporter",
+					Owner:      testUser1,
+					OwnerGroup: "ops",
 				},
 			},
 			shouldErr: true,
-			err:       errors.ErrAddMfaToken.WithArgs(errors.ErrDatabaseUserNotFound),
+			err: errors.ErrAddServiceAccount.WithArgs("reporter",
+				errors.ErrServiceAccountOwnerAmbiguous,
+			),
 		},
 		{
-			name:      "add token with duplicate secret",
-			operation: "add",
+			name: "add service account without owner",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					Comment:   "ms auth app",
-					Type:      "totp",
-					Secret:    "c71ca4c68bc14ec5b4ab8d3c3b63802c",
-					Algorithm: "sha1",
-					Period:    30,
-					Digits:    6,
+					Username: "reporter",
 				},
 			},
 			shouldErr: true,
-			err:       errors.ErrAddMfaToken.WithArgs(errors.ErrDuplicateMfaTokenSecret),
+			err: errors.ErrAddServiceAccount.WithArgs("reporter",
+				errors.ErrServiceAccountOwnerAmbiguous,
+			),
 		},
 		{
-			name:      "add token with duplicate comment",
-			operation: "add",
+			name: "add service account with existing username",
 			req: &requests.Request{
 				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					Comment:   "ms auth app",
-					Type:      "totp",
-					Secret:    "d71ca4c68bc14ec5b4ab8d3c3b63802c1",
-					Algorithm: "sha1",
-					Period:    30,
-					Digits:    6,
+					Username:   testUser2,
+					OwnerGroup: "ops",
 				},
 			},
 			shouldErr: true,
-			err:       errors.ErrAddMfaToken.WithArgs(errors.ErrDuplicateMfaTokenComment),
+			err:       errors.ErrAddServiceAccount.WithArgs(testUser2, "username already in use"),
 		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			err := db.AddServiceAccount(tc.req)
+			tests.EvalErrWithLog(t, err, "add service account", tc.shouldErr, tc.err, msgs)
+		})
+	}
+
+	// The service accounts are listed with the type of service.
+	listReq := &requests.Request{User: requests.User{Username: testUser1, Email: testEmail1}}
+	if err := db.GetUsers(listReq); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, m := range listReq.Response.Payload.(*UserMetadataBundle).Get() {
+		got[m.Username] = m.Type + "/" + m.Owner
+	}
+	tests.EvalObjectsWithLog(t, "listing", map[string]string{
+		testUser1:  "human/",
+		testUser2:  "human/",
+		"deployer": "service/" + testUser1,
+		"backup":   "service/ops",
+	}, got, []string{"test name: list users"})
+
+	// The service accounts authenticate with API keys.
+	keyReq := &requests.Request{
+		User: requests.User{Username: "deployer"},
+		Key:  requests.Key{Usage: "api", Comment: "deploy", Roles: []string{"editor"}},
+	}
+	if err := db.AddAPIKey(keyReq); err != nil {
+		t.Fatal(err)
+	}
+	lookupReq := requests.NewRequest()
+	lookupReq.Key.Payload = keyReq.Response.Payload.(string)
+	if err := db.LookupAPIKey(lookupReq); err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "lookup", []string{"deployer", "editor"},
+		[]string{lookupReq.User.Username, strings.Join(lookupReq.User.Roles, ",")},
+		[]string{"test name: lookup service account api key"},
+	)
+
+	// The service accounts cannot have MFA tokens.
+	mfaReq := &requests.Request{User: requests.User{Username: "deployer"}}
+	tests.EvalErrWithLog(t, db.AddMfaToken(mfaReq), "add mfa token", true,
+		errors.ErrAddMfaToken.WithArgs(errors.ErrServiceAccountMfaToken),
+		[]string{"test name: add mfa token to service account"},
+	)
+
+	// The service accounts are excluded from interactive login.
+	authReq := &requests.Request{User: requests.User{Username: "deployer", Password: "foobar"}}
+	tests.EvalErrWithLog(t, db.AuthenticateUser(authReq), "authenticate", true,
+		errors.ErrAuthFailed.WithArgs(errors.ErrServiceAccountInteractiveLogin.WithArgs("deployer")),
+		[]string{"test name: authenticate service account"},
+	)
+	identifyReq := &requests.Request{User: requests.User{Username: "deployer"}}
+	if err := db.IdentifyUser(identifyReq); err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "identify", "nobody", identifyReq.User.Username,
+		[]string{"test name: identify service account"},
+	)
+
+	// The owner name follows the username changes.
+	renameReq := &requests.Request{User: requests.User{OldUsername: testUser1, Username: "johnsmith", Email: testEmail1}}
+	if err := db.ChangeUsername(renameReq); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service accounts survive the database reload.
+	db, err = NewDatabase(db.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := db.getUser("deployer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "reload", "service/johnsmith", account.GetType()+"/"+account.Owner.Name,
+		[]string{"test name: reload service account"},
+	)
+}
+
+func TestDatabaseCredentialStatus(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseCredentialStatus")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user := requests.User{Username: testUser1, Email: testEmail1}
+	apiKeyReq := &requests.Request{User: user, Key: requests.Key{Usage: "api", Comment: "ci"}}
+	if err := db.AddAPIKey(apiKeyReq); err != nil {
+		t.Fatal(err)
+	}
+	apiKeyID := apiKeyReq.Key.ID
+	apiKeyPayload := apiKeyReq.Response.Payload.(string)
+	_, publicKey := tests.GetCryptoKeyPair(t, "rsa", "openssh")
+	if err := db.AddPublicKey(&requests.Request{User: user, Key: requests.Key{Usage: "ssh", Payload: publicKey}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"ms auth app", "google auth app"} {
+		mfaReq := &requests.Request{
+			User: user,
+			MfaToken: requests.MfaToken{
+				Comment:   comment,
+				Type:      "totp",
+				Secret:    NewRandomString(32),
+				Algorithm: "sha1",
+				Period:    30,
+				Digits:    6,
+			},
+		}
+		if err := generateTestPasscode(mfaReq, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddMfaToken(mfaReq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// getCredential returns the count of enabled credentials of a kind and
+	// the first credential of the kind, including disabled ones.
+	getCredential := func(kind string) (int, string, bool, string) {
+		r := &requests.Request{User: user, Key: requests.Key{Usage: kind}}
+		var count int
+		for _, includeDisabled := range []bool{false, true} {
+			r.Flags.IncludeDisabled = includeDisabled
+			switch kind {
+			case "api":
+				if err := db.GetAPIKeys(r); err != nil {
+					t.Fatal(err)
+				}
+				bundle := r.Response.Payload.(*APIKeyBundle)
+				if !includeDisabled {
+					count = bundle.Size()
+					continue
+				}
+				k := bundle.Get()[0]
+				return count, k.ID, k.Disabled, k.Comment
+			case "ssh":
+				if err := db.GetPublicKeys(r); err != nil {
+					t.Fatal(err)
+				}
+				bundle := r.Response.Payload.(*PublicKeyBundle)
+				if !includeDisabled {
+					count = bundle.Size()
+					continue
+				}
+				k := bundle.Get()[0]
+				return count, k.ID, k.Disabled, k.Comment
+			case "mfa":
+				if err := db.GetMfaTokens(r); err != nil {
+					t.Fatal(err)
+				}
+				bundle := r.Response.Payload.(*MfaTokenBundle)
+				if !includeDisabled {
+					count = bundle.Size()
+					continue
+				}
+				k := bundle.Get()[0]
+				return count, k.ID, k.Disabled, k.Comment
+			}
+		}
+		return 0, "", false, ""
+	}
+	_, publicKeyID, _, _ := getCredential("ssh")
+	_, mfaTokenID, _, _ := getCredential("mfa")
 
+	testcases := []struct {
+		name      string
+		operation string
+		kind      string
+		id        string
+		comment   string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
 		{
-			name:      "get tokens with mismatch user and email",
-			operation: "get",
-			req: &requests.Request{
-				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail2,
-				},
+			name:      "disable api key",
+			operation: "disable",
+			kind:      "api",
+			want: map[string]interface{}{
+				"count":    0,
+				"disabled": true,
+				"comment":  "ci",
+				"lookup":   errors.ErrLookupAPIKeyDisabled.Error(),
 			},
-			shouldErr: true,
-			err:       errors.ErrGetMfaTokens.WithArgs(errors.ErrDatabaseInvalidUser),
 		},
-
 		{
-			name:      "delete mfa token with mismatch user and email",
-			operation: "delete",
-			req: &requests.Request{
-				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail2,
-				},
-				MfaToken: requests.MfaToken{
-					ID: "foobar",
-				},
+			name:      "update comment of disabled api key",
+			operation: "update",
+			kind:      "api",
+			comment:   "ci (suspended)",
+			want: map[string]interface{}{
+				"count":    0,
+				"disabled": true,
+				"comment":  "ci (suspended)",
+				"lookup":   errors.ErrLookupAPIKeyDisabled.Error(),
+			},
+		},
+		{
+			name:      "enable api key",
+			operation: "enable",
+			kind:      "api",
+			want: map[string]interface{}{
+				"count":    1,
+				"disabled": false,
+				"comment":  "ci (suspended)",
+				"lookup":   "",
 			},
+		},
+		{
+			name:      "update api key with empty comment",
+			operation: "update",
+			kind:      "api",
 			shouldErr: true,
-			err:       errors.ErrDeleteMfaToken.WithArgs("foobar", errors.ErrDatabaseInvalidUser),
+			err:       errors.ErrUpdateAPIKey.WithArgs(apiKeyID, errors.ErrAPIKeyCommentEmpty),
 		},
 		{
-			name:      "fail to commit when adding mfa token",
-			operation: "add",
-			req: &requests.Request{
-				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					Comment:   "ms auth app 20",
-					Type:      "totp",
-					Secret:    "dd71ca4c68bc14ec5b4ab8d3c3b63802c",
-					Algorithm: "sha1",
-					Period:    30,
-					Digits:    6,
-				},
+			name:      "disable unknown api key",
+			operation: "disable",
+			kind:      "api",
+			id:        "foobar",
+			shouldErr: true,
+			err:       errors.ErrDisableAPIKey.WithArgs("foobar", "not found"),
+		},
+		{
+			name:      "disable ssh key",
+			operation: "disable",
+			kind:      "ssh",
+			want: map[string]interface{}{
+				"count":    0,
+				"disabled": true,
+				"comment":  "",
 			},
-			overwritePath: path.Dir(databasePath),
-			shouldErr:     true,
-			err: errors.ErrAddMfaToken.WithArgs(
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
-			),
 		},
 		{
-			name:      "fail to commit when deleting mfa token",
-			operation: "delete",
-			req: &requests.Request{
-				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
-				MfaToken: requests.MfaToken{
-					ID: "zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa",
-				},
+			name:      "enable ssh key",
+			operation: "enable",
+			kind:      "ssh",
+			want: map[string]interface{}{
+				"count":    1,
+				"disabled": false,
+				"comment":  "",
+			},
+		},
+		{
+			name:      "update comment of ssh key",
+			operation: "update",
+			kind:      "ssh",
+			comment:   "laptop",
+			want: map[string]interface{}{
+				"count":    1,
+				"disabled": false,
+				"comment":  "laptop",
+			},
+		},
+		{
+			name:      "disable mfa token",
+			operation: "disable",
+			kind:      "mfa",
+			want: map[string]interface{}{
+				"count":    1,
+				"disabled": true,
+				"comment":  "ms auth app",
+			},
+		},
+		{
+			name:      "update mfa token with duplicate comment",
+			operation: "update",
+			kind:      "mfa",
+			comment:   "google auth app",
+			shouldErr: true,
+			err:       errors.ErrUpdateMfaToken.WithArgs(mfaTokenID, errors.ErrDuplicateMfaTokenComment),
+		},
+		{
+			name:      "enable mfa token",
+			operation: "enable",
+			kind:      "mfa",
+			want: map[string]interface{}{
+				"count":    2,
+				"disabled": false,
+				"comment":  "ms auth app",
 			},
-			overwritePath: path.Dir(databasePath),
-			shouldErr:     true,
-			err: errors.ErrDeleteMfaToken.WithArgs("zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa",
-				errors.ErrDatabaseCommit.WithArgs(path.Dir(databasePath), "open "+path.Dir(databasePath)+": is a directory"),
-			),
 		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
 			var err error
-			db.path = databasePath
 			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
-			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
-			switch tc.operation {
-			case "add":
-				if tc.overwritePath != "" {
-					db.path = tc.overwritePath
-				}
-				if tc.req.MfaToken.Type == "totp" && tc.req.MfaToken.Passcode == "" {
-					if err := generateTestPasscode(tc.req, true); err != nil {
-						t.Fatalf("unexpected failure during passcode generation: %v", err)
-					}
-				}
-				err = db.AddMfaToken(tc.req)
-				if tests.EvalErrWithLog(t, err, "add mfa token", tc.shouldErr, tc.err, msgs) {
-					return
-				}
-			case "get":
-			case "delete":
-				if tc.overwritePath != "" {
-					db.path = tc.overwritePath
-				}
-				err = db.GetMfaTokens(tc.req)
-				if tc.req.MfaToken.ID != "" {
-					// Delete specific key.
-					if tc.req.MfaToken.ID == "zzzzzzzzzzzzzzzzzzzzzzzzzz5h3s765Tpx5Laa" {
-						user, err := db.getUser(tc.req.User.Username)
-						if err != nil {
-							t.Fatal(err)
-						}
-						token := user.MfaTokens[0]
-						token.ID = tc.req.MfaToken.ID
-					}
-					err = db.DeleteMfaToken(tc.req)
-					if tests.EvalErrWithLog(t, err, "delete mfa token by id", tc.shouldErr, tc.err, msgs) {
-						return
-					}
-					break
-				}
-				// Delete all keys.
-				bundle := tc.req.Response.Payload.(*MfaTokenBundle)
-				var arr []string
-				for _, k := range bundle.Get() {
-					arr = append(arr, k.ID)
-				}
-				for _, k := range arr {
-					tc.req.MfaToken.ID = k
-					err = db.DeleteMfaToken(tc.req)
-					if tests.EvalErrWithLog(t, err, "delete mfa token", tc.shouldErr, tc.err, msgs) {
-						return
-					}
-				}
-			case "":
-				t.Fatal("empty test operation")
-			default:
-				t.Fatalf("unsupported test operation: %s", tc.operation)
+			r := &requests.Request{User: user}
+			switch tc.kind {
+			case "api":
+				r.Key = requests.Key{ID: apiKeyID, Comment: tc.comment}
+			case "ssh":
+				r.Key = requests.Key{ID: publicKeyID, Comment: tc.comment}
+			case "mfa":
+				r.MfaToken = requests.MfaToken{ID: mfaTokenID, Comment: tc.comment}
 			}
-
-			err = db.GetMfaTokens(tc.req)
-			if tests.EvalErrWithLog(t, err, "get mfa tokens", tc.shouldErr, tc.err, msgs) {
+			if tc.id != "" {
+				r.Key.ID = tc.id
+			}
+			switch tc.kind + "/" + tc.operation {
+			case "api/disable":
+				err = db.DisableAPIKey(r)
+			case "api/enable":
+				err = db.EnableAPIKey(r)
+			case "api/update":
+				err = db.UpdateAPIKey(r)
+			case "ssh/disable":
+				err = db.DisablePublicKey(r)
+			case "ssh/enable":
+				err = db.EnablePublicKey(r)
+			case "ssh/update":
+				err = db.UpdatePublicKey(r)
+			case "mfa/disable":
+				err = db.DisableMfaToken(r)
+			case "mfa/enable":
+				err = db.EnableMfaToken(r)
+			case "mfa/update":
+				err = db.UpdateMfaToken(r)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation, tc.shouldErr, tc.err, msgs) {
 				return
 			}
-			bundle := tc.req.Response.Payload.(*MfaTokenBundle)
 			got := make(map[string]interface{})
-			got["token_count"] = bundle.Size()
+			got["count"], _, got["disabled"], got["comment"] = getCredential(tc.kind)
+			if tc.kind == "api" {
+				lookupReq := requests.NewRequest()
+				lookupReq.Key.Payload = apiKeyPayload
+				got["lookup"] = ""
+				if err := db.LookupAPIKey(lookupReq); err != nil {
+					got["lookup"] = err.Error()
+				}
+			}
 			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
 		})
 	}
+
+	// The keys disabled with Disable expire and cannot be re-enabled.
+	db.Users[0].APIKeys[0].Disable()
+	err = db.EnableAPIKey(&requests.Request{User: user, Key: requests.Key{ID: apiKeyID}})
+	tests.EvalErrWithLog(t, err, "enable", true,
+		errors.ErrEnableAPIKey.WithArgs(apiKeyID, errors.ErrCredentialExpired),
+		[]string{"test name: enable expired api key"},
+	)
 }
 
-func TestDatabaseGetUsers(t *testing.T) {
-	var databasePath string
-	db, err := createTestDatabase("TestDatabaseGetUsers")
+func TestDatabaseLookupPublicKey(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseLookupPublicKey")
 	if err != nil {
 		t.Fatalf("failed to create temp dir: %v", err)
 	}
-	ts := time.Now()
-	databasePath = db.path
+	user1 := requests.User{Username: testUser1, Email: testEmail1}
+	user2 := requests.User{Username: testUser2, Email: testEmail2}
+	sshPayload := readPEMFile("testdata/ssh/jsmith_ed25519.pub")
+	gpgPayload := readPEMFile("testdata/gpg/jsmith_gpg_pub.pem")
+	for _, k := range []requests.Key{
+		{Usage: "ssh", Payload: sshPayload},
+		{Usage: "gpg", Payload: gpgPayload},
+	} {
+		if err := db.AddPublicKey(&requests.Request{User: user1, Key: k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, _ := db.getUser(testUser1)
+	sshKey := u.PublicKeys[len(u.PublicKeys)-2]
+	gpgKey := u.PublicKeys[len(u.PublicKeys)-1]
+
+	// The same key cannot be registered by another user.
+	err = db.AddPublicKey(&requests.Request{User: user2, Key: requests.Key{Usage: "ssh", Payload: sshPayload}})
+	tests.EvalErrWithLog(t, err, "add public key", true,
+		errors.ErrAddPublicKey.WithArgs("ssh", errors.ErrPublicKeyRegistered.WithArgs(sshKey.Fingerprint)),
+		[]string{"test name: add public key registered by another user"},
+	)
+
+	// The index is rebuilt when the database is loaded.
+	db, err = NewDatabase(db.GetPath())
+	if err != nil {
+		t.Fatalf("failed to load database: %v", err)
+	}
+
 	testcases := []struct {
-		name          string
-		operation     string
-		req           *requests.Request
-		overwritePath string
-		want          map[string]interface{}
-		shouldErr     bool
-		err           error
+		name      string
+		key       requests.Key
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
 	}{
 		{
-			name: "get users",
-			req: &requests.Request{
-				User: requests.User{
-					Username: testUser1,
-					Email:    testEmail1,
-				},
+			name: "test lookup ssh key by fingerprint",
+			key:  requests.Key{Fingerprint: sshKey.Fingerprint},
+			want: map[string]interface{}{
+				"username": testUser1,
+				"email":    testEmail1,
+				"key_id":   sshKey.ID,
+				"usage":    "ssh",
 			},
+		},
+		{
+			name: "test lookup ssh key by payload",
+			key:  requests.Key{Usage: "ssh", Payload: sshPayload},
 			want: map[string]interface{}{
-				"user_count": 2,
-				"users": []*UserMetadata{
-					{
-						ID:           "000000000000000000000000000000000001",
-						Username:     "jsmith",
-						Name:         "Smith, John",
-						Email:        "jsmith@gmail.com",
-						LastModified: ts,
-						Created:      ts,
-					},
-					{
-						ID:           "000000000000000000000000000000000002",
-						Username:     "bjones",
-						Email:        "bjones@gmail.com",
-						LastModified: ts,
-						Created:      ts,
-					},
-				},
+				"username": testUser1,
+				"email":    testEmail1,
+				"key_id":   sshKey.ID,
+				"usage":    "ssh",
+			},
+		},
+		{
+			name: "test lookup gpg key by formatted fingerprint",
+			key:  requests.Key{Fingerprint: "3B24 00A9 072E 8F8A 49BA  7AD8 D58F AEC8 BB7D 2AA5"},
+			want: map[string]interface{}{
+				"username": testUser1,
+				"email":    testEmail1,
+				"key_id":   gpgKey.ID,
+				"usage":    "gpg",
 			},
 		},
+		{
+			name:      "test lookup unknown key",
+			key:       requests.Key{Fingerprint: "foobar"},
+			shouldErr: true,
+			err:       errors.ErrLookupPublicKey.WithArgs("not found"),
+		},
+		{
+			name:      "test lookup without payload and fingerprint",
+			shouldErr: true,
+			err:       errors.ErrLookupPublicKeyEmptyPayload,
+		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			var err error
-			db.path = databasePath
 			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
-			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
-
-			err = db.GetUsers(tc.req)
-			if tests.EvalErrWithLog(t, err, "get users", tc.shouldErr, tc.err, msgs) {
+			r := &requests.Request{Key: tc.key}
+			err := db.LookupPublicKey(r)
+			if tests.EvalErrWithLog(t, err, "lookup", tc.shouldErr, tc.err, msgs) {
 				return
 			}
-			bundle := tc.req.Response.Payload.(*UserMetadataBundle)
 			got := make(map[string]interface{})
-			got["user_count"] = bundle.Size()
-			users := bundle.Get()
-			for i, user := range users {
-				user.ID = fmt.Sprintf("%036d", i+1)
-				user.LastModified = ts
-				user.Created = ts
-			}
-			got["users"] = bundle.Get()
-			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+			got["username"] = r.User.Username
+			got["email"] = r.User.Email
+			got["key_id"] = r.Key.ID
+			got["usage"] = r.Key.Usage
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
 		})
 	}
+
+	// The deleted key can be registered by another user.
+	if err := db.DeletePublicKey(&requests.Request{User: user1, Key: requests.Key{ID: sshKey.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddPublicKey(&requests.Request{User: user2, Key: requests.Key{Usage: "ssh", Payload: sshPayload}}); err != nil {
+		t.Fatal(err)
+	}
+	r := &requests.Request{Key: requests.Key{Fingerprint: strings.TrimPrefix(sshKey.Fingerprint, "SHA256:")}}
+	if err := db.LookupPublicKey(r); err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "owner", testUser2, r.User.Username, []string{"test name: lookup re-registered key"})
+
+	// The key registered by more than one user is indexed by the first user
+	// when the database is loaded, and the other registrations are reported.
+	u, _ = db.getUser(testUser1)
+	if err := u.AddPublicKey(&requests.Request{Key: requests.Key{Usage: "ssh", Payload: sshPayload}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDatabase(db.GetPath())
+	if err != nil {
+		t.Fatalf("failed to load database with duplicate public key: %v", err)
+	}
+	msgs := []string{"test name: load public key registered by more than one user"}
+	r = &requests.Request{Key: requests.Key{Fingerprint: sshKey.Fingerprint}}
+	if err := db.LookupPublicKey(r); err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "owner", testUser1, r.User.Username, msgs)
+	entries, err := db.GetNonCompliantPublicKeys(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, entry := range entries {
+		got = append(got, entry.Username+": "+entry.Violation)
+	}
+	tests.EvalObjectsWithLog(t, "report", []string{
+		testUser2 + ": " + errors.ErrPublicKeyRegistered.WithArgs(sshKey.Fingerprint).Error(),
+	}, got, msgs)
 }
 
-func TestDatabasePolicy(t *testing.T) {
-	var databasePath string
-	db, err := createTestDatabase("TestDatabasePolicy")
+func TestDatabasePublicKeyPolicy(t *testing.T) {
+	db, err := createTestDatabase("TestDatabasePublicKeyPolicy")
 	if err != nil {
 		t.Fatalf("failed to create temp dir: %v", err)
 	}
-	databasePath = db.path
+	user1 := requests.User{Username: testUser1, Email: testEmail1}
+	rsaPayload := readPEMFile("testdata/ssh/jsmith_rsa.pub")
+	ed25519Payload := readPEMFile("testdata/ssh/jsmith_ed25519.pub")
+	gpgPayload := readPEMFile("testdata/gpg/jsmith_gpg_pub.pem")
+
 	testcases := []struct {
-		name          string
-		operation     string
-		req           *requests.Request
-		overwritePath string
-		want          map[string]interface{}
-		shouldErr     bool
-		err           error
+		name      string
+		policy    PublicKeyPolicy
+		key       requests.Key
+		shouldErr bool
+		err       error
 	}{
 		{
-			name: "get username and password policies",
-			want: map[string]interface{}{
-				"username_policy": UserPolicy{
-					MinLength:            3,
-					MaxLength:            50,
-					AllowNonAlphaNumeric: false,
-					AllowUppercase:       false,
-				},
-				"password_policy": PasswordPolicy{
-					KeepVersions:           10,
-					MinLength:              8,
-					MaxLength:              128,
-					RequireUppercase:       false,
-					RequireLowercase:       false,
-					RequireNumber:          false,
-					RequireNonAlphaNumeric: false,
-					BlockReuse:             false,
-					BlockPasswordChange:    false,
-				},
-				"username_policy_summary": "A username should be 3-50 character long string with lowercase, alpha-numeric characters",
-				"username_policy_regex":   "^[a-z][a-z0-9]{2,49}$",
-				"password_policy_summary": "A password should be 8-128 character long string",
-				"password_policy_regex":   "^.{8,128}$",
+			name:      "test add rsa key shorter than minimum size",
+			policy:    PublicKeyPolicy{MinRSABits: 3072},
+			key:       requests.Key{Usage: "ssh", Payload: rsaPayload},
+			shouldErr: true,
+			err: errors.ErrAddPublicKey.WithArgs("ssh",
+				errors.ErrPublicKeyPolicyRSABits.WithArgs(2048, 3072),
+			),
+		},
+		{
+			name:      "test add gpg key with rsa subkeys shorter than minimum size",
+			policy:    PublicKeyPolicy{MinRSABits: 4096},
+			key:       requests.Key{Usage: "gpg", Payload: gpgPayload},
+			shouldErr: true,
+			err: errors.ErrAddPublicKey.WithArgs("gpg",
+				errors.ErrPublicKeyPolicyRSABits.WithArgs(2048, 4096),
+			),
+		},
+		{
+			name:      "test add key of disallowed type",
+			policy:    PublicKeyPolicy{AllowedTypes: []string{"ed25519", "ecdsa"}},
+			key:       requests.Key{Usage: "ssh", Payload: rsaPayload},
+			shouldErr: true,
+			err: errors.ErrAddPublicKey.WithArgs("ssh",
+				errors.ErrPublicKeyPolicyType.WithArgs("rsa"),
+			),
+		},
+		{
+			name:      "test add key of disallowed algorithm",
+			policy:    PublicKeyPolicy{AllowedAlgorithms: []string{"sk-ssh-ed25519@openssh.com"}},
+			key:       requests.Key{Usage: "ssh", Payload: ed25519Payload},
+			shouldErr: true,
+			err: errors.ErrAddPublicKey.WithArgs("ssh",
+				errors.ErrPublicKeyPolicyAlgorithm.WithArgs("ssh-ed25519"),
+			),
+		},
+		{
+			name:      "test add gpg key older than maximum age",
+			policy:    PublicKeyPolicy{MaxAge: 1},
+			key:       requests.Key{Usage: "gpg", Payload: gpgPayload},
+			shouldErr: true,
+			err: errors.ErrAddPublicKey.WithArgs("gpg",
+				errors.ErrPublicKeyPolicyMaxAge.WithArgs(time.Unix(1792354667, 0).UTC(), 1),
+			),
+		},
+		{
+			name: "test add compliant key",
+			policy: PublicKeyPolicy{
+				MinRSABits:        3072,
+				AllowedTypes:      []string{"RSA", "ED25519"},
+				AllowedAlgorithms: []string{"ssh-ed25519", "ssh-rsa"},
+				MaxAge:            3600,
 			},
+			key: requests.Key{Usage: "ssh", Payload: ed25519Payload},
+		},
+		{
+			name:   "test add rsa key without policy",
+			policy: PublicKeyPolicy{},
+			key:    requests.Key{Usage: "ssh", Payload: rsaPayload},
 		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			db.path = databasePath
 			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
-			msgs = append(msgs, fmt.Sprintf("database path: %s", db.path))
-			got := make(map[string]interface{})
-			got["username_policy"] = db.Policy.User
-			got["password_policy"] = db.Policy.Password
-			got["username_policy_regex"] = db.GetUsernamePolicyRegex()
-			got["password_policy_regex"] = db.GetPasswordPolicyRegex()
-			got["username_policy_summary"] = db.GetUsernamePolicySummary()
-			got["password_policy_summary"] = db.GetPasswordPolicySummary()
-			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+			db.Policy.PublicKey = tc.policy
+			err := db.AddPublicKey(&requests.Request{User: user1, Key: tc.key})
+			if tests.EvalErrWithLog(t, err, "add public key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
 		})
 	}
+
+	// The keys added before the policy change are reported and suspended.
+	db.Policy.PublicKey = PublicKeyPolicy{MinRSABits: 3072}
+	u, _ := db.getUser(testUser1)
+	rsaKey := u.PublicKeys[len(u.PublicKeys)-1]
+	for _, disable := range []bool{false, true} {
+		msgs := []string{fmt.Sprintf("test name: get non-compliant public keys, disable: %t", disable)}
+		entries, err := db.GetNonCompliantPublicKeys(disable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]interface{})
+		for _, entry := range entries {
+			got[entry.ID] = map[string]interface{}{
+				"username":  entry.Username,
+				"type":      entry.Type,
+				"violation": entry.Violation,
+				"disabled":  entry.Disabled,
+			}
+		}
+		want := map[string]interface{}{
+			rsaKey.ID: map[string]interface{}{
+				"username":  testUser1,
+				"type":      "ssh-rsa",
+				"violation": errors.ErrPublicKeyPolicyRSABits.WithArgs(2048, 3072).Error(),
+				"disabled":  disable,
+			},
+		}
+		tests.EvalObjectsWithLog(t, "report", want, got, msgs)
+	}
+
+	// The suspended key cannot be re-enabled while it violates the policy.
+	r := &requests.Request{User: user1, Key: requests.Key{ID: rsaKey.ID}}
+	err = db.EnablePublicKey(r)
+	tests.EvalErrWithLog(t, err, "enable public key", true,
+		errors.ErrEnablePublicKey.WithArgs(rsaKey.ID, errors.ErrPublicKeyPolicyRSABits.WithArgs(2048, 3072)),
+		[]string{"test name: enable non-compliant public key"},
+	)
+	db.Policy.PublicKey = PublicKeyPolicy{}
+	if err := db.EnablePublicKey(r); err != nil {
+		t.Fatal(err)
+	}
 }
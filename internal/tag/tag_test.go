@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/greenpau/go-identity"
 	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/apikey"
 	"github.com/greenpau/go-identity/pkg/qr"
 	"github.com/greenpau/go-identity/pkg/requests"
 	"os"
@@ -138,6 +139,10 @@ func TestTagCompliance(t *testing.T) {
 			name:  "test Password struct",
 			entry: &identity.Password{},
 		},
+		{
+			name:  "test PasswordPeppers struct",
+			entry: &identity.PasswordPeppers{},
+		},
 		{
 			name:  "test PublicKey struct",
 			entry: &identity.PublicKey{},
@@ -146,6 +151,22 @@ func TestTagCompliance(t *testing.T) {
 			name:  "test PublicKeyBundle struct",
 			entry: &identity.PublicKeyBundle{},
 		},
+		{
+			name:  "test PublicKeyIdentity struct",
+			entry: &identity.PublicKeyIdentity{},
+		},
+		{
+			name:  "test PublicSubkey struct",
+			entry: &identity.PublicSubkey{},
+		},
+		{
+			name:  "test VerifiedSignature struct",
+			entry: &identity.VerifiedSignature{},
+		},
+		{
+			name:  "test SSHChallenge struct",
+			entry: &identity.SSHChallenge{},
+		},
 		{
 			name:  "test Registration struct",
 			entry: &identity.Registration{},
@@ -166,6 +187,16 @@ func TestTagCompliance(t *testing.T) {
 			name:  "test Policy struct",
 			entry: &identity.Policy{},
 		},
+		{
+			name:  "test PasswordStrength struct",
+			entry: &identity.PasswordStrength{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test PasswordStrengthMatch struct",
+			entry: &identity.PasswordStrengthMatch{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test UserPolicy struct",
 			entry: &identity.UserPolicy{},
@@ -180,6 +211,47 @@ func TestTagCompliance(t *testing.T) {
 				DisableTagOnEmpty: true,
 			},
 		},
+		{
+			name:  "test APIKeyUsage struct",
+			entry: &identity.APIKeyUsage{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test APIKeyReportEntry struct",
+			entry: &identity.APIKeyReportEntry{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test PublicKeyReportEntry struct",
+			entry: &identity.PublicKeyReportEntry{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test ServiceAccountOwner struct",
+			entry: &identity.ServiceAccountOwner{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test APIKeyPolicy struct",
+			entry: &identity.APIKeyPolicy{},
+			opts: &Options{
+				DisableTagOnEmpty: true,
+			},
+		},
+		{
+			name:  "test MfaTokenPolicy struct",
+			entry: &identity.MfaTokenPolicy{},
+			opts: &Options{
+				DisableTagOnEmpty: true,
+			},
+		},
+		{
+			name:  "test PublicKeyPolicy struct",
+			entry: &identity.PublicKeyPolicy{},
+			opts: &Options{
+				DisableTagOnEmpty: true,
+			},
+		},
 		{
 			name:  "test WebAuthnRegisterRequest struct",
 			entry: &identity.WebAuthnRegisterRequest{},
@@ -212,6 +284,21 @@ func TestTagCompliance(t *testing.T) {
 			entry: &requests.Flags{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test requests.Certificate struct",
+			entry: &requests.Certificate{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test requests.Signature struct",
+			entry: &requests.Signature{},
+			opts:  &Options{},
+		},
+		{
+			name:  "test SSHCertificateAuthority struct",
+			entry: &identity.SSHCertificateAuthority{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test identity.UserMetadata struct",
 			entry: &identity.UserMetadata{},
@@ -242,6 +329,11 @@ func TestTagCompliance(t *testing.T) {
 			entry: &requests.Sandbox{},
 			opts:  &Options{},
 		},
+		{
+			name:  "test apikey.Key struct",
+			entry: &apikey.Key{},
+			opts:  &Options{},
+		},
 		{
 			name:  "test qr.Code struct",
 			entry: &qr.Code{},
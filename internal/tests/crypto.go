@@ -15,6 +15,10 @@
 package tests
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -23,34 +27,65 @@ import (
 	"testing"
 )
 
-// GetCryptoKeyPair returns private-public key pair.
+// GetCryptoKeyPair returns private-public key pair. The supported key
+// algorithms are rsa, ecdsa, and ed25519.
 func GetCryptoKeyPair(t *testing.T, keyAlgo, publicKeyType string) (string, string) {
-	switch keyAlgo {
-	case "rsa":
-	default:
-		t.Fatalf("unsupported key algorithm: %s", keyAlgo)
-	}
 	switch publicKeyType {
-	case "openssh", "rsa":
+	case "openssh", "rsa", "pem":
 	default:
 		t.Fatalf("unsupported public key type: %s", publicKeyType)
 	}
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		t.Fatalf("failed generating private key: %v", err)
-	}
-	if err := privateKey.Validate(); err != nil {
-		t.Fatalf("failed validating private key: %v", err)
-	}
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-	privateKeyPEM := pem.EncodeToMemory(
-		&pem.Block{
+	var privateKey crypto.Signer
+	var privateKeyBlock *pem.Block
+	publicKeyBlockType := "PUBLIC KEY"
+	switch keyAlgo {
+	case "rsa":
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed generating private key: %v", err)
+		}
+		if err := rsaKey.Validate(); err != nil {
+			t.Fatalf("failed validating private key: %v", err)
+		}
+		privateKey = rsaKey
+		privateKeyBlock = &pem.Block{
 			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+		}
+		publicKeyBlockType = "RSA PUBLIC KEY"
+	case "ecdsa":
+		ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed generating private key: %v", err)
+		}
+		privateKeyBytes, err := x509.MarshalECPrivateKey(ecdsaKey)
+		if err != nil {
+			t.Fatalf("failed encoding private key: %v", err)
+		}
+		privateKey = ecdsaKey
+		privateKeyBlock = &pem.Block{
+			Type:  "EC PRIVATE KEY",
 			Bytes: privateKeyBytes,
-		},
-	)
-	// t.Logf("private rsa key:\n%s", string(privateKeyPEM))
+		}
+	case "ed25519":
+		_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("failed generating private key: %v", err)
+		}
+		privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+		if err != nil {
+			t.Fatalf("failed encoding private key: %v", err)
+		}
+		privateKey = ed25519Key
+		privateKeyBlock = &pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: privateKeyBytes,
+		}
+	default:
+		t.Fatalf("unsupported key algorithm: %s", keyAlgo)
+	}
+	privateKeyPEM := pem.EncodeToMemory(privateKeyBlock)
 
 	switch publicKeyType {
 	case "openssh":
@@ -66,12 +101,12 @@ func GetCryptoKeyPair(t *testing.T, keyAlgo, publicKeyType string) (string, stri
 	// Derive Public Key
 	publicKeyBytes, err := x509.MarshalPKIXPublicKey(privateKey.Public())
 	if err != nil {
-		t.Fatalf("failed creating rsa public key: %v", err)
+		t.Fatalf("failed creating public key: %v", err)
 	}
 	// Create PEM encoded string
 	publicKeyPEM := pem.EncodeToMemory(
 		&pem.Block{
-			Type:  "RSA PUBLIC KEY",
+			Type:  publicKeyBlockType,
 			Bytes: publicKeyBytes,
 		},
 	)
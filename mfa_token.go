@@ -37,6 +37,24 @@ import (
 	"github.com/greenpau/go-identity/pkg/requests"
 )
 
+const (
+	// hotpLookAheadWindow is the number of counter values past the counter
+	// of HOTP token within which passcodes are accepted.
+	hotpLookAheadWindow = 10
+	// hotpResyncWindow is the number of counter values past the counter of
+	// HOTP token searched for the passcodes resynchronizing the token.
+	hotpResyncWindow = 100
+	// hotpMaxFailedAttempts is the number of consecutive failed attempts
+	// after which HOTP token refuses passcodes until it is resynchronized.
+	hotpMaxFailedAttempts = 5
+	// defaultTOTPSkew is the number of time steps before and after the
+	// current one within which the passcodes of TOTP token are accepted.
+	defaultTOTPSkew = 1
+	// maxTOTPSkew is the maximum number of time steps before and after the
+	// current one within which the passcodes of TOTP token are accepted.
+	maxTOTPSkew = 10
+)
+
 // MfaTokenBundle is a collection of public keys.
 type MfaTokenBundle struct {
 	tokens []*MfaToken
@@ -57,11 +75,22 @@ type MfaToken struct {
 	CreatedAt        time.Time         `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
 	Disabled         bool              `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 	DisabledAt       time.Time         `json:"disabled_at,omitempty" xml:"disabled_at,omitempty" yaml:"disabled_at,omitempty"`
+	ModifiedAt       time.Time         `json:"modified_at,omitempty" xml:"modified_at,omitempty" yaml:"modified_at,omitempty"`
 	Device           *MfaDevice        `json:"device,omitempty" xml:"device,omitempty" yaml:"device,omitempty"`
 	Parameters       map[string]string `json:"parameters,omitempty" xml:"parameters,omitempty" yaml:"parameters,omitempty"`
 	Flags            map[string]bool   `json:"flags,omitempty" xml:"flags,omitempty" yaml:"flags,omitempty"`
 	SignatureCounter uint32            `json:"signature_counter,omitempty" xml:"signature_counter,omitempty" yaml:"signature_counter,omitempty"`
-	pubkey           *ecdsa.PublicKey
+	// Counter is the moving counter of HOTP token, i.e. the counter value
+	// of the next expected passcode.
+	Counter uint64 `json:"counter,omitempty" xml:"counter,omitempty" yaml:"counter,omitempty"`
+	// FailedAttempts is the number of consecutive failed attempts to verify
+	// the passcodes of HOTP token.
+	FailedAttempts int `json:"failed_attempts,omitempty" xml:"failed_attempts,omitempty" yaml:"failed_attempts,omitempty"`
+	// LastTimeStep is the time step of the last passcode accepted by TOTP
+	// token. The passcodes of that time step and the earlier ones are
+	// rejected, so the passcodes cannot be replayed.
+	LastTimeStep uint64 `json:"last_time_step,omitempty" xml:"last_time_step,omitempty" yaml:"last_time_step,omitempty"`
+	pubkey       *ecdsa.PublicKey
 }
 
 // MfaDevice is the hardware device associated with MfaToken.
@@ -96,8 +125,12 @@ func (b *MfaTokenBundle) Size() int {
 
 // NewMfaToken returns an instance of MfaToken.
 func NewMfaToken(req *requests.Request) (*MfaToken, error) {
+	id, err := GenerateRandomString(40)
+	if err != nil {
+		return nil, err
+	}
 	p := &MfaToken{
-		ID:         GetRandomString(40),
+		ID:         id,
 		CreatedAt:  time.Now().UTC(),
 		Parameters: make(map[string]string),
 		Flags:      make(map[string]bool),
@@ -111,7 +144,7 @@ func NewMfaToken(req *requests.Request) (*MfaToken, error) {
 	}
 
 	switch p.Type {
-	case "totp":
+	case "totp", "hotp":
 		// Shared Secret
 		p.Secret = req.MfaToken.Secret
 		// Algorithm
@@ -126,9 +159,11 @@ func NewMfaToken(req *requests.Request) (*MfaToken, error) {
 		req.MfaToken.Algorithm = p.Algorithm
 
 		// Period
-		p.Period = req.MfaToken.Period
-		if p.Period < 30 || p.Period > 300 {
-			return nil, errors.ErrMfaTokenInvalidPeriod.WithArgs(p.Period)
+		if p.Type == "totp" {
+			p.Period = req.MfaToken.Period
+			if p.Period < 30 || p.Period > 300 {
+				return nil, errors.ErrMfaTokenInvalidPeriod.WithArgs(p.Period)
+			}
 		}
 		// Digits
 		p.Digits = req.MfaToken.Digits
@@ -139,6 +174,13 @@ func NewMfaToken(req *requests.Request) (*MfaToken, error) {
 			return nil, errors.ErrMfaTokenInvalidDigits.WithArgs(p.Digits)
 		}
 		// Codes
+		if p.Type == "hotp" {
+			p.Counter = req.MfaToken.Counter
+			if err := p.ValidateCodeWithCounter(req.MfaToken.Passcode); err != nil {
+				return nil, err
+			}
+			break
+		}
 		if err := p.ValidateCodeWithTime(req.MfaToken.Passcode, time.Now().Add(-time.Second*time.Duration(p.Period)).UTC()); err != nil {
 			return nil, err
 		}
@@ -435,10 +477,38 @@ func (p *MfaToken) Disable() {
 	p.DisabledAt = time.Now().UTC()
 }
 
-// ValidateCode validates a passcode
+// Suspend disables MfaToken instance temporarily. Unlike Disable, it does not
+// expire the token, so the token can be re-enabled with Enable.
+func (p *MfaToken) Suspend() {
+	p.Disabled = true
+	p.DisabledAt = time.Now().UTC()
+	p.ModifiedAt = p.DisabledAt
+}
+
+// Enable re-enables MfaToken instance suspended with Suspend. The expired
+// token cannot be re-enabled.
+func (p *MfaToken) Enable() error {
+	if p.Expired {
+		return errors.ErrCredentialExpired
+	}
+	p.Disabled = false
+	p.ModifiedAt = time.Now().UTC()
+	return nil
+}
+
+// SetComment changes the comment of MfaToken instance.
+func (p *MfaToken) SetComment(s string) {
+	p.Comment = s
+	p.ModifiedAt = time.Now().UTC()
+}
+
+// ValidateCode validates a passcode. The counter of HOTP token moves past
+// the counter of the accepted passcode.
 func (p *MfaToken) ValidateCode(code string) error {
 	switch p.Type {
 	case "totp":
+	case "hotp":
+		return p.ValidateCodeWithCounter(code)
 	default:
 		return errors.ErrMfaTokenInvalidPasscode.WithArgs("unsupported token type")
 	}
@@ -446,31 +516,132 @@ func (p *MfaToken) ValidateCode(code string) error {
 	return p.ValidateCodeWithTime(code, ts)
 }
 
-// ValidateCodeWithTime validates a passcode at a particular time.
-func (p *MfaToken) ValidateCodeWithTime(code string, ts time.Time) error {
+// validateCodeFormat returns the passcode without surrounding whitespace, if
+// it has the number of digits of MfaToken instance.
+func (p *MfaToken) validateCodeFormat(code string) (string, error) {
 	code = strings.TrimSpace(code)
 	if code == "" {
-		return errors.ErrMfaTokenInvalidPasscode.WithArgs("empty")
+		return "", errors.ErrMfaTokenInvalidPasscode.WithArgs("empty")
 	}
 	if len(code) < 4 || len(code) > 8 {
-		return errors.ErrMfaTokenInvalidPasscode.WithArgs("not 4-8 characters long")
+		return "", errors.ErrMfaTokenInvalidPasscode.WithArgs("not 4-8 characters long")
 	}
 	if len(code) != p.Digits {
-		return errors.ErrMfaTokenInvalidPasscode.WithArgs("digits length mismatch")
+		return "", errors.ErrMfaTokenInvalidPasscode.WithArgs("digits length mismatch")
+	}
+	return code, nil
+}
+
+// ValidateCodeWithCounter validates a passcode of HOTP token within the
+// look-ahead window of its counter. The counter moves past the counter of
+// the accepted passcode, so the passcode cannot be reused. After a number of
+// consecutive failed attempts, the token refuses passcodes until it is
+// resynchronized, so the look-ahead window cannot be brute-forced.
+func (p *MfaToken) ValidateCodeWithCounter(code string) error {
+	if p.FailedAttempts >= hotpMaxFailedAttempts {
+		return errors.ErrMfaTokenInvalidPasscode.WithArgs("too many failed attempts, resync required")
+	}
+	code, err := p.validateCodeFormat(code)
+	if err != nil {
+		return err
+	}
+	counter, found := p.findCounter(hotpLookAheadWindow, code)
+	if !found {
+		p.FailedAttempts++
+		return errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")
+	}
+	p.Counter = counter + 1
+	p.FailedAttempts = 0
+	return nil
+}
+
+// Resync resynchronizes the counter of HOTP token with the device generating
+// the passcodes, e.g. after the device generated passcodes past the
+// look-ahead window. The passcodes must be consecutive.
+func (p *MfaToken) Resync(code, nextCode string) error {
+	if p.Type != "hotp" {
+		return errors.ErrMfaTokenInvalidPasscode.WithArgs("unsupported token type")
+	}
+	code, err := p.validateCodeFormat(code)
+	if err != nil {
+		return err
+	}
+	nextCode, err = p.validateCodeFormat(nextCode)
+	if err != nil {
+		return err
+	}
+	counter, found := p.findCounter(hotpResyncWindow, code, nextCode)
+	if !found {
+		return errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")
+	}
+	p.Counter = counter + 2
+	p.FailedAttempts = 0
+	p.ModifiedAt = time.Now().UTC()
+	return nil
+}
+
+// findCounter returns the first counter value within the window past the
+// counter of HOTP token generating the consecutive passcodes.
+func (p *MfaToken) findCounter(window int, codes ...string) (uint64, bool) {
+	for i := 0; i <= window; i++ {
+		counter := p.Counter + uint64(i)
+		matched := true
+		for j, code := range codes {
+			localCode, err := generateMfaCode(p.Secret, p.Algorithm, p.Digits, counter+uint64(j))
+			if err != nil || subtle.ConstantTimeCompare([]byte(localCode), []byte(code)) != 1 {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// ValidateCodeWithTime validates a passcode at a particular time. It accepts
+// the passcodes of the time steps adjacent to the current one.
+func (p *MfaToken) ValidateCodeWithTime(code string, ts time.Time) error {
+	return p.ValidateCodeWithSkew(code, ts, defaultTOTPSkew)
+}
+
+// ValidateCodeWithSkew validates a passcode at a particular time. It accepts
+// the passcodes of up to skew time steps before and after the current one.
+// The time step of the accepted passcode is recorded, and the passcodes of
+// that time step and the earlier ones are rejected afterwards.
+func (p *MfaToken) ValidateCodeWithSkew(code string, ts time.Time, skew int) error {
+	code, err := p.validateCodeFormat(code)
+	if err != nil {
+		return err
 	}
 	tp := uint64(math.Floor(float64(ts.Unix()) / float64(p.Period)))
 	tps := []uint64{}
 	tps = append(tps, tp)
-	tps = append(tps, tp+uint64(1))
-	tps = append(tps, tp-uint64(1))
+	for i := 1; i <= skew; i++ {
+		tps = append(tps, tp+uint64(i))
+		if tp >= uint64(i) {
+			tps = append(tps, tp-uint64(i))
+		}
+	}
+	var replayed bool
 	for _, uts := range tps {
 		localCode, err := generateMfaCode(p.Secret, p.Algorithm, p.Digits, uts)
 		if err != nil {
 			continue
 		}
-		if subtle.ConstantTimeCompare([]byte(localCode), []byte(code)) == 1 {
-			return nil
+		if subtle.ConstantTimeCompare([]byte(localCode), []byte(code)) != 1 {
+			continue
 		}
+		if uts <= p.LastTimeStep {
+			replayed = true
+			continue
+		}
+		p.LastTimeStep = uts
+		return nil
+	}
+	if replayed {
+		return errors.ErrMfaTokenInvalidPasscode.WithArgs("already used")
 	}
 	return errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")
 }
@@ -296,10 +296,18 @@ func TestNewMfaToken(t *testing.T) {
 			// t.Logf("token: %v", token)
 
 			if tc.req.MfaToken.Type == "totp" {
+				// The passcode accepted when adding the token cannot be reused.
+				if err := token.ValidateCode(tc.req.MfaToken.Passcode); err == nil {
+					t.Fatalf("unexpected success during passcode replay: %v", err)
+				}
+				tc.req.MfaToken.Passcode = ""
 				generateTestPasscode(tc.req, false)
 				if err := token.ValidateCode(tc.req.MfaToken.Passcode); err != nil {
 					t.Fatalf("unexpected failure during passcode validation: %v", err)
 				}
+				if err := token.ValidateCode(tc.req.MfaToken.Passcode); err == nil {
+					t.Fatalf("unexpected success during passcode replay: %v", err)
+				}
 				if err := token.ValidateCode("123456"); err == nil {
 					t.Fatalf("unexpected success during passcode validation: %v", err)
 				}
@@ -319,3 +327,366 @@ func TestNewMfaToken(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabaseHOTPMfaToken(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseHOTPMfaToken")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user1 := requests.User{Username: testUser1, Email: testEmail1}
+	secret := "c71ca4c68bc14ec5b4ab8d3c3b63802c"
+	getPasscode := func(counter uint64) string {
+		code, err := generateMfaCode(secret, "sha1", 6, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	newRequest := func(counter uint64) *requests.Request {
+		return &requests.Request{
+			User: user1,
+			MfaToken: requests.MfaToken{
+				Comment:   "hotp key fob",
+				Type:      "hotp",
+				Secret:    secret,
+				Algorithm: "sha1",
+				Digits:    6,
+				Counter:   100,
+				Passcode:  getPasscode(counter),
+			},
+		}
+	}
+
+	// The passcode of a new token must be within the look-ahead window.
+	err = db.AddMfaToken(newRequest(150))
+	tests.EvalErrWithLog(t, err, "add mfa token", true,
+		errors.ErrAddMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		[]string{"test name: add hotp token with passcode outside look-ahead window"},
+	)
+	if err := db.AddMfaToken(newRequest(100)); err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := user.MfaTokens[len(user.MfaTokens)-1]
+
+	testcases := []struct {
+		name      string
+		operation string
+		counters  []uint64
+		attempts  int
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "test verify passcode at counter",
+			operation: "verify",
+			counters:  []uint64{101},
+			want:      map[string]interface{}{"counter": uint64(102)},
+		},
+		{
+			name:      "test verify reused passcode",
+			operation: "verify",
+			counters:  []uint64{101},
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name:      "test verify passcode within look-ahead window",
+			operation: "verify",
+			counters:  []uint64{105},
+			want:      map[string]interface{}{"counter": uint64(106)},
+		},
+		{
+			name:      "test verify passcode outside look-ahead window",
+			operation: "verify",
+			counters:  []uint64{150},
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name:      "test resync with non-consecutive passcodes",
+			operation: "resync",
+			counters:  []uint64{150, 152},
+			shouldErr: true,
+			err:       errors.ErrResyncMfaToken.WithArgs(token.ID, errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name:      "test resync with consecutive passcodes",
+			operation: "resync",
+			counters:  []uint64{150, 151},
+			want:      map[string]interface{}{"counter": uint64(152)},
+		},
+		{
+			name:      "test verify passcode after resync",
+			operation: "verify",
+			counters:  []uint64{152},
+			want:      map[string]interface{}{"counter": uint64(153), "failed_attempts": 0},
+		},
+		{
+			name:      "test verify passcodes outside look-ahead window until locked",
+			operation: "verify",
+			counters:  []uint64{200},
+			attempts:  hotpMaxFailedAttempts,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name:      "test load failed attempts of locked token",
+			operation: "load",
+			want:      map[string]interface{}{"counter": uint64(153), "failed_attempts": hotpMaxFailedAttempts},
+		},
+		{
+			name:      "test verify passcode at counter of locked token",
+			operation: "verify",
+			counters:  []uint64{153},
+			shouldErr: true,
+			err: errors.ErrVerifyMfaToken.WithArgs(
+				errors.ErrMfaTokenInvalidPasscode.WithArgs("too many failed attempts, resync required"),
+			),
+		},
+		{
+			name:      "test resync locked token",
+			operation: "resync",
+			counters:  []uint64{153, 154},
+			want:      map[string]interface{}{"counter": uint64(155), "failed_attempts": 0},
+		},
+		{
+			name:      "test verify passcode after unlock",
+			operation: "verify",
+			counters:  []uint64{155},
+			want:      map[string]interface{}{"counter": uint64(156)},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if tc.operation == "load" {
+				// The failed attempts are persisted.
+				savedDB, err := NewDatabase(db.GetPath())
+				if err != nil {
+					t.Fatalf("failed to load database: %v", err)
+				}
+				savedUser, err := savedDB.getUser(testUser1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				savedToken := savedUser.MfaTokens[len(savedUser.MfaTokens)-1]
+				got := map[string]interface{}{"counter": savedToken.Counter, "failed_attempts": savedToken.FailedAttempts}
+				tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+				return
+			}
+			for i := 1; i < tc.attempts; i++ {
+				r := &requests.Request{User: user1}
+				r.MfaToken.Passcode = getPasscode(tc.counters[0])
+				if err := db.VerifyMfaToken(r); err == nil {
+					t.Fatalf("expected failed attempt %d", i)
+				}
+			}
+			r := &requests.Request{User: user1}
+			r.MfaToken.Passcode = getPasscode(tc.counters[0])
+			switch tc.operation {
+			case "verify":
+				err = db.VerifyMfaToken(r)
+			case "resync":
+				r.MfaToken.ID = token.ID
+				r.MfaToken.NextPasscode = getPasscode(tc.counters[1])
+				err = db.ResyncMfaToken(r)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation+" mfa token", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["counter"] = token.Counter
+			if _, exists := tc.want["failed_attempts"]; exists {
+				got["failed_attempts"] = token.FailedAttempts
+			}
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+
+	// The counter is persisted after each accepted passcode.
+	db, err = NewDatabase(db.GetPath())
+	if err != nil {
+		t.Fatalf("failed to load database: %v", err)
+	}
+	user, err = db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "counter", uint64(156), user.MfaTokens[len(user.MfaTokens)-1].Counter,
+		[]string{"test name: load hotp token counter"},
+	)
+}
+
+func TestDatabaseTOTPMfaToken(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseTOTPMfaToken")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user1 := requests.User{Username: testUser1, Email: testEmail1}
+	secret := "c71ca4c68bc14ec5b4ab8d3c3b63802c"
+	tp := uint64(time.Now().Unix() / 30)
+	getPasscode := func(step uint64) string {
+		code, err := generateMfaCode(secret, "sha1", 6, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	if err := db.AddMfaToken(&requests.Request{
+		User: user1,
+		MfaToken: requests.MfaToken{
+			Comment:   "ms auth app",
+			Type:      "totp",
+			Secret:    secret,
+			Algorithm: "sha1",
+			Period:    30,
+			Digits:    6,
+			Passcode:  getPasscode(tp - 1),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name      string
+		username  string
+		skew      int
+		step      uint64
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "test verify passcode of user without tokens",
+			username:  testUser2,
+			skew:      1,
+			step:      tp,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name:      "test verify passcode of next time step without skew",
+			skew:      0,
+			step:      tp + 1,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name:      "test verify passcode with negative policy skew",
+			skew:      -1,
+			step:      tp,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenPolicyTOTPSkew.WithArgs(-1, maxTOTPSkew)),
+		},
+		{
+			name:      "test verify passcode with policy skew exceeding maximum",
+			skew:      11,
+			step:      tp,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenPolicyTOTPSkew.WithArgs(11, maxTOTPSkew)),
+		},
+		{
+			name: "test verify passcode of current time step",
+			skew: 1,
+			step: tp,
+			want: map[string]interface{}{"last_time_step": tp},
+		},
+		{
+			name:      "test verify replayed passcode",
+			skew:      1,
+			step:      tp,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("already used")),
+		},
+		{
+			name:      "test verify passcode of earlier time step",
+			skew:      1,
+			step:      tp - 1,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("already used")),
+		},
+		{
+			name:      "test verify passcode outside skew window",
+			skew:      1,
+			step:      tp + 3,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")),
+		},
+		{
+			name: "test verify passcode within policy skew window",
+			skew: 3,
+			step: tp + 3,
+			want: map[string]interface{}{"last_time_step": tp + 3},
+		},
+		{
+			name:      "test verify passcode preceding last time step",
+			skew:      3,
+			step:      tp + 2,
+			shouldErr: true,
+			err:       errors.ErrVerifyMfaToken.WithArgs(errors.ErrMfaTokenInvalidPasscode.WithArgs("already used")),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			db.Policy.MfaToken.TOTPSkew = intPtr(tc.skew)
+			u, err := db.getUser(testUser1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			revision := u.Revision
+			dbRevision := db.Revision
+			r := &requests.Request{User: user1}
+			if tc.username != "" {
+				r.User = requests.User{Username: tc.username}
+			}
+			r.MfaToken.Passcode = getPasscode(tc.step)
+			err = db.VerifyMfaToken(r)
+			if tc.shouldErr {
+				// The failed attempts of TOTP tokens are not persisted.
+				tests.EvalObjectsWithLog(t, "database revision", dbRevision, db.Revision, msgs)
+				tests.EvalObjectsWithLog(t, "user revision", revision, u.Revision, msgs)
+			}
+			if tests.EvalErrWithLog(t, err, "verify mfa token", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			user, err := db.getUser(testUser1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]interface{})
+			got["last_time_step"] = user.MfaTokens[len(user.MfaTokens)-1].LastTimeStep
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+			tests.EvalObjectsWithLog(t, "revision", revision+1, user.Revision, msgs)
+		})
+	}
+
+	// The last time step is persisted after each accepted passcode.
+	db, err = NewDatabase(db.GetPath())
+	if err != nil {
+		t.Fatalf("failed to load database: %v", err)
+	}
+	user, err := db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests.EvalObjectsWithLog(t, "last time step", tp+3, user.MfaTokens[len(user.MfaTokens)-1].LastTimeStep,
+		[]string{"test name: load totp token last time step"},
+	)
+
+	// The database with invalid policy skew is not loaded.
+	db.Policy.MfaToken.TOTPSkew = intPtr(-1)
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDatabase(db.GetPath())
+	tests.EvalErrWithLog(t, err, "load", true,
+		errors.ErrNewDatabase.WithArgs(db.GetPath(), errors.ErrMfaTokenPolicyTOTPSkew.WithArgs(-1, maxTOTPSkew)),
+		[]string{"test name: load database with negative policy skew"},
+	)
+}
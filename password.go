@@ -15,20 +15,31 @@
 package identity
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/greenpau/go-identity/internal/utils"
 	"github.com/greenpau/go-identity/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 	"strings"
+	"sync"
 	"time"
 )
 
+const minPasswordPepperLength = 16
+
 // Password is a memorized secret, typically a string of characters,
 // used to confirm the identity of a user.
 type Password struct {
-	Purpose    string    `json:"purpose,omitempty" xml:"purpose,omitempty" yaml:"purpose,omitempty"`
-	Algorithm  string    `json:"algorithm,omitempty" xml:"algorithm,omitempty" yaml:"algorithm,omitempty"`
-	Hash       string    `json:"hash,omitempty" xml:"hash,omitempty" yaml:"hash,omitempty"`
-	Cost       int       `json:"cost,omitempty" xml:"cost,omitempty" yaml:"cost,omitempty"`
-	Expired    bool      `json:"expired,omitempty" xml:"expired,omitempty" yaml:"expired,omitempty"`
+	Purpose   string `json:"purpose,omitempty" xml:"purpose,omitempty" yaml:"purpose,omitempty"`
+	Algorithm string `json:"algorithm,omitempty" xml:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Hash      string `json:"hash,omitempty" xml:"hash,omitempty" yaml:"hash,omitempty"`
+	Cost      int    `json:"cost,omitempty" xml:"cost,omitempty" yaml:"cost,omitempty"`
+	PepperID  string `json:"pepper_id,omitempty" xml:"pepper_id,omitempty" yaml:"pepper_id,omitempty"`
+	Expired   bool   `json:"expired,omitempty" xml:"expired,omitempty" yaml:"expired,omitempty"`
+	// MustChange indicates that the password must be changed upon the
+	// first login, e.g. generated initial passwords.
+	MustChange bool      `json:"must_change,omitempty" xml:"must_change,omitempty" yaml:"must_change,omitempty"`
 	ExpiredAt  time.Time `json:"expired_at,omitempty" xml:"expired_at,omitempty" yaml:"expired_at,omitempty"`
 	CreatedAt  time.Time `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
 	Disabled   bool      `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
@@ -41,7 +52,9 @@ func NewPassword(s string) (*Password, error) {
 }
 
 // NewPasswordWithOptions returns an instance of Password based on the
-// provided parameters.
+// provided parameters. The password is peppered with the "pepper" secret
+// identified by the "pepper_id" parameter. The empty "pepper_id" disables
+// peppering.
 func NewPasswordWithOptions(s, purpose, algo string, params map[string]interface{}) (*Password, error) {
 	p := &Password{
 		Purpose:   purpose,
@@ -49,13 +62,20 @@ func NewPasswordWithOptions(s, purpose, algo string, params map[string]interface
 		CreatedAt: time.Now().UTC(),
 	}
 
+	var pepper []byte
 	if params != nil {
 		if v, exists := params["cost"]; exists {
 			p.Cost = v.(int)
 		}
+		if v, exists := params["pepper_id"]; exists {
+			p.PepperID = v.(string)
+		}
+		if v, exists := params["pepper"]; exists {
+			pepper = v.([]byte)
+		}
 	}
 
-	if err := p.hash(s); err != nil {
+	if err := p.hash(s, pepper); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -69,11 +89,17 @@ func (p *Password) Disable() {
 	p.DisabledAt = time.Now().UTC()
 }
 
-func (p *Password) hash(s string) error {
+func (p *Password) hash(s string, pepper []byte) error {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return errors.ErrPasswordEmpty
 	}
+	if p.PepperID != "" {
+		if pepper == nil {
+			return errors.ErrPasswordPepperNotFound.WithArgs(p.PepperID)
+		}
+		s = applyPasswordPepper(pepper, s)
+	}
 	switch p.Algorithm {
 	case "bcrypt":
 		if p.Cost < 8 {
@@ -91,10 +117,148 @@ func (p *Password) hash(s string) error {
 	return errors.ErrPasswordUnsupportedAlgorithm.WithArgs(p.Algorithm)
 }
 
-// Match returns true when the provided password matches the user.
+// Match returns true when the provided password matches the user. The
+// peppered passwords do not match, because the pepper is unknown.
 func (p *Password) Match(s string) bool {
+	return p.MatchWithPepper(s, nil)
+}
+
+// MatchWithPepper returns true when the provided password matches the user.
+// If the password was peppered, the pepper it was hashed with is applied
+// first.
+func (p *Password) MatchWithPepper(s string, pepper []byte) bool {
+	if p.PepperID != "" {
+		if pepper == nil {
+			return false
+		}
+		s = applyPasswordPepper(pepper, s)
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(p.Hash), []byte(s)); err == nil {
 		return true
 	}
 	return false
 }
+
+// PasswordPeppers is a collection of password peppers, i.e. the secrets
+// applied to passwords prior to hashing. The peppers must be kept outside of
+// the database. The peppers of previous versions must remain loaded until
+// the passwords hashed with them are rehashed upon login or changed.
+type PasswordPeppers struct {
+	mu       *sync.RWMutex
+	secrets  map[string][]byte
+	activeID string
+}
+
+// NewPasswordPeppers returns an instance of PasswordPeppers.
+func NewPasswordPeppers() *PasswordPeppers {
+	return &PasswordPeppers{
+		mu:      &sync.RWMutex{},
+		secrets: make(map[string][]byte),
+	}
+}
+
+// Add adds a pepper.
+func (pp *PasswordPeppers) Add(id string, secret []byte) error {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return errors.ErrPasswordPepperEmptyID
+	}
+	if len(secret) < minPasswordPepperLength {
+		return errors.ErrPasswordPepperTooShort.WithArgs(id, minPasswordPepperLength)
+	}
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.secrets[id] = append([]byte{}, secret...)
+	return nil
+}
+
+// Load reads a pepper from a file and adds it. The contents of the file are
+// used as is, so that binary peppers are preserved.
+func (pp *PasswordPeppers) Load(id, fp string) error {
+	b, err := utils.ReadFileBytes(fp)
+	if err != nil {
+		return errors.ErrPasswordPepperLoad.WithArgs(id, fp, err)
+	}
+	return pp.Add(id, b)
+}
+
+// SetActive sets the pepper applied to new passwords. The empty id disables
+// peppering of new passwords.
+func (pp *PasswordPeppers) SetActive(id string) error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if id != "" {
+		if _, exists := pp.secrets[id]; !exists {
+			return errors.ErrPasswordPepperNotFound.WithArgs(id)
+		}
+	}
+	pp.activeID = id
+	return nil
+}
+
+// GetActiveID returns the id of the pepper applied to new passwords.
+func (pp *PasswordPeppers) GetActiveID() string {
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+	return pp.activeID
+}
+
+// Remove removes a pepper.
+func (pp *PasswordPeppers) Remove(id string) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	delete(pp.secrets, id)
+	if pp.activeID == id {
+		pp.activeID = ""
+	}
+}
+
+// get returns the secret of a pepper. The empty id has no secret.
+func (pp *PasswordPeppers) get(id string) []byte {
+	if id == "" {
+		return nil
+	}
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+	return pp.secrets[id]
+}
+
+// NewPassword returns an instance of Password peppered with the active
+// pepper.
+func (pp *PasswordPeppers) NewPassword(s string) (*Password, error) {
+	pp.mu.RLock()
+	id := pp.activeID
+	pp.mu.RUnlock()
+	return NewPasswordWithOptions(s, "generic", "bcrypt", map[string]interface{}{
+		"pepper_id": id,
+		"pepper":    pp.get(id),
+	})
+}
+
+// Match returns true when the provided password matches the password
+// peppered with any of the peppers.
+func (pp *PasswordPeppers) Match(p *Password, s string) bool {
+	return p.MatchWithPepper(s, pp.get(p.PepperID))
+}
+
+// Rehash hashes the password stored with a previous pepper again with the
+// active pepper. The password must have been matched before.
+func (pp *PasswordPeppers) Rehash(p *Password, s string) error {
+	id := pp.GetActiveID()
+	if p.PepperID == id {
+		return nil
+	}
+	prev := p.PepperID
+	p.PepperID = id
+	if err := p.hash(s, pp.get(id)); err != nil {
+		p.PepperID = prev
+		return err
+	}
+	return nil
+}
+
+func applyPasswordPepper(secret []byte, s string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(s))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
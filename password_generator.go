@@ -0,0 +1,179 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"strings"
+
+	"github.com/greenpau/go-identity/pkg/errors"
+)
+
+const (
+	passwordGeneratorLowercase = "abcdefghijklmnopqrstuvwxyz"
+	passwordGeneratorUppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordGeneratorNumbers   = "0123456789"
+	passwordGeneratorSymbols   = "!#$%&*+-.:=?@^_~"
+	// passwordGeneratorLength is the default length of generated passwords.
+	passwordGeneratorLength = 16
+	// passphraseGeneratorWords is the default number of words in generated
+	// passphrases.
+	passphraseGeneratorWords = 6
+	// passwordGeneratorAttempts is the number of attempts to generate a
+	// password compliant with password policy.
+	passwordGeneratorAttempts = 100
+)
+
+// getRandomChar returns a random character from a character set.
+func getRandomChar(charset string) (byte, error) {
+	i, err := getRandomInt(len(charset))
+	if err != nil {
+		return 0, err
+	}
+	return charset[i], nil
+}
+
+// shuffleBytes shuffles a slice of bytes using Fisher-Yates algorithm.
+func shuffleBytes(b []byte) error {
+	for i := len(b) - 1; i > 0; i-- {
+		j, err := getRandomInt(i + 1)
+		if err != nil {
+			return err
+		}
+		b[i], b[j] = b[j], b[i]
+	}
+	return nil
+}
+
+// GeneratePassword returns a random password compliant with the password
+// policy of the database. The password contains at least one lowercase,
+// uppercase, numeric, and non alpha-numeric character. When the length is
+// 0, the length defaults to the greater of 16 and the minimum length
+// required by the policy. The length outside of the range required by the
+// policy is an error.
+func (db *Database) GeneratePassword(length int) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if length == 0 {
+		length = passwordGeneratorLength
+		if length < db.Policy.Password.MinLength {
+			length = db.Policy.Password.MinLength
+		}
+		if db.Policy.Password.MaxLength > 0 && length > db.Policy.Password.MaxLength {
+			length = db.Policy.Password.MaxLength
+		}
+	}
+	if length < db.Policy.Password.MinLength || (db.Policy.Password.MaxLength > 0 && length > db.Policy.Password.MaxLength) {
+		return "", errors.ErrPasswordGenerator.WithArgs(
+			errors.ErrPasswordGeneratorLengthPolicy.WithArgs(length, db.Policy.Password.MinLength, db.Policy.Password.MaxLength),
+		)
+	}
+	charsets := []string{
+		passwordGeneratorLowercase,
+		passwordGeneratorUppercase,
+		passwordGeneratorNumbers,
+		passwordGeneratorSymbols,
+	}
+	if length < len(charsets) {
+		return "", errors.ErrPasswordGenerator.WithArgs(errors.ErrPasswordGeneratorLength.WithArgs(length))
+	}
+	var policyErr error
+	for attempt := 0; attempt < passwordGeneratorAttempts; attempt++ {
+		b := make([]byte, length)
+		for i := range b {
+			charset := strings.Join(charsets, "")
+			if i < len(charsets) {
+				charset = charsets[i]
+			}
+			c, err := getRandomChar(charset)
+			if err != nil {
+				return "", errors.ErrPasswordGenerator.WithArgs(err)
+			}
+			b[i] = c
+		}
+		if err := shuffleBytes(b); err != nil {
+			return "", errors.ErrPasswordGenerator.WithArgs(err)
+		}
+		s := string(b)
+		if policyErr = db.checkPasswordPolicyCompliance(s); policyErr == nil {
+			return s, nil
+		}
+	}
+	return "", errors.ErrPasswordGenerator.WithArgs(policyErr)
+}
+
+// GeneratePassphrase returns a random diceware-style passphrase compliant
+// with the password policy of the database. The passphrase consists of the
+// words joined with the separator. When the number of words is 0, it
+// defaults to 6. When the separator is empty, it defaults to "-".
+//
+// The first letter of each word is capitalized when the policy requires
+// uppercase characters. A random digit is appended to one of the words when
+// the policy requires numbers. Additional words are added when the
+// passphrase is shorter than the minimum length required by the policy.
+func (db *Database) GeneratePassphrase(words int, separator string) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if words == 0 {
+		words = passphraseGeneratorWords
+	}
+	if words < 1 {
+		return "", errors.ErrPasswordGenerator.WithArgs(errors.ErrPasswordGeneratorWords.WithArgs(words))
+	}
+	if separator == "" {
+		separator = "-"
+	}
+	var policyErr error
+	for attempt := 0; attempt < passwordGeneratorAttempts; attempt++ {
+		var entries []string
+		for len(entries) < words || len(strings.Join(entries, separator)) < db.Policy.Password.MinLength {
+			i, err := getRandomInt(len(passphraseWords))
+			if err != nil {
+				return "", errors.ErrPasswordGenerator.WithArgs(err)
+			}
+			word := passphraseWords[i]
+			if db.Policy.Password.RequireUppercase {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+			entries = append(entries, word)
+		}
+		if db.Policy.Password.RequireNumber {
+			i, err := getRandomInt(len(entries))
+			if err != nil {
+				return "", errors.ErrPasswordGenerator.WithArgs(err)
+			}
+			c, err := getRandomChar(passwordGeneratorNumbers)
+			if err != nil {
+				return "", errors.ErrPasswordGenerator.WithArgs(err)
+			}
+			entries[i] += string(c)
+		}
+		if db.Policy.Password.RequireNonAlphaNumeric && !strings.ContainsAny(separator, passwordGeneratorSymbols) {
+			i, err := getRandomInt(len(entries))
+			if err != nil {
+				return "", errors.ErrPasswordGenerator.WithArgs(err)
+			}
+			c, err := getRandomChar(passwordGeneratorSymbols)
+			if err != nil {
+				return "", errors.ErrPasswordGenerator.WithArgs(err)
+			}
+			entries[i] += string(c)
+		}
+		s := strings.Join(entries, separator)
+		if policyErr = db.checkPasswordPolicyCompliance(s); policyErr == nil {
+			return s, nil
+		}
+	}
+	return "", errors.ErrPasswordGenerator.WithArgs(policyErr)
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+// passphraseWords is the list of words used to generate passphrases.
+var passphraseWords = []string{
+	"able", "acid", "acorn", "actor", "adobe", "agent", "alarm", "album",
+	"alert", "alien", "alley", "alpha", "amber", "anchor", "angle", "ankle",
+	"apple", "apron", "arena", "armor", "arrow", "artist", "aspen", "atlas",
+	"atom", "attic", "audio", "autumn", "avenue", "award", "bacon", "badge",
+	"bagel", "baker", "balmy", "bamboo", "banana", "banjo", "barn", "barrel",
+	"basil", "basin", "basket", "batch", "beach", "beacon", "beard", "beaver",
+	"bench", "berry", "bike", "birch", "bison", "blade", "blanket", "blaze",
+	"blend", "blimp", "bloom", "blossom", "blue", "board", "boat", "bonus",
+	"book", "boot", "border", "bottle", "boulder", "bounce", "bowl", "brain",
+	"branch", "brass", "bread", "breeze", "brick", "bridge", "brook", "broom",
+	"brush", "bubble", "bucket", "buddy", "bugle", "bundle", "bunny", "butter",
+	"button", "cabin", "cable", "cactus", "cadet", "camel", "camera", "canal",
+	"candle", "candy", "canoe", "canvas", "canyon", "captain", "carbon", "card",
+	"cargo", "carpet", "carrot", "castle", "cedar", "cello", "cereal", "chalk",
+	"charm", "cheese", "cherry", "chess", "chest", "chief", "chimney", "cider",
+	"cinema", "circus", "citrus", "civic", "clam", "clay", "cliff", "clock",
+	"cloud", "clover", "coast", "cobalt", "cocoa", "coconut", "comet", "copper",
+	"coral", "cotton", "cougar", "cousin", "cradle", "crane", "crater",
+	"crayon", "creek", "cricket", "crown", "crystal", "cube", "cupcake",
+	"curtain", "cushion", "cycle", "dairy", "daisy", "dance", "dawn", "delta",
+	"denim", "desert", "diary", "diesel", "dingo", "dinner", "disco", "dock",
+	"dollar", "dolphin", "domain", "donkey", "donut", "dove", "dragon",
+	"drawer", "dream", "drift", "drum", "duck", "dune", "eagle", "easel",
+	"echo", "eclipse", "elbow", "elder", "ember", "emerald", "engine", "envoy",
+	"epic", "equal", "escape", "ethic", "event", "fabric", "falcon", "family",
+	"fancy", "farm", "feast", "feather", "fence", "ferry", "fiber", "fiddle",
+	"field", "fig", "finch", "fjord", "flag", "flame", "flask", "fleet",
+	"flint", "flute", "foam", "focus", "forest", "forge", "fossil", "fox",
+	"frame", "frost", "fruit", "fudge", "galaxy", "garden", "garlic", "gazebo",
+	"gecko", "gem", "giant", "ginger", "glacier", "glass", "globe", "glove",
+	"goat", "gold", "gopher", "grape", "gravel", "gravy", "grill", "guitar",
+	"gumbo", "habit", "hammer", "harbor", "harp", "hatch", "hawk", "hazel",
+	"heart", "hedge", "helmet", "herb", "hero", "heron", "hill", "hobby",
+	"honey", "hoop", "horizon", "hornet", "hotel", "hound", "humble", "husky",
+	"igloo", "index", "indigo", "ink", "insect", "iris", "iron", "island",
+	"ivory", "jacket", "jaguar", "jam", "jasmine", "jazz", "jelly", "jersey",
+	"jewel", "jigsaw", "jockey", "journal", "judge", "juice", "jungle", "kayak",
+	"kernel", "kettle", "kiosk", "kite", "kitten", "kiwi", "koala", "label",
+	"ladder", "lagoon", "lake", "lamp", "lantern", "laser", "latch", "lava",
+	"lawn", "lemon", "lens", "lever", "lilac", "lily", "lime", "linen", "lion",
+	"lizard", "llama", "lobster", "locket", "lotus", "lucky", "lumber", "lunar",
+	"lunch", "lyric", "magnet", "mango", "maple", "marble", "market", "marsh",
+	"mason", "meadow", "medal", "melon", "mentor", "meteor", "micro", "milk",
+	"mint", "mirror", "mitten", "mocha", "model", "monkey", "moose", "mosaic",
+	"moss", "motor", "mountain", "muffin", "mural", "museum", "mustard",
+	"nectar", "needle", "nest", "nickel", "noble", "noodle", "north", "novel",
+	"nugget", "nutmeg", "oasis", "ocean", "olive", "omega", "onion", "opal",
+	"opera", "orange", "orbit", "orchid", "otter", "oven", "owl", "oyster",
+	"paddle", "pagoda", "palace", "panda", "panel", "papaya", "parade",
+	"parcel", "parrot", "pasta", "pastel", "peach", "peanut", "pearl", "pebble",
+	"pecan", "pelican", "pencil", "pepper", "piano", "pickle", "pigeon",
+	"pillow", "pilot", "pine", "pirate", "pixel", "pizza", "planet", "plaza",
+	"plum", "pocket", "poem", "polar", "pony", "poodle", "poppy", "portal",
+	"potato", "prairie", "prism", "pudding", "pulse", "pumpkin", "puppet",
+	"puzzle", "quail", "quartz", "quest", "quill", "quilt", "rabbit", "radar",
+	"radio", "raft", "rain", "ranch", "raven", "recipe", "reef", "relic",
+	"rhino", "ribbon", "ridge", "river", "robin", "rocket", "rodeo", "roof",
+	"rose", "ruby", "rugby", "saddle", "safari", "saga", "salad", "salmon",
+	"salsa", "sandal", "satin", "sauce", "scarf", "scout", "season", "shadow",
+	"shark", "shell", "sherpa", "shield", "shrimp", "silk", "silver", "siren",
+	"sketch", "skiff", "sled", "sloth", "smile", "snail", "sonnet", "spark",
+	"spice", "spider", "spiral", "sponge", "spoon", "spruce", "squash", "squid",
+	"stable", "stamp", "star", "statue", "stone", "storm", "stream", "studio",
+	"sugar", "summit", "sunset", "swan", "sweater", "syrup", "table", "taco",
+	"tango", "teapot", "temple", "tennis", "thistle", "thunder", "tiger",
+	"timber", "toast", "tomato", "topaz", "torch", "tower", "toy", "tractor",
+	"trail", "trout", "truffle", "tulip", "tuna", "tunnel", "turtle", "tuxedo",
+	"twig", "umbrella", "unicorn", "urban", "valley", "vapor", "velvet",
+	"violet", "violin", "visor", "vortex", "voyage", "waffle", "wagon",
+	"walnut", "walrus", "wand", "water", "wave", "whale", "wheat", "whistle",
+	"willow", "window", "winter", "wizard", "wolf", "wombat", "wonder", "yacht",
+	"yarn", "yodel", "yogurt", "zebra", "zephyr", "zinc", "zipper", "zodiac",
+	"zone",
+}
@@ -0,0 +1,299 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+)
+
+func TestDatabaseGeneratePassword(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseGeneratePassword")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	testcases := []struct {
+		name       string
+		policy     PasswordPolicy
+		passphrase bool
+		length     int
+		words      int
+		separator  string
+		want       map[string]interface{}
+		shouldErr  bool
+		err        error
+	}{
+		{
+			name:   "generate password with default length",
+			policy: PasswordPolicy{MinLength: 8, MaxLength: 128},
+			want: map[string]interface{}{
+				"length":    16,
+				"lowercase": true,
+				"uppercase": true,
+				"number":    true,
+				"symbol":    true,
+			},
+		},
+		{
+			name:   "generate password with policy minimum length",
+			policy: PasswordPolicy{MinLength: 24, MaxLength: 128, MinScore: 4},
+			want: map[string]interface{}{
+				"length":    24,
+				"lowercase": true,
+				"uppercase": true,
+				"number":    true,
+				"symbol":    true,
+			},
+		},
+		{
+			name:   "generate password with policy maximum length",
+			policy: PasswordPolicy{MinLength: 4, MaxLength: 10},
+			want: map[string]interface{}{
+				"length":    10,
+				"lowercase": true,
+				"uppercase": true,
+				"number":    true,
+				"symbol":    true,
+			},
+		},
+		{
+			name:      "generate password shorter than policy minimum length",
+			policy:    PasswordPolicy{MinLength: 8, MaxLength: 128},
+			length:    6,
+			shouldErr: true,
+			err:       errors.ErrPasswordGenerator.WithArgs(errors.ErrPasswordGeneratorLengthPolicy.WithArgs(6, 8, 128)),
+		},
+		{
+			name:      "generate password longer than policy maximum length",
+			policy:    PasswordPolicy{MinLength: 8, MaxLength: 128},
+			length:    129,
+			shouldErr: true,
+			err:       errors.ErrPasswordGenerator.WithArgs(errors.ErrPasswordGeneratorLengthPolicy.WithArgs(129, 8, 128)),
+		},
+		{
+			name:      "generate password with too short length",
+			policy:    PasswordPolicy{MinLength: 2, MaxLength: 128},
+			length:    3,
+			shouldErr: true,
+			err:       errors.ErrPasswordGenerator.WithArgs(errors.ErrPasswordGeneratorLength.WithArgs(3)),
+		},
+		{
+			name:       "generate passphrase with default options",
+			policy:     PasswordPolicy{MinLength: 8, MaxLength: 128},
+			passphrase: true,
+			want: map[string]interface{}{
+				"words":     6,
+				"lowercase": true,
+				"uppercase": false,
+				"number":    false,
+				"symbol":    true,
+			},
+		},
+		{
+			name: "generate passphrase with character requirements",
+			policy: PasswordPolicy{
+				MinLength: 8, MaxLength: 128, MinScore: 4,
+				RequireUppercase: true, RequireNumber: true, RequireNonAlphaNumeric: true,
+			},
+			passphrase: true,
+			words:      4,
+			separator:  " ",
+			want: map[string]interface{}{
+				"words":     4,
+				"lowercase": true,
+				"uppercase": true,
+				"number":    true,
+				"symbol":    true,
+			},
+		},
+		{
+			name:       "generate passphrase longer than policy minimum length",
+			policy:     PasswordPolicy{MinLength: 64, MaxLength: 128},
+			passphrase: true,
+			words:      2,
+			separator:  ".",
+			want: map[string]interface{}{
+				"min_length": true,
+				"lowercase":  true,
+				"uppercase":  false,
+				"number":     false,
+				"symbol":     true,
+			},
+		},
+		{
+			name:       "generate passphrase with invalid word count",
+			policy:     PasswordPolicy{MinLength: 8, MaxLength: 128},
+			passphrase: true,
+			words:      -1,
+			shouldErr:  true,
+			err:        errors.ErrPasswordGenerator.WithArgs(errors.ErrPasswordGeneratorWords.WithArgs(-1)),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s string
+			var err error
+			db.Policy.Password = tc.policy
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if tc.passphrase {
+				s, err = db.GeneratePassphrase(tc.words, tc.separator)
+			} else {
+				s, err = db.GeneratePassword(tc.length)
+			}
+			if tests.EvalErrWithLog(t, err, "generate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			msgs = append(msgs, fmt.Sprintf("password: %s", s))
+			if err := db.checkPasswordPolicyCompliance(s); err != nil {
+				t.Fatalf("generated password %q is not compliant: %v", s, err)
+			}
+			got := make(map[string]interface{})
+			if _, exists := tc.want["length"]; exists {
+				got["length"] = len(s)
+			}
+			if _, exists := tc.want["words"]; exists {
+				sep := tc.separator
+				if sep == "" {
+					sep = "-"
+				}
+				got["words"] = len(strings.Split(s, sep))
+			}
+			if _, exists := tc.want["min_length"]; exists {
+				got["min_length"] = len(s) >= tc.policy.MinLength
+			}
+			got["lowercase"] = regexp.MustCompile(`[a-z]`).MatchString(s)
+			got["uppercase"] = regexp.MustCompile(`[A-Z]`).MatchString(s)
+			got["number"] = regexp.MustCompile(`[0-9]`).MatchString(s)
+			got["symbol"] = regexp.MustCompile(`[^a-zA-Z0-9]`).MatchString(s)
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseMustChangePassword(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseMustChangePassword")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	password, err := db.GeneratePassword(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPassword, err := db.GeneratePassphrase(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		name      string
+		operation string
+		req       *requests.Request
+		want      map[string]interface{}
+	}{
+		{
+			name:      "add user with generated password",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foobar",
+					Password: password,
+					Email:    "foobar@barfoo",
+				},
+				Flags: requests.Flags{
+					MustChangePassword: true,
+				},
+			},
+		},
+		{
+			name:      "authenticate user with generated password",
+			operation: "authenticate",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foobar",
+					Password: password,
+				},
+			},
+			want: map[string]interface{}{
+				"must_change_password": true,
+			},
+		},
+		{
+			name:      "change generated password",
+			operation: "change",
+			req: &requests.Request{
+				User: requests.User{
+					Username:    "foobar",
+					Email:       "foobar@barfoo",
+					OldPassword: password,
+					Password:    newPassword,
+				},
+			},
+		},
+		{
+			name:      "authenticate user with changed password",
+			operation: "authenticate",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foobar",
+					Password: newPassword,
+				},
+			},
+			want: map[string]interface{}{
+				"must_change_password": false,
+			},
+		},
+		{
+			name:      "authenticate existing user",
+			operation: "authenticate",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Password: testPwd1,
+				},
+			},
+			want: map[string]interface{}{
+				"must_change_password": false,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			switch tc.operation {
+			case "add":
+				err = db.AddUser(tc.req)
+			case "change":
+				err = db.ChangeUserPassword(tc.req)
+			case "authenticate":
+				err = db.AuthenticateUser(tc.req)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.operation != "authenticate" {
+				return
+			}
+			got := make(map[string]interface{})
+			got["must_change_password"] = tc.req.Flags.MustChangePassword
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
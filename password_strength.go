@@ -0,0 +1,731 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	passwordStrengthBruteforceCardinality = 10
+	passwordStrengthMinGuessesSingleChar  = 10
+	passwordStrengthMinGuessesMultiChar   = 50
+	passwordStrengthMinYearSpace          = 20
+	passwordStrengthMaxScore              = 4
+	// passwordStrengthMaxLength is the number of leading characters of a
+	// password evaluated for the strength. The remaining characters are
+	// ignored.
+	passwordStrengthMaxLength = 100
+	// passwordStrengthMaxGuessesLog10 is the upper bound of the base 10
+	// logarithm of the number of guesses.
+	passwordStrengthMaxGuessesLog10 = 300
+)
+
+var (
+	passwordDictionaries map[string]map[string]int
+	// passwordDictionaryMaxLength is the length of the longest word of the
+	// password dictionaries.
+	passwordDictionaryMaxLength int
+	passwordL33tTables          = []map[rune]rune{
+		{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g',
+			'1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+		{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g',
+			'1': 'l', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+	}
+	passwordKeyboardRows = []string{
+		"`1234567890-=",
+		"qwertyuiop[]\\",
+		"asdfghjkl;'",
+		"zxcvbnm,./",
+	}
+	passwordKeyboardShiftRows = []string{
+		"~!@#$%^&*()_+",
+		"QWERTYUIOP{}|",
+		"ASDFGHJKL:\"",
+		"ZXCVBNM<>?",
+	}
+	passwordKeyboardStartingPositions = 94.0
+	passwordKeyboardAverageDegree     = 4.6
+)
+
+func init() {
+	passwordDictionaries = map[string]map[string]int{
+		"passwords": make(map[string]int),
+		"english":   make(map[string]int),
+	}
+	for i, w := range commonPasswords {
+		if _, exists := passwordDictionaries["passwords"][w]; !exists {
+			passwordDictionaries["passwords"][w] = i + 1
+		}
+	}
+	for i, w := range commonWords {
+		if _, exists := passwordDictionaries["english"][w]; !exists {
+			passwordDictionaries["english"][w] = i + 1
+		}
+	}
+	for _, dict := range passwordDictionaries {
+		if n := getPasswordDictionaryMaxLength(dict); n > passwordDictionaryMaxLength {
+			passwordDictionaryMaxLength = n
+		}
+	}
+}
+
+// PasswordStrength is the estimated strength of a password.
+type PasswordStrength struct {
+	// Score is the strength score on the scale from 0 (too guessable)
+	// to 4 (very unguessable).
+	Score       int      `json:"score,omitempty" xml:"score,omitempty" yaml:"score,omitempty"`
+	Guesses     float64  `json:"guesses,omitempty" xml:"guesses,omitempty" yaml:"guesses,omitempty"`
+	Entropy     float64  `json:"entropy,omitempty" xml:"entropy,omitempty" yaml:"entropy,omitempty"`
+	Patterns    []string `json:"patterns,omitempty" xml:"patterns,omitempty" yaml:"patterns,omitempty"`
+	Warning     string   `json:"warning,omitempty" xml:"warning,omitempty" yaml:"warning,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty" xml:"suggestions,omitempty" yaml:"suggestions,omitempty"`
+}
+
+// PasswordStrengthMatch is a guessable pattern found in a password.
+type PasswordStrengthMatch struct {
+	// Pattern is any of the following: dictionary, spatial, repeat,
+	// sequence, year, bruteforce.
+	Pattern     string  `json:"pattern,omitempty" xml:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Start       int     `json:"start,omitempty" xml:"start,omitempty" yaml:"start,omitempty"`
+	End         int     `json:"end,omitempty" xml:"end,omitempty" yaml:"end,omitempty"`
+	Token       string  `json:"token,omitempty" xml:"token,omitempty" yaml:"token,omitempty"`
+	Dictionary  string  `json:"dictionary,omitempty" xml:"dictionary,omitempty" yaml:"dictionary,omitempty"`
+	Rank        int     `json:"rank,omitempty" xml:"rank,omitempty" yaml:"rank,omitempty"`
+	Reversed    bool    `json:"reversed,omitempty" xml:"reversed,omitempty" yaml:"reversed,omitempty"`
+	Substituted bool    `json:"substituted,omitempty" xml:"substituted,omitempty" yaml:"substituted,omitempty"`
+	Turns       int     `json:"turns,omitempty" xml:"turns,omitempty" yaml:"turns,omitempty"`
+	Ascending   bool    `json:"ascending,omitempty" xml:"ascending,omitempty" yaml:"ascending,omitempty"`
+	BaseToken   string  `json:"base_token,omitempty" xml:"base_token,omitempty" yaml:"base_token,omitempty"`
+	Guesses     float64 `json:"guesses,omitempty" xml:"guesses,omitempty" yaml:"guesses,omitempty"`
+}
+
+// NewPasswordStrength returns an instance of PasswordStrength for the
+// provided password. The user inputs, e.g. username, email address, and
+// name, are treated as the most guessable dictionary words. Only the first
+// 100 characters of the password are evaluated.
+func NewPasswordStrength(s string, userInputs []string) *PasswordStrength {
+	ps := &PasswordStrength{}
+	if s == "" {
+		ps.Guesses = 1
+		ps.Warning = "Password is empty"
+		ps.Suggestions = []string{"Use a few words, avoid common phrases"}
+		return ps
+	}
+	if chars := []rune(s); len(chars) > passwordStrengthMaxLength {
+		s = string(chars[:passwordStrengthMaxLength])
+	}
+	matches, guesses := estimatePasswordGuesses(s, getPasswordUserInputs(userInputs))
+	ps.Guesses = guesses
+	ps.Entropy = math.Log2(guesses)
+	ps.Score = getPasswordStrengthScore(guesses)
+	patterns := make(map[string]bool)
+	for _, m := range matches {
+		if m.Pattern == "bruteforce" || patterns[m.Pattern] {
+			continue
+		}
+		patterns[m.Pattern] = true
+		ps.Patterns = append(ps.Patterns, m.Pattern)
+	}
+	ps.getFeedback(matches)
+	return ps
+}
+
+func getPasswordStrengthScore(guesses float64) int {
+	delta := 5.0
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	}
+	return passwordStrengthMaxScore
+}
+
+// getPasswordUserInputs splits user inputs into lowercase tokens, e.g.
+// an email address becomes the address, its local part, and the words
+// of the local part.
+func getPasswordUserInputs(inputs []string) map[string]int {
+	tokens := make(map[string]int)
+	rank := 1
+	add := func(s string) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len([]rune(s)) < 3 {
+			return
+		}
+		if _, exists := tokens[s]; exists {
+			return
+		}
+		tokens[s] = rank
+		rank++
+	}
+	for _, input := range inputs {
+		add(input)
+		if i := strings.Index(input, "@"); i > 0 {
+			add(input[:i])
+		}
+		for _, w := range strings.FieldsFunc(input, func(c rune) bool {
+			return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+		}) {
+			add(w)
+		}
+	}
+	return tokens
+}
+
+// estimatePasswordGuesses finds the sequence of non-overlapping matches
+// which requires the least amount of guesses to cover the password.
+func estimatePasswordGuesses(s string, userInputs map[string]int) ([]*PasswordStrengthMatch, float64) {
+	chars := []rune(s)
+	n := len(chars)
+	var matches []*PasswordStrengthMatch
+	matches = append(matches, getPasswordDictionaryMatches(chars, userInputs)...)
+	matches = append(matches, getPasswordSpatialMatches(chars)...)
+	matches = append(matches, getPasswordRepeatMatches(chars, userInputs)...)
+	matches = append(matches, getPasswordSequenceMatches(chars)...)
+	matches = append(matches, getPasswordYearMatches(chars)...)
+
+	byEnd := make([][]*PasswordStrengthMatch, n)
+	for _, m := range matches {
+		if m.Start != 0 || m.End != n-1 {
+			minGuesses := float64(passwordStrengthMinGuessesMultiChar)
+			if m.End == m.Start {
+				minGuesses = passwordStrengthMinGuessesSingleChar
+			}
+			if m.Guesses < minGuesses {
+				m.Guesses = minGuesses
+			}
+		}
+		byEnd[m.End] = append(byEnd[m.End], m)
+	}
+
+	// The cost is the base 10 logarithm of the number of guesses.
+	cost := make([]float64, n+1)
+	back := make([]*PasswordStrengthMatch, n+1)
+	for i := 1; i <= n; i++ {
+		cost[i] = cost[i-1] + math.Log10(passwordStrengthBruteforceCardinality)
+		back[i] = &PasswordStrengthMatch{
+			Pattern: "bruteforce",
+			Start:   i - 1,
+			End:     i - 1,
+			Token:   string(chars[i-1]),
+			Guesses: passwordStrengthBruteforceCardinality,
+		}
+		for _, m := range byEnd[i-1] {
+			c := cost[m.Start] + math.Log10(m.Guesses)
+			if c < cost[i] {
+				cost[i] = c
+				back[i] = m
+			}
+		}
+	}
+
+	var sequence []*PasswordStrengthMatch
+	for i := n; i > 0; {
+		m := back[i]
+		sequence = append([]*PasswordStrengthMatch{m}, sequence...)
+		i = m.Start
+	}
+	if cost[n] > passwordStrengthMaxGuessesLog10 {
+		cost[n] = passwordStrengthMaxGuessesLog10
+	}
+	return sequence, math.Pow(10, cost[n])
+}
+
+func getPasswordDictionaryMatches(chars []rune, userInputs map[string]int) []*PasswordStrengthMatch {
+	var matches []*PasswordStrengthMatch
+	dictionaries := map[string]map[string]int{"user_inputs": userInputs}
+	for k, v := range passwordDictionaries {
+		dictionaries[k] = v
+	}
+	maxLength := passwordDictionaryMaxLength
+	if n := getPasswordDictionaryMaxLength(userInputs); n > maxLength {
+		maxLength = n
+	}
+	lower := []rune(strings.ToLower(string(chars)))
+	if len(lower) != len(chars) {
+		lower = chars
+	}
+	n := len(chars)
+	for i := 0; i < n; i++ {
+		for j := i + 2; j < n && j < i+maxLength; j++ {
+			token := string(chars[i : j+1])
+			word := string(lower[i : j+1])
+			candidates := map[string]bool{}
+			for _, table := range passwordL33tTables {
+				candidates[unleetPasswordToken(word, table)] = true
+			}
+			for dictName, dict := range dictionaries {
+				if m := lookupPasswordDictionary(dict, word, token, dictName, i, j); m != nil {
+					matches = append(matches, m)
+				}
+				if m := lookupPasswordDictionary(dict, reversePasswordToken(word), token, dictName, i, j); m != nil {
+					m.Reversed = true
+					m.Guesses *= 2
+					matches = append(matches, m)
+				}
+				for candidate := range candidates {
+					if candidate == word {
+						continue
+					}
+					if m := lookupPasswordDictionary(dict, candidate, token, dictName, i, j); m != nil {
+						m.Substituted = true
+						m.Guesses *= getPasswordL33tVariations(word, candidate)
+						matches = append(matches, m)
+					}
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// getPasswordDictionaryMaxLength returns the length of the longest word of
+// a dictionary.
+func getPasswordDictionaryMaxLength(dict map[string]int) int {
+	var maxLength int
+	for w := range dict {
+		if n := len([]rune(w)); n > maxLength {
+			maxLength = n
+		}
+	}
+	return maxLength
+}
+
+func lookupPasswordDictionary(dict map[string]int, word, token, dictName string, i, j int) *PasswordStrengthMatch {
+	rank, exists := dict[word]
+	if !exists {
+		return nil
+	}
+	return &PasswordStrengthMatch{
+		Pattern:    "dictionary",
+		Start:      i,
+		End:        j,
+		Token:      token,
+		Dictionary: dictName,
+		Rank:       rank,
+		Guesses:    float64(rank) * getPasswordUppercaseVariations(token),
+	}
+}
+
+func unleetPasswordToken(s string, table map[rune]rune) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if v, exists := table[c]; exists {
+			sb.WriteRune(v)
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func reversePasswordToken(s string) string {
+	chars := []rune(s)
+	for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
+
+func getPasswordUppercaseVariations(s string) float64 {
+	var upper, lower int
+	chars := []rune(s)
+	for _, c := range chars {
+		switch {
+		case unicode.IsUpper(c):
+			upper++
+		case unicode.IsLower(c):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if lower == 0 {
+		return 2
+	}
+	if upper == 1 && (unicode.IsUpper(chars[0]) || unicode.IsUpper(chars[len(chars)-1])) {
+		return 2
+	}
+	var variations float64
+	for i := 1; i <= upper && i <= lower; i++ {
+		variations += getPasswordBinomial(upper+lower, i)
+	}
+	return variations
+}
+
+func getPasswordL33tVariations(token, word string) float64 {
+	variations := 1.0
+	subs := make(map[rune]rune)
+	tokenChars := []rune(token)
+	wordChars := []rune(word)
+	for i := range tokenChars {
+		if tokenChars[i] != wordChars[i] {
+			subs[tokenChars[i]] = wordChars[i]
+		}
+	}
+	for subbed, unsubbed := range subs {
+		var s, u int
+		for _, c := range tokenChars {
+			switch c {
+			case subbed:
+				s++
+			case unsubbed:
+				u++
+			}
+		}
+		if s == 0 || u == 0 {
+			variations *= 2
+			continue
+		}
+		var v float64
+		for i := 1; i <= s && i <= u; i++ {
+			v += getPasswordBinomial(s+u, i)
+		}
+		variations *= v
+	}
+	return variations
+}
+
+func getPasswordBinomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n)
+		r /= float64(d)
+		n--
+	}
+	return r
+}
+
+// getPasswordKeyPosition returns the row and the column of a character on
+// a QWERTY keyboard and whether the character requires shift key.
+func getPasswordKeyPosition(c rune) (int, int, bool, bool) {
+	for i, row := range passwordKeyboardRows {
+		if j := strings.IndexRune(row, c); j >= 0 {
+			return i, j, false, true
+		}
+	}
+	for i, row := range passwordKeyboardShiftRows {
+		if j := strings.IndexRune(row, c); j >= 0 {
+			return i, j, true, true
+		}
+	}
+	return 0, 0, false, false
+}
+
+// getPasswordKeyDirection returns the direction from the key at
+// position (r1, c1) to an adjacent key at position (r2, c2). The keyboard
+// is slanted, i.e. each row is shifted by a half key.
+func getPasswordKeyDirection(r1, c1, r2, c2 int) int {
+	switch {
+	case r2 == r1 && c2 == c1-1:
+		return 1
+	case r2 == r1 && c2 == c1+1:
+		return 2
+	case r2 == r1-1 && c2 == c1:
+		return 3
+	case r2 == r1-1 && c2 == c1+1:
+		return 4
+	case r2 == r1+1 && c2 == c1-1:
+		return 5
+	case r2 == r1+1 && c2 == c1:
+		return 6
+	}
+	return 0
+}
+
+func getPasswordSpatialMatches(chars []rune) []*PasswordStrengthMatch {
+	var matches []*PasswordStrengthMatch
+	n := len(chars)
+	for i := 0; i < n-2; {
+		j := i
+		turns := 0
+		shifted := 0
+		lastDirection := -1
+		r1, c1, shift, ok := getPasswordKeyPosition(chars[i])
+		if !ok {
+			i++
+			continue
+		}
+		if shift {
+			shifted++
+		}
+		for j+1 < n {
+			r2, c2, shift, ok := getPasswordKeyPosition(chars[j+1])
+			if !ok {
+				break
+			}
+			direction := getPasswordKeyDirection(r1, c1, r2, c2)
+			if direction == 0 {
+				break
+			}
+			if direction != lastDirection {
+				turns++
+				lastDirection = direction
+			}
+			if shift {
+				shifted++
+			}
+			r1, c1 = r2, c2
+			j++
+		}
+		if j-i+1 >= 3 {
+			m := &PasswordStrengthMatch{
+				Pattern: "spatial",
+				Start:   i,
+				End:     j,
+				Token:   string(chars[i : j+1]),
+				Turns:   turns,
+			}
+			m.Guesses = getPasswordSpatialGuesses(j-i+1, turns, shifted)
+			matches = append(matches, m)
+		}
+		i = j + 1
+	}
+	return matches
+}
+
+func getPasswordSpatialGuesses(length, turns, shifted int) float64 {
+	var guesses float64
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= turns && j <= i-1; j++ {
+			guesses += getPasswordBinomial(i-1, j-1) * passwordKeyboardStartingPositions * math.Pow(passwordKeyboardAverageDegree, float64(j))
+		}
+	}
+	unshifted := length - shifted
+	switch {
+	case shifted == 0:
+	case unshifted == 0:
+		guesses *= 2
+	default:
+		var variations float64
+		for i := 1; i <= shifted && i <= unshifted; i++ {
+			variations += getPasswordBinomial(shifted+unshifted, i)
+		}
+		guesses *= variations
+	}
+	return guesses
+}
+
+func getPasswordRepeatMatches(chars []rune, userInputs map[string]int) []*PasswordStrengthMatch {
+	var matches []*PasswordStrengthMatch
+	n := len(chars)
+	for i := 0; i < n-1; {
+		var best *PasswordStrengthMatch
+		for size := 1; i+2*size <= n; size++ {
+			base := string(chars[i : i+size])
+			count := 1
+			for k := i + size; k+size <= n && string(chars[k:k+size]) == base; k += size {
+				count++
+			}
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+			end := i + size*count - 1
+			if best != nil && end <= best.End {
+				continue
+			}
+			_, baseGuesses := estimatePasswordGuesses(base, userInputs)
+			best = &PasswordStrengthMatch{
+				Pattern:   "repeat",
+				Start:     i,
+				End:       end,
+				Token:     string(chars[i : end+1]),
+				BaseToken: base,
+				Guesses:   baseGuesses * float64(count),
+			}
+		}
+		if best == nil {
+			i++
+			continue
+		}
+		matches = append(matches, best)
+		i = best.End + 1
+	}
+	return matches
+}
+
+func getPasswordSequenceMatches(chars []rune) []*PasswordStrengthMatch {
+	var matches []*PasswordStrengthMatch
+	n := len(chars)
+	sameClass := func(a, b rune) bool {
+		switch {
+		case unicode.IsDigit(a):
+			return unicode.IsDigit(b)
+		case unicode.IsLower(a):
+			return unicode.IsLower(b)
+		case unicode.IsUpper(a):
+			return unicode.IsUpper(b)
+		}
+		return false
+	}
+	for i := 0; i < n-2; {
+		delta := chars[i+1] - chars[i]
+		if delta == 0 || delta > 5 || delta < -5 || !sameClass(chars[i], chars[i+1]) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j+1 < n && chars[j+1]-chars[j] == delta && sameClass(chars[j], chars[j+1]) {
+			j++
+		}
+		if j-i+1 < 3 {
+			i++
+			continue
+		}
+		m := &PasswordStrengthMatch{
+			Pattern:   "sequence",
+			Start:     i,
+			End:       j,
+			Token:     string(chars[i : j+1]),
+			Ascending: delta > 0,
+		}
+		var base float64
+		switch {
+		case strings.ContainsRune("aAzZ019", chars[i]):
+			base = 4
+		case unicode.IsDigit(chars[i]):
+			base = 10
+		default:
+			base = 26
+		}
+		if !m.Ascending {
+			base *= 2
+		}
+		m.Guesses = base * float64(j-i+1)
+		matches = append(matches, m)
+		i = j + 1
+	}
+	return matches
+}
+
+func getPasswordYearMatches(chars []rune) []*PasswordStrengthMatch {
+	var matches []*PasswordStrengthMatch
+	referenceYear := time.Now().UTC().Year()
+	for i := 0; i+4 <= len(chars); i++ {
+		token := string(chars[i : i+4])
+		if !strings.HasPrefix(token, "19") && !strings.HasPrefix(token, "20") {
+			continue
+		}
+		year, err := strconv.Atoi(token)
+		if err != nil {
+			continue
+		}
+		space := math.Abs(float64(year - referenceYear))
+		if space < passwordStrengthMinYearSpace {
+			space = passwordStrengthMinYearSpace
+		}
+		matches = append(matches, &PasswordStrengthMatch{
+			Pattern: "year",
+			Start:   i,
+			End:     i + 3,
+			Token:   token,
+			Guesses: space,
+		})
+	}
+	return matches
+}
+
+// getFeedback sets the warning and suggestions for weak passwords based on
+// the longest guessable pattern found in the password.
+func (ps *PasswordStrength) getFeedback(matches []*PasswordStrengthMatch) {
+	if ps.Score > 2 {
+		return
+	}
+	var longest *PasswordStrengthMatch
+	for _, m := range matches {
+		if m.Pattern == "bruteforce" {
+			continue
+		}
+		if longest == nil || (m.End-m.Start) > (longest.End-longest.Start) {
+			longest = m
+		}
+	}
+	defaultSuggestion := "Add another word or two. Uncommon words are better."
+	if longest == nil {
+		ps.Suggestions = []string{
+			"Use a few words, avoid common phrases",
+			"No need for symbols, digits, or uppercase letters",
+		}
+		return
+	}
+
+	switch longest.Pattern {
+	case "dictionary":
+		switch {
+		case longest.Dictionary == "user_inputs":
+			ps.Warning = "Passwords containing your username, email address or name are easy to guess"
+		case longest.Dictionary == "passwords" && !longest.Substituted && !longest.Reversed && len(matches) == 1:
+			switch {
+			case longest.Rank <= 10:
+				ps.Warning = "This is a top-10 common password"
+			case longest.Rank <= 100:
+				ps.Warning = "This is a top-100 common password"
+			default:
+				ps.Warning = "This is a very common password"
+			}
+		case longest.Dictionary == "passwords":
+			ps.Warning = "This is similar to a commonly used password"
+		case len(matches) == 1:
+			ps.Warning = "A word by itself is easy to guess"
+		}
+		ps.Suggestions = append(ps.Suggestions, defaultSuggestion)
+		token := []rune(longest.Token)
+		switch {
+		case strings.ToUpper(longest.Token) == longest.Token && strings.ToLower(longest.Token) != longest.Token:
+			ps.Suggestions = append(ps.Suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+		case unicode.IsUpper(token[0]):
+			ps.Suggestions = append(ps.Suggestions, "Capitalization doesn't help very much")
+		}
+		if longest.Reversed {
+			ps.Suggestions = append(ps.Suggestions, "Reversed words aren't much harder to guess")
+		}
+		if longest.Substituted {
+			ps.Suggestions = append(ps.Suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+		}
+	case "spatial":
+		if longest.Turns == 1 {
+			ps.Warning = "Straight rows of keys are easy to guess"
+		} else {
+			ps.Warning = "Short keyboard patterns are easy to guess"
+		}
+		ps.Suggestions = []string{defaultSuggestion, "Use a longer keyboard pattern with more turns"}
+	case "repeat":
+		if len([]rune(longest.BaseToken)) == 1 {
+			ps.Warning = "Repeats like \"aaa\" are easy to guess"
+		} else {
+			ps.Warning = "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\""
+		}
+		ps.Suggestions = []string{defaultSuggestion, "Avoid repeated words and characters"}
+	case "sequence":
+		ps.Warning = "Sequences like abc or 6543 are easy to guess"
+		ps.Suggestions = []string{defaultSuggestion, "Avoid sequences"}
+	case "year":
+		ps.Warning = "Recent years are easy to guess"
+		ps.Suggestions = []string{defaultSuggestion, "Avoid recent years", "Avoid years that are associated with you"}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+// commonPasswords is the list of frequently used passwords, ordered by
+// their popularity.
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234",
+	"111111", "1234567", "dragon", "123123", "baseball", "abc123", "football",
+	"monkey", "letmein", "696969", "shadow", "master", "666666", "qwertyuiop",
+	"123321", "mustang", "1234567890", "michael", "654321", "superman",
+	"1qaz2wsx", "7777777", "121212", "000000", "qazwsx", "123qwe", "killer",
+	"trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter", "buster",
+	"soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel",
+	"starwars", "klaster", "112233", "george", "computer", "michelle",
+	"jessica", "pepper", "1111", "zxcvbn", "555555", "11111111", "131313",
+	"freedom", "777777", "pass", "maggie", "159753", "aaaaaa", "ginger",
+	"princess", "joshua", "cheese", "amanda", "summer", "love", "ashley",
+	"nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321",
+	"dallas", "austin", "thunder", "taylor", "matrix", "welcome", "admin",
+	"login", "passw0rd", "qwerty123", "solo", "secret", "flower", "hello",
+	"whatever", "lovely", "hottie", "loveme", "zaq1zaq1", "password1",
+	"changeme", "default", "guest", "root", "toor", "letmein1", "monkey1",
+	"football1", "baseball1", "abcdef", "abcd1234", "q1w2e3r4", "1q2w3e4r",
+	"test", "test123", "temp", "temp123", "p@ssw0rd", "administrator",
+}
+
+// commonWords is the list of frequently used English words, ordered by
+// their popularity.
+var commonWords = []string{
+	"the", "you", "and", "that", "have", "for", "not", "with", "this", "but",
+	"his", "from", "they", "say", "her", "she", "will", "one", "all", "would",
+	"there", "their", "what", "out", "about", "who", "get", "which", "when",
+	"make", "can", "like", "time", "just", "him", "know", "take", "people",
+	"into", "year", "your", "good", "some", "could", "them", "see", "other",
+	"than", "then", "now", "look", "only", "come", "its", "over", "think",
+	"also", "back", "after", "use", "two", "how", "our", "work", "first",
+	"well", "way", "even", "new", "want", "because", "any", "these", "give",
+	"day", "most", "cat", "dog", "sun", "moon", "star", "blue", "red", "green",
+	"black", "white", "apple", "orange", "house", "home", "family", "friend",
+	"school", "water", "fire", "earth", "world", "money", "life", "happy",
+	"angel", "baby", "music", "summer", "winter", "spring", "autumn", "secret",
+	"dream", "heart", "magic", "power", "tiger", "lion", "eagle", "horse",
+	"dragon", "monkey", "purple", "silver", "golden", "diamond", "forever",
+	"mother", "father", "sister", "brother", "love", "hello", "welcome",
+	"password", "login", "admin", "user", "master", "super", "secure",
+	"company", "office", "winner", "sunshine", "princess", "qwerty", "guitar",
+	"soccer", "hockey", "coffee", "cookie", "chocolate", "pizza", "cheese",
+	"banana", "computer", "internet", "google", "facebook", "monday",
+	"tuesday", "wednesday", "thursday", "friday", "saturday", "sunday",
+	"january", "february", "march", "april", "june", "july", "august",
+	"september", "october", "november", "december", "correct", "battery",
+	"staple",
+}
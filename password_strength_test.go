@@ -0,0 +1,266 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+)
+
+func TestNewPasswordStrength(t *testing.T) {
+	userInputs := []string{"jsmith", "jsmith@gmail.com", "Smith, John"}
+	testcases := []struct {
+		name  string
+		input string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "test top-10 common password",
+			input: "password",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string{"dictionary"},
+				"warning":  "This is a top-10 common password",
+			},
+		},
+		{
+			name:  "test l33t common password",
+			input: "p@ssw0rd",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string{"dictionary"},
+				"warning":  "This is similar to a commonly used password",
+			},
+		},
+		{
+			name:  "test reversed common password",
+			input: "drowssap",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string{"dictionary"},
+				"warning":  "This is similar to a commonly used password",
+			},
+		},
+		{
+			name:  "test keyboard pattern",
+			input: "zxcvbnmasdf",
+			want: map[string]interface{}{
+				"score":    1,
+				"patterns": []string{"dictionary", "spatial"},
+				"warning":  "This is similar to a commonly used password",
+			},
+		},
+		{
+			name:  "test repeated characters",
+			input: "aaaaaaaa",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string{"repeat"},
+				"warning":  "Repeats like \"aaa\" are easy to guess",
+			},
+		},
+		{
+			name:  "test repeated words",
+			input: "abcabcabc",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string{"repeat"},
+				"warning":  "Repeats like \"abcabcabc\" are only slightly harder to guess than \"abc\"",
+			},
+		},
+		{
+			name:  "test sequence",
+			input: "abcdefgh",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string{"sequence"},
+				"warning":  "Sequences like abc or 6543 are easy to guess",
+			},
+		},
+		{
+			name:  "test username with year",
+			input: "jsmith1999",
+			want: map[string]interface{}{
+				"score":    1,
+				"patterns": []string{"dictionary", "year"},
+				"warning":  "Passwords containing your username, email address or name are easy to guess",
+			},
+		},
+		{
+			name:  "test passphrase",
+			input: "correcthorsebatterystaple",
+			want: map[string]interface{}{
+				"score":    3,
+				"patterns": []string{"dictionary"},
+				"warning":  "",
+			},
+		},
+		{
+			name:  "test random password",
+			input: "X9#kq!vL2zPw",
+			want: map[string]interface{}{
+				"score":    4,
+				"patterns": []string(nil),
+				"warning":  "",
+			},
+		},
+		{
+			name:  "test empty password",
+			input: "",
+			want: map[string]interface{}{
+				"score":    0,
+				"patterns": []string(nil),
+				"warning":  "Password is empty",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			ps := NewPasswordStrength(tc.input, userInputs)
+			msgs = append(msgs, fmt.Sprintf("guesses: %v", ps.Guesses))
+			msgs = append(msgs, fmt.Sprintf("suggestions: %v", ps.Suggestions))
+			if _, err := json.Marshal(ps); err != nil {
+				t.Fatalf("failed marshaling password strength: %v", err)
+			}
+			got := make(map[string]interface{})
+			got["score"] = ps.Score
+			got["patterns"] = ps.Patterns
+			got["warning"] = ps.Warning
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestNewPasswordStrengthLongInput(t *testing.T) {
+	for _, n := range []int{100, 101, 2000} {
+		t.Run(fmt.Sprintf("test %d characters", n), func(t *testing.T) {
+			ps := NewPasswordStrength(GetRandomString(n), nil)
+			if math.IsInf(ps.Guesses, 0) || math.IsNaN(ps.Guesses) {
+				t.Fatalf("unexpected guesses: %v", ps.Guesses)
+			}
+			if math.IsInf(ps.Entropy, 0) || math.IsNaN(ps.Entropy) {
+				t.Fatalf("unexpected entropy: %v", ps.Entropy)
+			}
+			if ps.Score != passwordStrengthMaxScore {
+				t.Fatalf("unexpected score: %d", ps.Score)
+			}
+			if _, err := json.Marshal(ps); err != nil {
+				t.Fatalf("failed marshaling password strength: %v", err)
+			}
+		})
+	}
+}
+
+func TestDatabasePasswordStrength(t *testing.T) {
+	db, err := createTestDatabase("TestDatabasePasswordStrength")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db.Policy.Password.MinScore = 3
+	testcases := []struct {
+		name      string
+		operation string
+		req       *requests.Request
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "get strength of password based on username",
+			operation: "get",
+			req: &requests.Request{
+				User: requests.User{
+					Username: testUser1,
+					Password: "jsmith1999",
+				},
+			},
+			want: map[string]interface{}{
+				"score": 1,
+			},
+		},
+		{
+			name:      "add user with weak password",
+			operation: "add",
+			req: &requests.Request{
+				User: requests.User{
+					Username: "foobar",
+					Password: "foobar2020",
+					Email:    "foobar@barfoo",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrAddUser.WithArgs("foobar", errors.ErrPasswordPolicyMinScore.WithArgs(1, 3)),
+		},
+		{
+			name:      "change user password to weak password",
+			operation: "change",
+			req: &requests.Request{
+				User: requests.User{
+					Username:    testUser1,
+					Email:       testEmail1,
+					OldPassword: testPwd1,
+					Password:    "JohnSmith",
+				},
+			},
+			shouldErr: true,
+			err:       errors.ErrChangeUserPassword.WithArgs(errors.ErrPasswordPolicyMinScore.WithArgs(1, 3)),
+		},
+		{
+			name:      "change user password to strong password",
+			operation: "change",
+			req: &requests.Request{
+				User: requests.User{
+					Username:    testUser1,
+					Email:       testEmail1,
+					OldPassword: testPwd1,
+					Password:    "X9#kq!vL2zPw",
+				},
+			},
+			want: map[string]interface{}{
+				"score": 4,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			switch tc.operation {
+			case "get":
+			case "add":
+				err = db.AddUser(tc.req)
+			case "change":
+				err = db.ChangeUserPassword(tc.req)
+			}
+			if tests.EvalErrWithLog(t, err, tc.operation, tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			if err := db.GetPasswordStrength(tc.req); err != nil {
+				t.Fatal(err)
+			}
+			ps := tc.req.Response.Payload.(*PasswordStrength)
+			got := make(map[string]interface{})
+			got["score"] = ps.Score
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
@@ -16,10 +16,13 @@ package identity
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/greenpau/go-identity/internal/tests"
 	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
 )
 
 func TestNewPassword(t *testing.T) {
@@ -118,3 +121,223 @@ func TestNewPassword(t *testing.T) {
 		})
 	}
 }
+
+func TestPasswordPepper(t *testing.T) {
+	tmpDir, err := tests.TempDir("TestPasswordPepper")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	pepperFilePath := filepath.Join(tmpDir, "pepper_v2")
+	if err := ioutil.WriteFile(pepperFilePath, []byte("c71ca4c68bc14ec5b4ab8d3c3b63802c\n"), 0600); err != nil {
+		t.Fatalf("failed to write pepper file: %v", err)
+	}
+	peppers := NewPasswordPeppers()
+
+	testcases := []struct {
+		name       string
+		pepperID   string
+		secret     string
+		secretPath string
+		input      string
+		want       map[string]interface{}
+		shouldErr  bool
+		err        error
+	}{
+		{
+			name:  "test password without pepper",
+			input: "foobar",
+			want: map[string]interface{}{
+				"pepper_id":      "",
+				"password_match": true,
+			},
+		},
+		{
+			name:     "test password with pepper v1",
+			pepperID: "v1",
+			secret:   "d71ca4c68bc14ec5b4ab8d3c3be02ddd",
+			input:    "foobar",
+			want: map[string]interface{}{
+				"pepper_id":      "v1",
+				"password_match": true,
+			},
+		},
+		{
+			name:       "test password with pepper v2 loaded from file",
+			pepperID:   "v2",
+			secretPath: pepperFilePath,
+			input:      "foobar",
+			want: map[string]interface{}{
+				"pepper_id":      "v2",
+				"password_match": true,
+			},
+		},
+		{
+			name:      "test password with short pepper",
+			pepperID:  "v3",
+			secret:    "foobar",
+			shouldErr: true,
+			err:       errors.ErrPasswordPepperTooShort.WithArgs("v3", 16),
+		},
+		{
+			name:       "test password with pepper from non-existing file",
+			pepperID:   "v3",
+			secretPath: filepath.Join(tmpDir, "foobar"),
+			shouldErr:  true,
+			err: errors.ErrPasswordPepperLoad.WithArgs("v3", filepath.Join(tmpDir, "foobar"),
+				"open "+filepath.Join(tmpDir, "foobar")+": no such file or directory",
+			),
+		},
+	}
+
+	var passwords []*Password
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			switch {
+			case tc.secretPath != "":
+				err = peppers.Load(tc.pepperID, tc.secretPath)
+			case tc.secret != "":
+				err = peppers.Add(tc.pepperID, []byte(tc.secret))
+			}
+			if tests.EvalErrWithLog(t, err, "add pepper", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			if err := peppers.SetActive(tc.pepperID); err != nil {
+				t.Fatalf("unexpected error setting active pepper: %v", err)
+			}
+			entry, err := peppers.NewPassword(tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error creating password: %v", err)
+			}
+			got := make(map[string]interface{})
+			got["pepper_id"] = entry.PepperID
+			got["password_match"] = peppers.Match(entry, tc.input)
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+			passwords = append(passwords, entry)
+		})
+	}
+
+	// The passwords hashed with previous peppers remain valid.
+	for _, p := range passwords {
+		if !peppers.Match(p, "foobar") {
+			t.Fatalf("expected password with pepper %q to match", p.PepperID)
+		}
+	}
+
+	// The peppered passwords do not match without the pepper.
+	if passwords[1].Match("foobar") {
+		t.Fatalf("expected peppered password not to match without pepper")
+	}
+
+	// The pepper loaded from a file is not trimmed.
+	if passwords[2].MatchWithPepper("foobar", []byte("c71ca4c68bc14ec5b4ab8d3c3b63802c")) {
+		t.Fatalf("expected pepper loaded from file to keep its trailing newline")
+	}
+
+	// The peppers of one collection do not affect another.
+	other := NewPasswordPeppers()
+	if other.GetActiveID() != "" {
+		t.Fatalf("expected no active pepper in another collection, got %q", other.GetActiveID())
+	}
+	if other.Match(passwords[1], "foobar") {
+		t.Fatalf("expected password with pepper of another collection not to match")
+	}
+
+	// The passwords hashed with removed peppers no longer match.
+	peppers.Remove("v1")
+	if peppers.Match(passwords[1], "foobar") {
+		t.Fatalf("expected password with removed pepper not to match")
+	}
+	if peppers.GetActiveID() != "v2" {
+		t.Fatalf("expected active pepper v2, got %q", peppers.GetActiveID())
+	}
+	if err := peppers.SetActive("v1"); err == nil {
+		t.Fatalf("expected error setting removed pepper as active")
+	}
+}
+
+func TestDatabasePasswordPepperRehash(t *testing.T) {
+	db, err := createTestDatabase("TestDatabasePasswordPepperRehash")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	for _, id := range []string{"v1", "v2"} {
+		if err := db.AddPasswordPepper(id, []byte(id+"71ca4c68bc14ec5b4ab8d3c3b638")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetActivePasswordPepper("v1"); err != nil {
+		t.Fatal(err)
+	}
+	r := requests.NewRequest()
+	r.User.Username = "mjones"
+	r.User.Password = "7e5d41af-2cda-43b7-8e9c-2b4d3bc2a1f3"
+	r.User.Email = "mjones@gmail.com"
+	if err := db.AddUser(r); err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.getUser("mjones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := user.Passwords[0]
+
+	testcases := []struct {
+		name     string
+		activeID string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "test login with active pepper",
+			activeID: "v1",
+			want: map[string]interface{}{
+				"pepper_id": "v1",
+				"revision":  user.Revision,
+			},
+		},
+		{
+			name:     "test login with previous pepper rehashes password",
+			activeID: "v2",
+			want: map[string]interface{}{
+				"pepper_id": "v2",
+				"revision":  user.Revision + 1,
+			},
+		},
+		{
+			name:     "test login after rehash",
+			activeID: "v2",
+			want: map[string]interface{}{
+				"pepper_id": "v2",
+				"revision":  user.Revision + 1,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if err := db.SetActivePasswordPepper(tc.activeID); err != nil {
+				t.Fatal(err)
+			}
+			req := requests.NewRequest()
+			req.User.Username = "mjones"
+			req.User.Password = r.User.Password
+			if err := db.AuthenticateUser(req); err != nil {
+				t.Fatalf("unexpected authentication failure: %v", err)
+			}
+			got := make(map[string]interface{})
+			got["pepper_id"] = password.PepperID
+			got["revision"] = user.Revision
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+
+	// The previous pepper is no longer needed.
+	db.RemovePasswordPepper("v1")
+	req := requests.NewRequest()
+	req.User.Username = "mjones"
+	req.User.Password = r.User.Password
+	if err := db.AuthenticateUser(req); err != nil {
+		t.Fatalf("unexpected authentication failure: %v", err)
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The key flags of PGP keys, see RFC 4880, Section 5.2.3.21.
+const (
+	pgpKeyFlagCertify        byte = 0x01
+	pgpKeyFlagSign           byte = 0x02
+	pgpKeyFlagEncryptComms   byte = 0x04
+	pgpKeyFlagEncryptStorage byte = 0x08
+	pgpKeyFlagAuthenticate   byte = 0x20
+)
+
+// PublicKeyIdentity is a user id bound to a PGP public key.
+type PublicKeyIdentity struct {
+	Name    string `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
+	Comment string `json:"comment,omitempty" xml:"comment,omitempty" yaml:"comment,omitempty"`
+	Email   string `json:"email,omitempty" xml:"email,omitempty" yaml:"email,omitempty"`
+	Primary bool   `json:"primary,omitempty" xml:"primary,omitempty" yaml:"primary,omitempty"`
+	// Verified indicates that the email address of the identity is one of
+	// the email addresses of the user holding the key.
+	Verified bool `json:"verified,omitempty" xml:"verified,omitempty" yaml:"verified,omitempty"`
+}
+
+// PublicSubkey is a subkey of a PGP public key.
+type PublicSubkey struct {
+	ID          string `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	Type        string `json:"type,omitempty" xml:"type,omitempty" yaml:"type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" xml:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	// Capabilities is any of the following: certify, sign, encrypt, auth.
+	Capabilities []string  `json:"capabilities,omitempty" xml:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	CreatedAt    time.Time `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
+	ExpiredAt    time.Time `json:"expired_at,omitempty" xml:"expired_at,omitempty" yaml:"expired_at,omitempty"`
+}
+
+// VerifiedSignature is a signature verified with a public key of a user.
+type VerifiedSignature struct {
+	Usage string `json:"usage,omitempty" xml:"usage,omitempty" yaml:"usage,omitempty"`
+	// KeyID and Fingerprint are the id and the fingerprint of the public key
+	// of the user. SignerID is the id of the key, e.g. a subkey, that made
+	// the signature.
+	KeyID       string    `json:"key_id,omitempty" xml:"key_id,omitempty" yaml:"key_id,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty" xml:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	SignerID    string    `json:"signer_id,omitempty" xml:"signer_id,omitempty" yaml:"signer_id,omitempty"`
+	SignedAt    time.Time `json:"signed_at,omitempty" xml:"signed_at,omitempty" yaml:"signed_at,omitempty"`
+	// Namespace is the namespace of an OpenSSH signature, e.g. git.
+	Namespace string `json:"namespace,omitempty" xml:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
+
+// getPGPKeyType returns the name and the type of the algorithm of a PGP key.
+func getPGPKeyType(algo packet.PublicKeyAlgorithm) (string, string, error) {
+	switch algo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoRSASignOnly:
+		return "RSA", "rsa", nil
+	case packet.PubKeyAlgoElGamal:
+		return "ELGAMAL", "elgamal", nil
+	case packet.PubKeyAlgoDSA:
+		return "DSA", "dsa", nil
+	case packet.PubKeyAlgoECDH:
+		return "ECDH", "ecdh", nil
+	case packet.PubKeyAlgoECDSA:
+		return "ECDSA", "ecdsa", nil
+	}
+	return "", "", fmt.Errorf("unsupported public key algo %v", algo)
+}
+
+// getPGPKeyExpiry returns the expiration time of a PGP key. The key lifetime
+// in a signature is relative to the creation time of the key.
+func getPGPKeyExpiry(pk *packet.PublicKey, sig *packet.Signature) time.Time {
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return time.Time{}
+	}
+	return pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second).UTC()
+}
+
+// getPGPKeyCapabilities returns the capabilities of a PGP key. When the key
+// has no key flags, the capabilities are derived from its algorithm.
+func getPGPKeyCapabilities(pk *packet.PublicKey, flags byte, found, primary bool) []string {
+	var capabilities []string
+	if !found {
+		if primary && pk.CanSign() {
+			flags |= pgpKeyFlagCertify
+		}
+		if pk.CanSign() {
+			flags |= pgpKeyFlagSign
+		}
+		switch pk.PubKeyAlgo {
+		case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoElGamal, packet.PubKeyAlgoECDH:
+			flags |= pgpKeyFlagEncryptComms
+		}
+	}
+	if flags&pgpKeyFlagCertify != 0 {
+		capabilities = append(capabilities, "certify")
+	}
+	if flags&pgpKeyFlagSign != 0 {
+		capabilities = append(capabilities, "sign")
+	}
+	if flags&(pgpKeyFlagEncryptComms|pgpKeyFlagEncryptStorage) != 0 {
+		capabilities = append(capabilities, "encrypt")
+	}
+	if flags&pgpKeyFlagAuthenticate != 0 {
+		capabilities = append(capabilities, "auth")
+	}
+	return capabilities
+}
+
+// getPGPKeyFlags returns the key flags of the primary key and the subkeys
+// of an armored PGP public key, indexed by key id. The packets are parsed
+// here, because the openpgp package does not expose the authentication flag.
+// The flags are taken only from the signatures issued by the primary key,
+// i.e. self-signatures and subkey binding signatures. The certifications
+// made by third parties cannot change the capabilities of the key.
+func getPGPKeyFlags(s string) (map[uint64]byte, error) {
+	block, err := armor.Decode(strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[uint64]byte)
+	var primaryKeyID, keyID uint64
+	for len(data) > 0 {
+		tag, hdrLen, bodyLen, err := readPGPPacketHeader(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < hdrLen+bodyLen {
+			return nil, fmt.Errorf("PGP packet is truncated")
+		}
+		switch tag {
+		case 6, 14:
+			// Public key and public subkey packets.
+			p, err := packet.Read(bytes.NewReader(data[:hdrLen+bodyLen]))
+			if err != nil {
+				return nil, err
+			}
+			pk, ok := p.(*packet.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("PGP packet with tag %d is not a public key", tag)
+			}
+			keyID = pk.KeyId
+			if tag == 6 {
+				primaryKeyID = pk.KeyId
+			}
+		case 2:
+			// Signature packets.
+			if keyID == 0 {
+				break
+			}
+			flags, found := getPGPSignatureKeyFlags(data[hdrLen : hdrLen+bodyLen])
+			if !found {
+				break
+			}
+			p, err := packet.Read(bytes.NewReader(data[:hdrLen+bodyLen]))
+			if err != nil {
+				return nil, err
+			}
+			sig, ok := p.(*packet.Signature)
+			if !ok || sig.IssuerKeyId == nil || *sig.IssuerKeyId != primaryKeyID {
+				break
+			}
+			m[keyID] = flags
+		}
+		data = data[hdrLen+bodyLen:]
+	}
+	return m, nil
+}
+
+// readPGPPacketHeader returns the tag, the header length and the body length
+// of a PGP packet, see RFC 4880, Section 4.2.
+func readPGPPacketHeader(b []byte) (byte, int, int, error) {
+	if len(b) < 2 || b[0]&0x80 == 0 {
+		return 0, 0, 0, fmt.Errorf("PGP packet header is invalid")
+	}
+	if b[0]&0x40 == 0 {
+		// Old format packet.
+		tag := (b[0] & 0x3f) >> 2
+		switch b[0] & 0x03 {
+		case 0:
+			return tag, 2, int(b[1]), nil
+		case 1:
+			if len(b) < 3 {
+				break
+			}
+			return tag, 3, int(b[1])<<8 | int(b[2]), nil
+		case 2:
+			if len(b) < 5 {
+				break
+			}
+			return tag, 5, int(binary.BigEndian.Uint32(b[1:5])), nil
+		default:
+			return tag, 1, len(b) - 1, nil
+		}
+		return 0, 0, 0, fmt.Errorf("PGP packet header is truncated")
+	}
+	tag := b[0] & 0x3f
+	switch {
+	case b[1] < 192:
+		return tag, 2, int(b[1]), nil
+	case b[1] < 224:
+		if len(b) < 3 {
+			break
+		}
+		return tag, 3, (int(b[1])-192)<<8 + int(b[2]) + 192, nil
+	case b[1] == 255:
+		if len(b) < 6 {
+			break
+		}
+		return tag, 6, int(binary.BigEndian.Uint32(b[2:6])), nil
+	default:
+		return 0, 0, 0, fmt.Errorf("PGP packet with partial body length is unsupported")
+	}
+	return 0, 0, 0, fmt.Errorf("PGP packet header is truncated")
+}
+
+// getPGPSignatureKeyFlags returns the key flags in the hashed subpackets of
+// a version 4 self-signature or subkey binding signature.
+func getPGPSignatureKeyFlags(b []byte) (byte, bool) {
+	if len(b) < 6 || b[0] != 4 {
+		return 0, false
+	}
+	switch packet.SignatureType(b[1]) {
+	case packet.SigTypeGenericCert, packet.SigTypePersonaCert, packet.SigTypeCasualCert,
+		packet.SigTypePositiveCert, packet.SigTypeSubkeyBinding, packet.SigTypeDirectSignature:
+	default:
+		return 0, false
+	}
+	n := int(b[4])<<8 | int(b[5])
+	if len(b) < 6+n {
+		return 0, false
+	}
+	subpackets := b[6 : 6+n]
+	for len(subpackets) > 0 {
+		var hdrLen, bodyLen int
+		switch {
+		case subpackets[0] < 192:
+			hdrLen, bodyLen = 1, int(subpackets[0])
+		case subpackets[0] < 255:
+			if len(subpackets) < 2 {
+				return 0, false
+			}
+			hdrLen, bodyLen = 2, (int(subpackets[0])-192)<<8+int(subpackets[1])+192
+		default:
+			if len(subpackets) < 5 {
+				return 0, false
+			}
+			hdrLen, bodyLen = 5, int(binary.BigEndian.Uint32(subpackets[1:5]))
+		}
+		if bodyLen == 0 || len(subpackets) < hdrLen+bodyLen {
+			return 0, false
+		}
+		// The subpacket type 27 is the key flags.
+		if subpackets[hdrLen]&0x7f == 27 && bodyLen > 1 {
+			return subpackets[hdrLen+1], true
+		}
+		subpackets = subpackets[hdrLen+bodyLen:]
+	}
+	return 0, false
+}
+
+// getPGPSignature returns the issuer key id and the creation time of an
+// armored detached PGP signature.
+func getPGPSignature(s string) (uint64, time.Time, error) {
+	block, err := armor.Decode(strings.NewReader(s))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if block.Type != openpgp.SignatureType {
+		return 0, time.Time{}, fmt.Errorf("unexpected armor block type %q", block.Type)
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if sig.IssuerKeyId == nil {
+			return 0, time.Time{}, fmt.Errorf("signature has no issuer")
+		}
+		return *sig.IssuerKeyId, sig.CreationTime, nil
+	case *packet.SignatureV3:
+		return sig.IssuerKeyId, sig.CreationTime, nil
+	}
+	return 0, time.Time{}, fmt.Errorf("non signature packet found")
+}
+
+// getPGPKeyRing returns the keyring of the enabled gpg keys of a user. The
+// keys and the subkeys that were revoked or expired by now, or created after
+// the signature, are excluded.
+func (user *User) getPGPKeyRing(signedAt time.Time) (openpgp.EntityList, map[uint64]*PublicKey) {
+	var kr openpgp.EntityList
+	keys := make(map[uint64]*PublicKey)
+	now := time.Now().UTC()
+	for _, k := range user.PublicKeys {
+		if k.Usage != "gpg" || k.Disabled || k.Expired {
+			continue
+		}
+		if !k.ExpiredAt.IsZero() && !now.Before(k.ExpiredAt) {
+			continue
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(k.Payload))
+		if err != nil || len(entities) != 1 {
+			continue
+		}
+		entity := entities[0]
+		if len(entity.Revocations) > 0 {
+			continue
+		}
+		if signedAt.Before(entity.PrimaryKey.CreationTime) {
+			continue
+		}
+		var subkeys []openpgp.Subkey
+		for _, subkey := range entity.Subkeys {
+			if subkey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+				continue
+			}
+			expiredAt := getPGPKeyExpiry(subkey.PublicKey, subkey.Sig)
+			if !expiredAt.IsZero() && !now.Before(expiredAt) {
+				continue
+			}
+			if signedAt.Before(subkey.PublicKey.CreationTime) {
+				continue
+			}
+			subkeys = append(subkeys, subkey)
+		}
+		entity.Subkeys = subkeys
+		kr = append(kr, entity)
+		keys[entity.PrimaryKey.KeyId] = k
+	}
+	return kr, keys
+}
+
+// VerifyPGPSignature verifies a detached armored PGP signature of the data
+// with the enabled gpg public keys of a user.
+func (user *User) VerifyPGPSignature(data []byte, signature string) (*VerifiedSignature, error) {
+	issuerKeyID, signedAt, err := getPGPSignature(signature)
+	if err != nil {
+		return nil, errors.ErrPublicKeySignatureInvalid.WithArgs(err)
+	}
+	if signedAt.After(time.Now()) {
+		return nil, errors.ErrPublicKeySignatureFuture.WithArgs(signedAt.UTC().Format(time.RFC3339))
+	}
+	kr, keys := user.getPGPKeyRing(signedAt)
+	signer, err := openpgp.CheckArmoredDetachedSignature(kr, bytes.NewReader(data), strings.NewReader(signature))
+	if err != nil {
+		if err == pgperrors.ErrUnknownIssuer {
+			return nil, errors.ErrPublicKeySignatureKeyNotFound.WithArgs(strconv.FormatUint(issuerKeyID, 16))
+		}
+		return nil, errors.ErrPublicKeySignatureInvalid.WithArgs(err)
+	}
+	k := keys[signer.PrimaryKey.KeyId]
+	return &VerifiedSignature{
+		Usage:       k.Usage,
+		KeyID:       k.ID,
+		Fingerprint: k.Fingerprint,
+		SignerID:    strconv.FormatUint(issuerKeyID, 16),
+		SignedAt:    signedAt.UTC(),
+	}, nil
+}
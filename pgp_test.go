@@ -0,0 +1,273 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+)
+
+func TestDatabaseVerifyPGPSignature(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseVerifyPGPSignature")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user := requests.User{Username: testUser1, Email: testEmail1}
+	if err := db.AddPublicKey(&requests.Request{
+		User: user,
+		Key: requests.Key{
+			Usage:   "gpg",
+			Payload: readPEMFile("testdata/gpg/jsmith_gpg_pub.pem"),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("go-identity v1.0.0 release artifact\n")
+	signature := readPEMFile("testdata/gpg/jsmith_gpg_sig.asc")
+
+	testcases := []struct {
+		name      string
+		user      requests.User
+		data      []byte
+		signature string
+		disable   bool
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "test valid signature",
+			user:      user,
+			data:      data,
+			signature: signature,
+			want: map[string]interface{}{
+				"usage":       "gpg",
+				"key_id":      "d58faec8bb7d2aa5",
+				"fingerprint": "3b2400a9072e8f8a49ba7ad8d58faec8bb7d2aa5",
+				"signer_id":   "d58faec8bb7d2aa5",
+				"signed_at":   time.Unix(1792354891, 0).UTC(),
+			},
+		},
+		{
+			name:      "test signature of tampered data",
+			user:      user,
+			data:      []byte("go-identity v1.0.1 release artifact\n"),
+			signature: signature,
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("gpg",
+				errors.ErrPublicKeySignatureInvalid.WithArgs("openpgp: invalid signature: hash tag doesn't match"),
+			),
+		},
+		{
+			name:      "test signature made by another user",
+			user:      requests.User{Username: testUser2, Email: testEmail2},
+			data:      data,
+			signature: signature,
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("gpg",
+				errors.ErrPublicKeySignatureKeyNotFound.WithArgs("d58faec8bb7d2aa5"),
+			),
+		},
+		{
+			name:      "test signature made by disabled key",
+			user:      user,
+			data:      data,
+			signature: signature,
+			disable:   true,
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("gpg",
+				errors.ErrPublicKeySignatureKeyNotFound.WithArgs("d58faec8bb7d2aa5"),
+			),
+		},
+		{
+			name:      "test malformed signature",
+			user:      user,
+			data:      data,
+			signature: readPEMFile("testdata/gpg/jsmith_gpg_pub.pem"),
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("gpg",
+				errors.ErrPublicKeySignatureInvalid.WithArgs(`unexpected armor block type "PGP PUBLIC KEY BLOCK"`),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if tc.disable {
+				if err := db.DisablePublicKey(&requests.Request{User: tc.user, Key: requests.Key{ID: "d58faec8bb7d2aa5"}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := &requests.Request{
+				User: tc.user,
+				Signature: requests.Signature{
+					Data:    tc.data,
+					Payload: tc.signature,
+				},
+			}
+			err := db.VerifyPGPSignature(r)
+			if tests.EvalErrWithLog(t, err, "verify signature", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			signature := r.Response.Payload.(*VerifiedSignature)
+			got := make(map[string]interface{})
+			got["usage"] = signature.Usage
+			got["key_id"] = signature.KeyID
+			got["fingerprint"] = signature.Fingerprint
+			got["signer_id"] = signature.SignerID
+			got["signed_at"] = signature.SignedAt
+			tests.EvalObjectsWithLog(t, "signature", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestVerifyPGPSignatureTime(t *testing.T) {
+	now := time.Now()
+	createdAt := now.Add(-2 * time.Hour)
+	entity, err := openpgp.NewEntity("John Smith", "", "jsmith@gmail.com", &packet.Config{
+		RSABits: 1024,
+		Time:    func() time.Time { return createdAt },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyID := strconv.FormatUint(entity.PrimaryKey.KeyId, 16)
+	data := []byte("go-identity v1.0.0 release artifact\n")
+
+	testcases := []struct {
+		name      string
+		signedAt  time.Time
+		expiredAt time.Time
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:     "test signature made by valid key",
+			signedAt: now.Add(-1 * time.Minute),
+		},
+		{
+			name:      "test signature made in the future",
+			signedAt:  now.Add(time.Hour),
+			shouldErr: true,
+			err:       errors.ErrPublicKeySignatureFuture.WithArgs(now.Add(time.Hour).UTC().Format(time.RFC3339)),
+		},
+		{
+			name:      "test signature made before key creation",
+			signedAt:  createdAt.Add(-1 * time.Hour),
+			shouldErr: true,
+			err:       errors.ErrPublicKeySignatureKeyNotFound.WithArgs(keyID),
+		},
+		{
+			name:      "test signature made before key expiry by expired key",
+			signedAt:  now.Add(-1 * time.Hour),
+			expiredAt: now.Add(-30 * time.Minute),
+			shouldErr: true,
+			err:       errors.ErrPublicKeySignatureKeyNotFound.WithArgs(keyID),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			user := NewUser(testUser1)
+			if err := user.AddEmailAddress(testEmail1); err != nil {
+				t.Fatal(err)
+			}
+			if err := user.AddPublicKey(&requests.Request{Key: requests.Key{Usage: "gpg", Payload: buf.String()}}); err != nil {
+				t.Fatal(err)
+			}
+			user.PublicKeys[0].ExpiredAt = tc.expiredAt
+			var sig bytes.Buffer
+			if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(data), &packet.Config{
+				Time: func() time.Time { return tc.signedAt },
+			}); err != nil {
+				t.Fatal(err)
+			}
+			signature, err := user.VerifyPGPSignature(data, sig.String())
+			if tests.EvalErrWithLog(t, err, "verify signature", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "key id", keyID, signature.KeyID, msgs)
+		})
+	}
+}
+
+func TestGetPGPKeyFlags(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	entity, err := openpgp.NewEntity("John Smith", "", "jsmith@gmail.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := openpgp.NewEntity("Bob Jones", "", "bjones@gmail.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The certification of another key claims that the primary key of the
+	// user is an encryption key.
+	for _, identity := range entity.Identities {
+		sig := &packet.Signature{
+			SigType:                   packet.SigTypeGenericCert,
+			PubKeyAlgo:                signer.PrimaryKey.PubKeyAlgo,
+			Hash:                      config.Hash(),
+			CreationTime:              time.Now(),
+			IssuerKeyId:               &signer.PrimaryKey.KeyId,
+			FlagsValid:                true,
+			FlagEncryptCommunications: true,
+		}
+		if err := sig.SignUserId(identity.UserId.Id, entity.PrimaryKey, signer.PrivateKey, config); err != nil {
+			t.Fatal(err)
+		}
+		identity.Signatures = append(identity.Signatures, sig)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	flags, err := getPGPKeyFlags(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []string{"test name: test key flags of third party certification"}
+	want := map[uint64]byte{
+		entity.PrimaryKey.KeyId:           pgpKeyFlagCertify | pgpKeyFlagSign,
+		entity.Subkeys[0].PublicKey.KeyId: pgpKeyFlagEncryptComms | pgpKeyFlagEncryptStorage,
+	}
+	tests.EvalObjectsWithLog(t, "flags", want, flags, msgs)
+}
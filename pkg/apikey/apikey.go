@@ -0,0 +1,141 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apikey implements the self-identifying format of API keys.
+//
+// The API key consists of a product prefix, an underscore, a key ID, a
+// secret, and a CRC32 checksum, e.g. gik_<id><secret><checksum>. The
+// checksum allows secret scanners to recognize the keys in text and
+// validate them offline, without access to the database.
+package apikey
+
+import (
+	"hash/crc32"
+	"regexp"
+	"strings"
+
+	"github.com/greenpau/go-identity/pkg/errors"
+)
+
+const (
+	// IDLength is the length of the key ID embedded in API keys.
+	IDLength = 20
+	// SecretLength is the length of the secret part of API keys.
+	SecretLength = 40
+	// ChecksumLength is the length of base62-encoded CRC32 checksum.
+	ChecksumLength = 6
+	// DefaultPrefix is the default product prefix of API keys.
+	DefaultPrefix = "gik"
+	base62        = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var (
+	prefixRegex = regexp.MustCompile(`^[a-z][a-z0-9]{1,9}$`)
+	bodyRegex   = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	scanRegex   = regexp.MustCompile(`\b[a-z][a-z0-9]{1,9}_[0-9A-Za-z]{66}\b`)
+)
+
+// Key is a self-identifying API key.
+type Key struct {
+	Prefix   string `json:"prefix,omitempty" xml:"prefix,omitempty" yaml:"prefix,omitempty"`
+	ID       string `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	Secret   string `json:"-"`
+	Checksum string `json:"checksum,omitempty" xml:"checksum,omitempty" yaml:"checksum,omitempty"`
+	// Offset is the position of the key in the scanned text.
+	Offset int `json:"offset,omitempty" xml:"offset,omitempty" yaml:"offset,omitempty"`
+}
+
+// NewKey returns an instance of Key with the computed checksum.
+func NewKey(prefix, id, secret string) (*Key, error) {
+	if !prefixRegex.MatchString(prefix) {
+		return nil, errors.ErrAPIKeyFormatPrefixInvalid.WithArgs(prefix)
+	}
+	if len(id) != IDLength || !bodyRegex.MatchString(id) {
+		return nil, errors.ErrAPIKeyFormatIDInvalid
+	}
+	if len(secret) != SecretLength || !bodyRegex.MatchString(secret) {
+		return nil, errors.ErrAPIKeyFormatSecretInvalid
+	}
+	k := &Key{
+		Prefix: prefix,
+		ID:     id,
+		Secret: secret,
+	}
+	k.Checksum = Checksum(k.Prefix + "_" + k.ID + k.Secret)
+	return k, nil
+}
+
+// Parse parses the provided string and returns an instance of Key. It
+// returns an error when the string is malformed or the checksum does not
+// match.
+func Parse(s string) (*Key, error) {
+	i := strings.Index(s, "_")
+	if i < 0 {
+		return nil, errors.ErrAPIKeyFormatMalformed
+	}
+	prefix, body := s[:i], s[i+1:]
+	if !prefixRegex.MatchString(prefix) {
+		return nil, errors.ErrAPIKeyFormatPrefixInvalid.WithArgs(prefix)
+	}
+	if len(body) != IDLength+SecretLength+ChecksumLength || !bodyRegex.MatchString(body) {
+		return nil, errors.ErrAPIKeyFormatMalformed
+	}
+	k := &Key{
+		Prefix:   prefix,
+		ID:       body[:IDLength],
+		Secret:   body[IDLength : IDLength+SecretLength],
+		Checksum: body[IDLength+SecretLength:],
+	}
+	if Checksum(s[:len(s)-ChecksumLength]) != k.Checksum {
+		return nil, errors.ErrAPIKeyFormatChecksumMismatch
+	}
+	return k, nil
+}
+
+// Scan returns the API keys found in the provided text. Only the candidates
+// with valid checksums are returned.
+func Scan(s string) []*Key {
+	var keys []*Key
+	for _, loc := range scanRegex.FindAllStringIndex(s, -1) {
+		k, err := Parse(s[loc[0]:loc[1]])
+		if err != nil {
+			continue
+		}
+		k.Offset = loc[0]
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Checksum returns base62-encoded CRC32 checksum of the provided string.
+func Checksum(s string) string {
+	n := crc32.ChecksumIEEE([]byte(s))
+	b := make([]byte, ChecksumLength)
+	for i := ChecksumLength - 1; i >= 0; i-- {
+		b[i] = base62[n%62]
+		n /= 62
+	}
+	return string(b)
+}
+
+// String returns string representation of Key instance.
+func (k *Key) String() string {
+	return k.Prefix + "_" + k.ID + k.Secret + k.Checksum
+}
+
+// Identifier returns the product prefix and the ID of Key instance. The
+// identifier is unique and does not contain the secret.
+func (k *Key) Identifier() string {
+	return k.Prefix + "_" + k.ID
+}
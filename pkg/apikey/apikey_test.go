@@ -0,0 +1,194 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+)
+
+var (
+	testID     = "Ab3dE5gH7jK9mN1pQ3sT"
+	testSecret = "0123456789abcdefghijABCDEFGHIJ0123456789"
+)
+
+func TestParse(t *testing.T) {
+	k, err := NewKey("gik", testID, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := k.String()
+	testcases := []struct {
+		name      string
+		input     string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:  "valid api key",
+			input: key,
+			want: map[string]interface{}{
+				"prefix":     "gik",
+				"id":         testID,
+				"secret":     testSecret,
+				"identifier": "gik_" + testID,
+				"string":     key,
+			},
+		},
+		{
+			name:      "api key with corrupted checksum",
+			input:     key[:len(key)-1] + string(key[len(key)-1]^1),
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatChecksumMismatch,
+		},
+		{
+			name:      "api key with corrupted secret",
+			input:     strings.Replace(key, "abcdef", "abcdeg", 1),
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatChecksumMismatch,
+		},
+		{
+			name:      "api key with different prefix",
+			input:     "foo" + key[3:],
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatChecksumMismatch,
+		},
+		{
+			name:      "api key without prefix",
+			input:     key[4:],
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatMalformed,
+		},
+		{
+			name:      "api key with invalid prefix",
+			input:     "GIK" + key[3:],
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatPrefixInvalid.WithArgs("GIK"),
+		},
+		{
+			name:      "truncated api key",
+			input:     key[:len(key)-2],
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatMalformed,
+		},
+		{
+			name:      "api key with invalid characters",
+			input:     strings.Replace(key, "abcdef", "abc-ef", 1),
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatMalformed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			k, err := Parse(tc.input)
+			if tests.EvalErrWithLog(t, err, "parse", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["prefix"] = k.Prefix
+			got["id"] = k.ID
+			got["secret"] = k.Secret
+			got["identifier"] = k.Identifier()
+			got["string"] = k.String()
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	testcases := []struct {
+		name      string
+		prefix    string
+		id        string
+		secret    string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "valid key",
+			prefix: "acme",
+			id:     testID,
+			secret: testSecret,
+		},
+		{
+			name:      "key with long prefix",
+			prefix:    "abcdefghijk",
+			id:        testID,
+			secret:    testSecret,
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatPrefixInvalid.WithArgs("abcdefghijk"),
+		},
+		{
+			name:      "key with short id",
+			prefix:    "gik",
+			id:        testID[1:],
+			secret:    testSecret,
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatIDInvalid,
+		},
+		{
+			name:      "key with invalid secret",
+			prefix:    "gik",
+			id:        testID,
+			secret:    testSecret[1:] + "_",
+			shouldErr: true,
+			err:       errors.ErrAPIKeyFormatSecretInvalid,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			k, err := NewKey(tc.prefix, tc.id, tc.secret)
+			if tests.EvalErrWithLog(t, err, "new key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			if _, err := Parse(k.String()); err != nil {
+				t.Fatalf("failed parsing generated key: %v", err)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	k1, err := NewKey("gik", testID, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := NewKey("acme", strings.ToLower(testID), strings.ToUpper(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := k1.Prefix + "_" + k1.ID + k1.Secret + "AAAAAA"
+	if corrupted == k1.String() {
+		t.Fatal("failed corrupting checksum")
+	}
+	text := fmt.Sprintf("export API_KEY=%s\ncurl -H 'Authorization: Bearer %s'\nstale=%s\n", k1, k2, corrupted)
+	msgs := []string{"test name: scan text"}
+	var got []string
+	for _, k := range Scan(text) {
+		got = append(got, fmt.Sprintf("%s@%d", k.Identifier(), k.Offset))
+	}
+	want := []string{
+		fmt.Sprintf("%s@%d", k1.Identifier(), strings.Index(text, k1.String())),
+		fmt.Sprintf("%s@%d", k2.Identifier(), strings.Index(text, k2.String())),
+	}
+	tests.EvalObjectsWithLog(t, "eval", want, got, msgs)
+}
@@ -16,12 +16,36 @@ package errors
 
 // API key errors.
 const (
-	ErrAPIKeyPayloadEmpty     StandardError = "api key payload is empty"
-	ErrAPIKeyUsageEmpty       StandardError = "api key usage type is empty"
-	ErrAPIKeyCommentEmpty     StandardError = "api key comment is empty"
-	ErrAPIKeyUsageUnsupported StandardError = "api key usage type %q is unsupported"
+	ErrAPIKeyPayloadEmpty         StandardError = "api key payload is empty"
+	ErrAPIKeyUsageEmpty           StandardError = "api key usage type is empty"
+	ErrAPIKeyCommentEmpty         StandardError = "api key comment is empty"
+	ErrAPIKeyUsageUnsupported     StandardError = "api key usage type %q is unsupported"
+	ErrAPIKeyScopeEmpty           StandardError = "api key scope is empty"
+	ErrAPIKeyRoleEmpty            StandardError = "api key role is empty"
+	ErrAPIKeyRoleNotAssigned      StandardError = "api key role %q is not assigned to the key owner"
+	ErrAPIKeyTTLInvalid           StandardError = "api key ttl %d is invalid"
+	ErrAPIKeyAlgorithmUnsupported StandardError = "api key algorithm %q is unsupported"
+	ErrAPIKeyNetworkInvalid       StandardError = "api key network %q is invalid"
+	ErrAPIKeyMethodInvalid        StandardError = "api key method %q is invalid"
+
+	ErrAPIKeyPolicyMaxLifetime StandardError = "api key ttl %d exceeds the maximum lifetime of %d seconds"
 
 	ErrLookupAPIKeyPayloadEmpty     StandardError = "api key payload is empty"
 	ErrLookupAPIKeyFailed           StandardError = "api key lookup failed"
 	ErrLookupAPIKeyMalformedPayload StandardError = "api key payload is malformed"
+	ErrLookupAPIKeyDisabled         StandardError = "api key is disabled"
+	ErrLookupAPIKeyExpired          StandardError = "api key expired"
+	ErrLookupAPIKeyNetworkDenied    StandardError = "api key is not allowed from %q"
+	ErrLookupAPIKeyMethodDenied     StandardError = "api key is not allowed with %q method"
+	ErrLookupAPIKeyMigrate          StandardError = "api key migration failed: %v"
+
+	ErrAPIKeySecretNotFound StandardError = "api key secret is not loaded"
+	ErrAPIKeySecretTooShort StandardError = "api key secret is shorter than %d bytes"
+	ErrAPIKeySecretLoad     StandardError = "failed loading api key secret from %q: %v"
+
+	ErrAPIKeyFormatPrefixInvalid    StandardError = "api key prefix %q is invalid"
+	ErrAPIKeyFormatIDInvalid        StandardError = "api key id is invalid"
+	ErrAPIKeyFormatSecretInvalid    StandardError = "api key secret is invalid"
+	ErrAPIKeyFormatMalformed        StandardError = "api key is malformed"
+	ErrAPIKeyFormatChecksumMismatch StandardError = "api key checksum mismatch"
 )
@@ -30,30 +30,69 @@ const (
 	// ErrDatabaseInvalidUserPassword StandardError = "invalid password"
 	ErrAuthFailed StandardError = "user authentication failed: %v"
 
-	ErrAddPublicKey    StandardError = "failed adding %s public key: %v"
-	ErrDeletePublicKey StandardError = "failed deleting %q key: %v"
-	ErrGetPublicKeys   StandardError = "failed getting %q keys: %v"
+	ErrAddPublicKey      StandardError = "failed adding %s public key: %v"
+	ErrDeletePublicKey   StandardError = "failed deleting %q key: %v"
+	ErrGetPublicKeys     StandardError = "failed getting %q keys: %v"
+	ErrDisablePublicKey  StandardError = "failed disabling %q key: %v"
+	ErrEnablePublicKey   StandardError = "failed enabling %q key: %v"
+	ErrUpdatePublicKey   StandardError = "failed updating %q key: %v"
+	ErrGetAuthorizedKeys StandardError = "failed getting authorized keys of %q: %v"
+	ErrVerifySignature   StandardError = "failed verifying %s signature: %v"
+	ErrGetAllowedSigners StandardError = "failed getting allowed signers: %v"
+	ErrLookupPublicKey   StandardError = "failed looking up public key: %v"
 
-	ErrAddAPIKey    StandardError = "failed adding %s key: %v"
-	ErrDeleteAPIKey StandardError = "failed deleting %q key: %v"
-	ErrGetAPIKeys   StandardError = "failed getting %q keys: %v"
+	ErrLookupPublicKeyEmptyPayload StandardError = "public key payload and fingerprint are empty"
+
+	ErrAddAPIKey     StandardError = "failed adding %s key: %v"
+	ErrDeleteAPIKey  StandardError = "failed deleting %q key: %v"
+	ErrRotateAPIKey  StandardError = "failed rotating %q key: %v"
+	ErrGetAPIKeys    StandardError = "failed getting %q keys: %v"
+	ErrDisableAPIKey StandardError = "failed disabling %q key: %v"
+	ErrEnableAPIKey  StandardError = "failed enabling %q key: %v"
+	ErrUpdateAPIKey  StandardError = "failed updating %q key: %v"
+
+	ErrCredentialExpired StandardError = "expired credential cannot be re-enabled"
 
 	ErrChangeUserPassword   StandardError = "failed change user password: %v"
+	ErrChangeUsername       StandardError = "failed change username: %v"
 	ErrUserPasswordNotFound StandardError = "user password not set"
 	ErrUserPasswordInvalid  StandardError = "user password is invalid"
 
-	ErrUserPolicyCompliance     StandardError = "username policy compliance check failed"
-	ErrPasswordPolicyCompliance StandardError = "user password policy compliance check failed"
+	ErrUserPolicyCompliance      StandardError = "username policy compliance check failed"
+	ErrUserPolicyUppercase       StandardError = "username policy compliance check failed: uppercase characters are not allowed"
+	ErrUserPolicyNonAlphaNumeric StandardError = "username policy compliance check failed: non alpha-numeric characters are not allowed"
+	ErrUserPolicyStartChar       StandardError = "username policy compliance check failed: username must start with a letter"
+	ErrUserPolicyInvalidChar     StandardError = "username policy compliance check failed: character %q is not allowed"
+	ErrUserPolicyReserved        StandardError = "username policy compliance check failed: username %q is reserved"
+	ErrUserPolicyConfusable      StandardError = "username policy compliance check failed: username %q is confusable with %q"
+	ErrPasswordPolicyCompliance  StandardError = "user password policy compliance check failed"
+	ErrPasswordPolicyMinScore    StandardError = "user password strength score %d is below the required minimum of %d"
+
+	ErrPublicKeyPolicyType      StandardError = "public key policy compliance check failed: key type %q is not allowed"
+	ErrPublicKeyPolicyAlgorithm StandardError = "public key policy compliance check failed: key algorithm %q is not allowed"
+	ErrPublicKeyPolicyRSABits   StandardError = "public key policy compliance check failed: rsa key size %d is below the required minimum of %d bits"
+	ErrPublicKeyPolicyMaxAge    StandardError = "public key policy compliance check failed: key created at %v exceeds the maximum age of %d seconds"
+
+	ErrMfaTokenPolicyTOTPSkew StandardError = "mfa token policy compliance check failed: totp skew of %d time steps is outside of the 0-%d range"
 
 	ErrAddUser    StandardError = "failed adding user %q: %v"
 	ErrDeleteUser StandardError = "failed deleting user %q: %v"
 	ErrGetUsers   StandardError = "failed retrieving users: %v"
 	ErrGetUser    StandardError = "failed retrieving user %q: %v"
 
-	ErrPasswordEmpty                StandardError = "empty password"
-	ErrPasswordEmptyAlgorithm       StandardError = "empty password hash algorithm"
-	ErrPasswordGenerate             StandardError = "password generation error: %v"
-	ErrPasswordUnsupportedAlgorithm StandardError = "unsupported password hash algorithm: %v"
+	ErrPasswordEmpty                 StandardError = "empty password"
+	ErrPasswordEmptyAlgorithm        StandardError = "empty password hash algorithm"
+	ErrPasswordGenerate              StandardError = "password generation error: %v"
+	ErrPasswordUnsupportedAlgorithm  StandardError = "unsupported password hash algorithm: %v"
+	ErrPasswordGenerator             StandardError = "failed generating password: %v"
+	ErrPasswordGeneratorLength       StandardError = "password length %d is too short"
+	ErrPasswordGeneratorLengthPolicy StandardError = "password length %d is outside of the %d-%d character range required by password policy"
+	ErrPasswordGeneratorWords        StandardError = "passphrase word count %d is invalid"
+	ErrPasswordPepperEmptyID         StandardError = "password pepper id is empty"
+	ErrPasswordPepperTooShort        StandardError = "password pepper %q is shorter than %d bytes"
+	ErrPasswordPepperNotFound        StandardError = "password pepper %q not found"
+	ErrPasswordPepperLoad            StandardError = "failed loading password pepper %q from %q: %v"
+	ErrRehashPassword                StandardError = "failed rehashing user password: %v"
 
 	ErrUserIDInvalidLength StandardError = "invalid user id length: %d"
 	ErrUsernameEmpty       StandardError = "username is empty"
@@ -16,9 +16,14 @@ package errors
 
 // MFA token errors.
 const (
-	ErrAddMfaToken    StandardError = "failed adding MFA token: %v"
-	ErrDeleteMfaToken StandardError = "failed deleting MFA token %q: %v"
-	ErrGetMfaTokens   StandardError = "failed getting MFA tokens: %v"
+	ErrAddMfaToken     StandardError = "failed adding MFA token: %v"
+	ErrDeleteMfaToken  StandardError = "failed deleting MFA token %q: %v"
+	ErrGetMfaTokens    StandardError = "failed getting MFA tokens: %v"
+	ErrDisableMfaToken StandardError = "failed disabling MFA token %q: %v"
+	ErrEnableMfaToken  StandardError = "failed enabling MFA token %q: %v"
+	ErrUpdateMfaToken  StandardError = "failed updating MFA token %q: %v"
+	ErrVerifyMfaToken  StandardError = "failed verifying MFA token passcode: %v"
+	ErrResyncMfaToken  StandardError = "failed resynchronizing MFA token %q: %v"
 
 	ErrDuplicateMfaTokenSecret  StandardError = "duplicate MFA token secret"
 	ErrDuplicateMfaTokenComment StandardError = "duplicate MFA token comment"
@@ -23,4 +23,15 @@ const (
 	ErrPublicKeyParse                StandardError = "public key parse failed: %v"
 	ErrPublicKeyUsageUnsupported     StandardError = "public key usage %q is unsupported"
 	ErrPublicKeyTypeUnsupported      StandardError = "public key type %q is unsupported"
+	ErrPublicKeyOptionUnsupported    StandardError = "public key option %q is unsupported"
+	ErrPublicKeyOptionInvalid        StandardError = "public key option %q is invalid"
+	ErrPublicKeyRevoked              StandardError = "public key %q is revoked"
+	ErrPublicKeyExpired              StandardError = "public key %q expired at %v"
+	ErrPublicKeyEmailMismatch        StandardError = "public key %q has no identity with the email address of the user"
+	ErrPublicKeyRegistered           StandardError = "public key %q is registered by another user"
+	ErrPublicKeySignatureInvalid     StandardError = "public key signature is invalid: %v"
+	ErrPublicKeySignatureKeyNotFound StandardError = "public key %q for signature not found"
+	ErrPublicKeySignatureNamespace   StandardError = "public key signature namespace %q does not match %q"
+	ErrPublicKeySignatureFuture      StandardError = "public key signature was made in the future at %s"
+	ErrPublicKeyNamespaceInvalid     StandardError = "public key signature namespace %q is invalid"
 )
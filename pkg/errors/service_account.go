@@ -0,0 +1,30 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// Service account errors.
+const (
+	ErrAddServiceAccount StandardError = "failed adding service account %q: %v"
+
+	ErrServiceAccountOwnerNotFound    StandardError = "service account owner not found"
+	ErrServiceAccountOwnerInvalid     StandardError = "service account owner %q is not a human user"
+	ErrServiceAccountOwnerAmbiguous   StandardError = "service account must be owned by either a user or a group"
+	ErrServiceAccountOwnerTypeInvalid StandardError = "invalid service account owner type: %s"
+	ErrServiceAccountRoleNotAssigned  StandardError = "role %q is not assigned to service account owner %q"
+	ErrServiceAccountPassword         StandardError = "service account cannot have passwords"
+	ErrServiceAccountEmailAddress     StandardError = "service account cannot have email addresses"
+	ErrServiceAccountMfaToken         StandardError = "service account cannot have MFA tokens"
+	ErrServiceAccountInteractiveLogin StandardError = "service account %q cannot log in interactively"
+)
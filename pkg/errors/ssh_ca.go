@@ -0,0 +1,29 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// SSH certificate authority errors.
+const (
+	ErrSSHCertificateAuthorityLoad          StandardError = "failed loading ssh certificate authority key from %q: %v"
+	ErrSSHCertificateAuthorityNotConfigured StandardError = "ssh certificate authority is not configured"
+
+	ErrIssueSSHCertificate                     StandardError = "failed issuing ssh certificate for %q key: %v"
+	ErrSSHCertificateValidity                  StandardError = "ssh certificate validity of %d seconds is invalid"
+	ErrSSHCertificateValidityExceeded          StandardError = "ssh certificate validity of %d seconds exceeds the maximum of %d seconds"
+	ErrSSHCertificateKeyNotAuthorized          StandardError = "public key is not an enabled and unexpired ssh key"
+	ErrSSHCertificateNoPrincipals              StandardError = "ssh certificate has no principals"
+	ErrSSHCertificateCriticalOptionUnsupported StandardError = "ssh certificate critical option %q is not supported"
+	ErrSSHCertificateCriticalOptionValue       StandardError = "ssh certificate critical option %q has invalid value %q"
+)
@@ -0,0 +1,24 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// SSH challenge-response authentication errors.
+const (
+	ErrIssueSSHChallenge           StandardError = "failed issuing ssh challenge: %v"
+	ErrSSHChallengeNotFound        StandardError = "ssh challenge not found"
+	ErrSSHChallengeExpired         StandardError = "ssh challenge expired"
+	ErrSSHChallengeLimit           StandardError = "too many outstanding ssh challenges"
+	ErrSSHChallengeResponseInvalid StandardError = "ssh challenge response is invalid: %v"
+)
@@ -0,0 +1,26 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// X.509 certificate errors.
+const (
+	ErrX509CertificateAuthorityLoad StandardError = "failed loading x509 certificate authorities from %q: %v"
+	ErrX509CertificateNotYetValid   StandardError = "x509 certificate is not valid before %v"
+	ErrX509CertificateExpired       StandardError = "x509 certificate expired at %v"
+	ErrX509CertificateChain         StandardError = "x509 certificate chain verification failed: %v"
+
+	ErrLookupX509Certificate             StandardError = "failed looking up x509 certificate: %v"
+	ErrLookupX509CertificateEmptyPayload StandardError = "x509 certificate and fingerprint are empty"
+)
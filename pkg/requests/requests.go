@@ -16,6 +16,7 @@ package requests
 
 import (
 	"go.uber.org/zap"
+	"net"
 	"net/http"
 )
 
@@ -32,6 +33,10 @@ type Request struct {
 	Flags    Flags       `json:"flags,omitempty" xml:"flags,omitempty" yaml:"flags,omitempty"`
 	Response Response    `json:"response,omitempty" xml:"response,omitempty" yaml:"response,omitempty"`
 	Logger   *zap.Logger `json:"-"`
+
+	// Certificate holds the parameters of a certificate being issued.
+	Certificate Certificate `json:"certificate,omitempty" xml:"certificate,omitempty" yaml:"certificate,omitempty"`
+	Signature   Signature   `json:"signature,omitempty" xml:"signature,omitempty" yaml:"signature,omitempty"`
 }
 
 // Response hold the response associated with identity database
@@ -59,6 +64,40 @@ type Upstream struct {
 	Realm       string        `json:"realm,omitempty" xml:"realm,omitempty" yaml:"realm,omitempty"`
 	ContentType string        `json:"content_type,omitempty" xml:"content_type,omitempty" yaml:"content_type,omitempty"`
 	CookieNames []string      `json:"cookie_names,omitempty" xml:"cookie_names,omitempty" yaml:"cookie_names,omitempty"`
+	// Address is the IP address of the client. When empty, the address is
+	// derived from the upstream request.
+	Address string `json:"address,omitempty" xml:"address,omitempty" yaml:"address,omitempty"`
+	// UserAgent is the user agent of the client. When empty, the user agent
+	// is derived from the upstream request.
+	UserAgent string `json:"user_agent,omitempty" xml:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+}
+
+// GetAddress returns the IP address of the client.
+func (u *Upstream) GetAddress() string {
+	if u.Address != "" || u.Request == nil {
+		return u.Address
+	}
+	host, _, err := net.SplitHostPort(u.Request.RemoteAddr)
+	if err != nil {
+		return u.Request.RemoteAddr
+	}
+	return host
+}
+
+// GetMethod returns the HTTP method of the client request.
+func (u *Upstream) GetMethod() string {
+	if u.Method != "" || u.Request == nil {
+		return u.Method
+	}
+	return u.Request.Method
+}
+
+// GetUserAgent returns the user agent of the client.
+func (u *Upstream) GetUserAgent() string {
+	if u.UserAgent != "" || u.Request == nil {
+		return u.UserAgent
+	}
+	return u.Request.UserAgent()
 }
 
 // Sandbox hold the data relevant to the user sandbox.
@@ -77,6 +116,7 @@ type Query struct {
 // User hold user attributes.
 type User struct {
 	Username    string   `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
+	OldUsername string   `json:"old_username,omitempty" xml:"old_username,omitempty" yaml:"old_username,omitempty"`
 	Email       string   `json:"email,omitempty" xml:"email,omitempty" yaml:"email,omitempty"`
 	Password    string   `json:"password,omitempty" xml:"password,omitempty" yaml:"password,omitempty"`
 	OldPassword string   `json:"old_password,omitempty" xml:"old_password,omitempty" yaml:"old_password,omitempty"`
@@ -84,6 +124,10 @@ type User struct {
 	Roles       []string `json:"roles,omitempty" xml:"roles,omitempty" yaml:"roles,omitempty"`
 	Disabled    bool     `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 	Challenges  []string `json:"challenges,omitempty" xml:"challenges,omitempty" yaml:"challenges,omitempty"`
+	// Owner is the username or email address of the user owning a service
+	// account. OwnerGroup is the name of the group owning a service account.
+	Owner      string `json:"owner,omitempty" xml:"owner,omitempty" yaml:"owner,omitempty"`
+	OwnerGroup string `json:"owner_group,omitempty" xml:"owner_group,omitempty" yaml:"owner_group,omitempty"`
 }
 
 // Key holds crypto key attributes.
@@ -94,6 +138,28 @@ type Key struct {
 	Usage    string `json:"usage,omitempty" xml:"usage,omitempty" yaml:"usage,omitempty"`
 	Payload  string `json:"payload,omitempty" xml:"payload,omitempty" yaml:"payload,omitempty"`
 	Disabled bool   `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Scopes is the list of permissions granted to an API key.
+	Scopes []string `json:"scopes,omitempty" xml:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// Roles is the list of roles granted to an API key.
+	Roles []string `json:"roles,omitempty" xml:"roles,omitempty" yaml:"roles,omitempty"`
+	// Algorithm is the algorithm of an API key digest.
+	Algorithm string `json:"algorithm,omitempty" xml:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	// AllowedNetworks is the list of CIDR ranges an API key is allowed to
+	// be used from.
+	AllowedNetworks []string `json:"allowed_networks,omitempty" xml:"allowed_networks,omitempty" yaml:"allowed_networks,omitempty"`
+	// AllowedMethods is the list of HTTP methods an API key is allowed to
+	// be used with.
+	AllowedMethods []string `json:"allowed_methods,omitempty" xml:"allowed_methods,omitempty" yaml:"allowed_methods,omitempty"`
+	// TTL is the lifetime of an API key, in seconds.
+	TTL int `json:"ttl,omitempty" xml:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// GracePeriod is the period of time, in seconds, a rotated API key
+	// remains valid.
+	GracePeriod int `json:"grace_period,omitempty" xml:"grace_period,omitempty" yaml:"grace_period,omitempty"`
+	// Options are the options of the authorized_keys entry of an SSH key.
+	Options []string `json:"options,omitempty" xml:"options,omitempty" yaml:"options,omitempty"`
+	// Fingerprint is the fingerprint of a public key, e.g. the SHA-256 digest
+	// of the subject public key info of X.509 certificate.
+	Fingerprint string `json:"fingerprint,omitempty" xml:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
 }
 
 // MfaToken holds MFA token attributes.
@@ -107,6 +173,11 @@ type MfaToken struct {
 	Digits    int    `json:"digits,omitempty" xml:"digits,omitempty" yaml:"digits,omitempty"`
 	Passcode  string `json:"passcode,omitempty" xml:"passcode,omitempty" yaml:"passcode,omitempty"`
 	Disabled  bool   `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Counter is the initial moving counter of HOTP token.
+	Counter uint64 `json:"counter,omitempty" xml:"counter,omitempty" yaml:"counter,omitempty"`
+	// NextPasscode is the passcode following Passcode, used to resynchronize
+	// the counter of HOTP token.
+	NextPasscode string `json:"next_passcode,omitempty" xml:"next_passcode,omitempty" yaml:"next_passcode,omitempty"`
 }
 
 // WebAuthn holds WebAuthn messages.
@@ -116,6 +187,25 @@ type WebAuthn struct {
 	Request   string `json:"request,omitempty" xml:"request,omitempty" yaml:"request,omitempty"`
 }
 
+// Certificate holds the parameters of a certificate being issued.
+type Certificate struct {
+	// Validity is the validity period of a certificate, in seconds.
+	Validity int `json:"validity,omitempty" xml:"validity,omitempty" yaml:"validity,omitempty"`
+	// CriticalOptions and Extensions are the options and extensions of an
+	// OpenSSH certificate, e.g. force-command or permit-pty.
+	CriticalOptions map[string]string `json:"critical_options,omitempty" xml:"critical_options,omitempty" yaml:"critical_options,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty" xml:"extensions,omitempty" yaml:"extensions,omitempty"`
+}
+
+// Signature holds a signature being verified and the signed data, e.g. the
+// nonce of SSH challenge-response authentication.
+type Signature struct {
+	Data    []byte `json:"data,omitempty" xml:"data,omitempty" yaml:"data,omitempty"`
+	Payload string `json:"payload,omitempty" xml:"payload,omitempty" yaml:"payload,omitempty"`
+	// Namespace is the namespace of an OpenSSH signature, e.g. git or file.
+	Namespace string `json:"namespace,omitempty" xml:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
+
 // Flags holds various flags.
 type Flags struct {
 	Enabled       bool `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
@@ -123,6 +213,12 @@ type Flags struct {
 	MfaConfigured bool `json:"mfa_configured,omitempty" xml:"mfa_configured,omitempty" yaml:"mfa_configured,omitempty"`
 	MfaApp        bool `json:"mfa_app,omitempty" xml:"mfa_app,omitempty" yaml:"mfa_app,omitempty"`
 	MfaUniversal  bool `json:"mfa_universal,omitempty" xml:"mfa_universal,omitempty" yaml:"mfa_universal,omitempty"`
+	// MustChangePassword indicates that the user must change the password
+	// upon the first login.
+	MustChangePassword bool `json:"must_change_password,omitempty" xml:"must_change_password,omitempty" yaml:"must_change_password,omitempty"`
+	// IncludeDisabled indicates that the listings of credentials should
+	// include disabled credentials.
+	IncludeDisabled bool `json:"include_disabled,omitempty" xml:"include_disabled,omitempty" yaml:"include_disabled,omitempty"`
 }
 
 // NewRequest returns an instance of Request.
@@ -16,6 +16,8 @@ package identity
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -25,15 +27,31 @@ import (
 	"github.com/greenpau/go-identity/pkg/errors"
 	"github.com/greenpau/go-identity/pkg/requests"
 	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
 	"golang.org/x/crypto/ssh"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 var supportedPublicKeyTypes = map[string]bool{
-	"ssh": true,
-	"gpg": true,
+	"ssh":  true,
+	"gpg":  true,
+	"x509": true,
+}
+
+// supportedOpenSSHKeyTypes are the types of OpenSSH public keys, including
+// the keys backed by FIDO security keys, i.e. sk-*.
+var supportedOpenSSHKeyTypes = map[string]bool{
+	ssh.KeyAlgoRSA:        true,
+	ssh.KeyAlgoDSA:        true,
+	ssh.KeyAlgoECDSA256:   true,
+	ssh.KeyAlgoECDSA384:   true,
+	ssh.KeyAlgoECDSA521:   true,
+	ssh.KeyAlgoED25519:    true,
+	ssh.KeyAlgoSKECDSA256: true,
+	ssh.KeyAlgoSKED25519:  true,
 }
 
 // PublicKeyBundle is a collection of public keys.
@@ -58,6 +76,37 @@ type PublicKey struct {
 	CreatedAt      time.Time `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
 	Disabled       bool      `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 	DisabledAt     time.Time `json:"disabled_at,omitempty" xml:"disabled_at,omitempty" yaml:"disabled_at,omitempty"`
+	ModifiedAt     time.Time `json:"modified_at,omitempty" xml:"modified_at,omitempty" yaml:"modified_at,omitempty"`
+	// Options are the options of the authorized_keys entry of the key, e.g.
+	// from="10.0.0.0/8", command="/usr/bin/backup", or no-port-forwarding.
+	Options []string `json:"options,omitempty" xml:"options,omitempty" yaml:"options,omitempty"`
+	// Capabilities, Identities, and Subkeys are the capabilities, e.g. sign,
+	// the user ids, and the subkeys of a PGP key.
+	Capabilities []string             `json:"capabilities,omitempty" xml:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	Identities   []*PublicKeyIdentity `json:"identities,omitempty" xml:"identities,omitempty" yaml:"identities,omitempty"`
+	Subkeys      []*PublicSubkey      `json:"subkeys,omitempty" xml:"subkeys,omitempty" yaml:"subkeys,omitempty"`
+	// Subject, Issuer, SerialNumber, EmailAddresses, and NotBefore are the
+	// attributes of X.509 certificate. The fingerprint of the certificate is
+	// the SHA-256 digest of its subject public key info.
+	Subject        string    `json:"subject,omitempty" xml:"subject,omitempty" yaml:"subject,omitempty"`
+	Issuer         string    `json:"issuer,omitempty" xml:"issuer,omitempty" yaml:"issuer,omitempty"`
+	SerialNumber   string    `json:"serial_number,omitempty" xml:"serial_number,omitempty" yaml:"serial_number,omitempty"`
+	EmailAddresses []string  `json:"email_addresses,omitempty" xml:"email_addresses,omitempty" yaml:"email_addresses,omitempty"`
+	NotBefore      time.Time `json:"not_before,omitempty" xml:"not_before,omitempty" yaml:"not_before,omitempty"`
+}
+
+// PublicKeyReportEntry is an entry of public key policy compliance report.
+type PublicKeyReportEntry struct {
+	Username    string    `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
+	Email       string    `json:"email,omitempty" xml:"email,omitempty" yaml:"email,omitempty"`
+	ID          string    `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	Usage       string    `json:"usage,omitempty" xml:"usage,omitempty" yaml:"usage,omitempty"`
+	Type        string    `json:"type,omitempty" xml:"type,omitempty" yaml:"type,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty" xml:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Comment     string    `json:"comment,omitempty" xml:"comment,omitempty" yaml:"comment,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty" xml:"created_at,omitempty" yaml:"created_at,omitempty"`
+	Violation   string    `json:"violation,omitempty" xml:"violation,omitempty" yaml:"violation,omitempty"`
+	Disabled    bool      `json:"disabled,omitempty" xml:"disabled,omitempty" yaml:"disabled,omitempty"`
 }
 
 // NewPublicKeyBundle returns an instance of PublicKeyBundle.
@@ -85,9 +134,13 @@ func (b *PublicKeyBundle) Size() int {
 
 // NewPublicKey returns an instance of PublicKey.
 func NewPublicKey(r *requests.Request) (*PublicKey, error) {
+	id, err := GenerateRandomString(40)
+	if err != nil {
+		return nil, err
+	}
 	p := &PublicKey{
 		Comment:   r.Key.Comment,
-		ID:        GetRandomString(40),
+		ID:        id,
 		Payload:   r.Key.Payload,
 		Usage:     r.Key.Usage,
 		CreatedAt: time.Now().UTC(),
@@ -95,6 +148,14 @@ func NewPublicKey(r *requests.Request) (*PublicKey, error) {
 	if err := p.parse(); err != nil {
 		return nil, err
 	}
+	if len(r.Key.Options) > 0 {
+		if p.Usage != "ssh" {
+			return nil, errors.ErrPublicKeyUsagePayloadMismatch.WithArgs(p.Usage)
+		}
+		if err := p.SetOptions(r.Key.Options); err != nil {
+			return nil, err
+		}
+	}
 	if r.Key.Disabled {
 		p.Disabled = true
 		p.DisabledAt = time.Now().UTC()
@@ -110,6 +171,31 @@ func (p *PublicKey) Disable() {
 	p.DisabledAt = time.Now().UTC()
 }
 
+// Suspend disables PublicKey instance temporarily. Unlike Disable, it does not
+// expire the key, so the key can be re-enabled with Enable.
+func (p *PublicKey) Suspend() {
+	p.Disabled = true
+	p.DisabledAt = time.Now().UTC()
+	p.ModifiedAt = p.DisabledAt
+}
+
+// Enable re-enables PublicKey instance suspended with Suspend. The expired
+// key cannot be re-enabled.
+func (p *PublicKey) Enable() error {
+	if p.Expired {
+		return errors.ErrCredentialExpired
+	}
+	p.Disabled = false
+	p.ModifiedAt = time.Now().UTC()
+	return nil
+}
+
+// SetComment changes the comment of PublicKey instance.
+func (p *PublicKey) SetComment(s string) {
+	p.Comment = s
+	p.ModifiedAt = time.Now().UTC()
+}
+
 func (p *PublicKey) parse() error {
 	if _, exists := supportedPublicKeyTypes[p.Usage]; !exists {
 		return errors.ErrPublicKeyInvalidUsage.WithArgs(p.Usage)
@@ -118,17 +204,154 @@ func (p *PublicKey) parse() error {
 		return errors.ErrPublicKeyEmptyPayload
 	}
 	switch {
-	case strings.Contains(p.Payload, "RSA PUBLIC KEY"):
-		return p.parsePublicKeyRSA()
-	case strings.HasPrefix(p.Payload, "ssh-rsa "):
+	case strings.Contains(p.Payload, "RSA PUBLIC KEY"), strings.Contains(p.Payload, "BEGIN PUBLIC KEY"):
+		return p.parsePublicKeyPEM()
+	case isOpenSSHPublicKey(p.Payload):
 		return p.parsePublicKeyOpenSSH()
 	case strings.Contains(p.Payload, "BEGIN PGP PUBLIC KEY BLOCK"):
 		return p.parsePublicKeyPGP()
+	case strings.Contains(p.Payload, "BEGIN CERTIFICATE"):
+		return p.parsePublicKeyX509()
 	}
 	return errors.ErrPublicKeyUsageUnsupported.WithArgs(p.Usage)
 }
 
+// normalizePublicKeyFingerprint returns the fingerprint in the form indexing
+// PublicKey instances. The SHA256: prefix of OpenSSH fingerprints is removed.
+// The hexadecimal fingerprints of GPG keys and X.509 certificates are
+// lowercased, and their separators are removed, e.g. 3B24 00A9 or 3b:24:00.
+func normalizePublicKeyFingerprint(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "SHA256:")
+	h := strings.ToLower(strings.NewReplacer(" ", "", ":", "").Replace(s))
+	if len(h) != 40 && len(h) != 64 {
+		return s
+	}
+	if _, err := hex.DecodeString(h); err != nil {
+		return s
+	}
+	return h
+}
+
+// getSSHPublicKey returns the SSH public key of PublicKey instance.
+func (p *PublicKey) getSSHPublicKey() (ssh.PublicKey, error) {
+	if p.Usage != "ssh" {
+		return nil, errors.ErrPublicKeyUsageUnsupported.WithArgs(p.Usage)
+	}
+	if p.OpenSSH != "" {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(p.OpenSSH))
+		if err != nil {
+			return nil, errors.ErrPublicKeyParse.WithArgs(err)
+		}
+		publicKey, err := ssh.ParsePublicKey(b)
+		if err != nil {
+			return nil, errors.ErrPublicKeyParse.WithArgs(err)
+		}
+		return publicKey, nil
+	}
+	if block, _ := pem.Decode([]byte(p.Payload)); block != nil {
+		cryptoKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.ErrPublicKeyParse.WithArgs(err)
+		}
+		publicKey, err := ssh.NewPublicKey(cryptoKey)
+		if err != nil {
+			return nil, errors.ErrPublicKeyParse.WithArgs(err)
+		}
+		return publicKey, nil
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(p.Payload))
+	if err != nil {
+		return nil, errors.ErrPublicKeyParse.WithArgs(err)
+	}
+	return publicKey, nil
+}
+
+// getKeyAttributes returns the type of PublicKey instance, e.g. rsa, the size
+// of its RSA key, in bits, and the creation time of the key. The size is 0
+// for non-RSA keys. The size of a GPG key is the size of its smallest RSA key
+// or subkey.
+func (p *PublicKey) getKeyAttributes() (string, int, time.Time, error) {
+	switch p.Usage {
+	case "ssh":
+		publicKey, err := p.getSSHPublicKey()
+		if err != nil {
+			return "", 0, time.Time{}, err
+		}
+		var keyType string
+		switch publicKey.Type() {
+		case ssh.KeyAlgoRSA:
+			keyType = "rsa"
+		case ssh.KeyAlgoDSA:
+			keyType = "dsa"
+		case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, ssh.KeyAlgoSKECDSA256:
+			keyType = "ecdsa"
+		case ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519:
+			keyType = "ed25519"
+		default:
+			return "", 0, time.Time{}, errors.ErrPublicKeyTypeUnsupported.WithArgs(publicKey.Type())
+		}
+		var bits int
+		if cryptoKey, ok := publicKey.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok {
+				bits = rsaKey.N.BitLen()
+			}
+		}
+		return keyType, bits, p.CreatedAt, nil
+	case "gpg":
+		kr, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(p.Payload))
+		if err != nil {
+			return "", 0, time.Time{}, errors.ErrPublicKeyParse.WithArgs(err)
+		}
+		if len(kr) != 1 || kr[0].PrimaryKey == nil {
+			return "", 0, time.Time{}, errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring contains %d entries", len(kr)))
+		}
+		entity := kr[0]
+		keys := []*packet.PublicKey{entity.PrimaryKey}
+		for _, k := range entity.Subkeys {
+			if k.PublicKey == nil || (k.Sig != nil && k.Sig.SigType == packet.SigTypeSubkeyRevocation) {
+				continue
+			}
+			keys = append(keys, k.PublicKey)
+		}
+		var bits int
+		for _, k := range keys {
+			rsaKey, ok := k.PublicKey.(*rsa.PublicKey)
+			if !ok {
+				continue
+			}
+			if bits == 0 || rsaKey.N.BitLen() < bits {
+				bits = rsaKey.N.BitLen()
+			}
+		}
+		return p.Type, bits, entity.PrimaryKey.CreationTime.UTC(), nil
+	case "x509":
+		cert, err := parseX509Certificate(p.Payload)
+		if err != nil {
+			return "", 0, time.Time{}, err
+		}
+		var bits int
+		if rsaKey, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			bits = rsaKey.N.BitLen()
+		}
+		return p.Type, bits, cert.NotBefore.UTC(), nil
+	}
+	return "", 0, time.Time{}, errors.ErrPublicKeyUsageUnsupported.WithArgs(p.Usage)
+}
+
+// isOpenSSHPublicKey returns true if the payload starts with the type of
+// an OpenSSH public key, e.g. ssh-ed25519.
+func isOpenSSHPublicKey(s string) bool {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return false
+	}
+	return supportedOpenSSHKeyTypes[fields[0]]
+}
+
 func (p *PublicKey) parsePublicKeyOpenSSH() error {
+	if p.Usage != "ssh" {
+		return errors.ErrPublicKeyUsagePayloadMismatch.WithArgs(p.Usage)
+	}
 	// Attempt parsing as authorized OpenSSH keys.
 	payloadBytes := bytes.TrimSpace([]byte(p.Payload))
 	i := bytes.IndexAny(payloadBytes, " \t")
@@ -136,10 +359,11 @@ func (p *PublicKey) parsePublicKeyOpenSSH() error {
 		i = len(payloadBytes)
 	}
 
-	var comment []byte
+	var comment, preamble []byte
 	payloadBase64 := payloadBytes[:i]
-	if len(payloadBase64) < 20 {
+	if supportedOpenSSHKeyTypes[string(payloadBase64)] {
 		// skip preamble, i.e. ssh-rsa, etc.
+		preamble = payloadBase64
 		payloadBase64 = bytes.TrimSpace(payloadBytes[i:])
 		i = bytes.IndexAny(payloadBase64, " \t")
 		if i > 0 {
@@ -157,6 +381,12 @@ func (p *PublicKey) parsePublicKeyOpenSSH() error {
 	if err != nil {
 		return errors.ErrPublicKeyParse.WithArgs(err)
 	}
+	if !supportedOpenSSHKeyTypes[publicKey.Type()] {
+		return errors.ErrPublicKeyTypeUnsupported.WithArgs(publicKey.Type())
+	}
+	if preamble != nil && string(preamble) != publicKey.Type() {
+		return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("key type %q does not match %q preamble", publicKey.Type(), preamble))
+	}
 	p.Type = publicKey.Type()
 	if string(comment) != "" {
 		p.Comment = string(comment)
@@ -164,35 +394,49 @@ func (p *PublicKey) parsePublicKeyOpenSSH() error {
 	p.FingerprintMD5 = ssh.FingerprintLegacyMD5(publicKey)
 	p.Fingerprint = ssh.FingerprintSHA256(publicKey)
 
-	// Convert OpenSSH key to RSA PUBLIC KEY
-	switch publicKey.Type() {
-	case "ssh-rsa":
-		publicKeyBytes := publicKey.Marshal()
-		parsedPublicKey, err := ssh.ParsePublicKey(publicKeyBytes)
-		if err != nil {
-			return errors.ErrPublicKeyParse.WithArgs(err)
-		}
-		cryptoKey := parsedPublicKey.(ssh.CryptoPublicKey)
-		publicCryptoKey := cryptoKey.CryptoPublicKey()
-		rsaKey := publicCryptoKey.(*rsa.PublicKey)
-		rsaKeyASN1, err := x509.MarshalPKIXPublicKey(rsaKey)
-		if err != nil {
-			return errors.ErrPublicKeyParse.WithArgs(err)
-		}
-		encodedKey := pem.EncodeToMemory(&pem.Block{
-			Type: "RSA PUBLIC KEY",
-			//Bytes: x509.MarshalPKCS1PublicKey(rsaKey),
-			Bytes: rsaKeyASN1,
-		})
-		p.Payload = string(encodedKey)
-	default:
-		return errors.ErrPublicKeyTypeUnsupported.WithArgs(publicKey.Type())
+	// Convert OpenSSH key to PKIX PEM form. The keys backed by security
+	// keys and DSA keys have no such form and are stored as authorized keys.
+	encodedKey, err := getPublicKeyPEM(publicKey)
+	if err != nil {
+		return errors.ErrPublicKeyParse.WithArgs(err)
+	}
+	if encodedKey == "" {
+		encodedKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
 	}
+	p.Payload = encodedKey
 	return nil
 }
 
+// getPublicKeyPEM returns PKIX PEM form of an OpenSSH public key. It returns
+// empty string when the key has no such form.
+func getPublicKeyPEM(publicKey ssh.PublicKey) (string, error) {
+	cryptoKey, ok := publicKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return "", nil
+	}
+	blockType := "PUBLIC KEY"
+	switch cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		blockType = "RSA PUBLIC KEY"
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return "", nil
+	}
+	keyASN1, err := x509.MarshalPKIXPublicKey(cryptoKey.CryptoPublicKey())
+	if err != nil {
+		return "", err
+	}
+	encodedKey := pem.EncodeToMemory(&pem.Block{
+		Type:  blockType,
+		Bytes: keyASN1,
+	})
+	return string(encodedKey), nil
+}
+
 func (p *PublicKey) parsePublicKeyPGP() error {
-	var user, algo, comment string
+	if p.Usage != "gpg" {
+		return errors.ErrPublicKeyUsagePayloadMismatch.WithArgs(p.Usage)
+	}
 	p.Payload = strings.TrimSpace(p.Payload)
 	for _, w := range []string{"BEGIN", "END"} {
 		s := fmt.Sprintf("-----%s PGP PUBLIC KEY BLOCK-----", w)
@@ -207,36 +451,85 @@ func (p *PublicKey) parsePublicKeyPGP() error {
 	if len(kr) != 1 {
 		return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring contains %d entries", len(kr)))
 	}
-	if kr[0].PrimaryKey == nil {
+	entity := kr[0]
+	if entity.PrimaryKey == nil {
 		return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring entry has no public key"))
 	}
-	if kr[0].Identities == nil || len(kr[0].Identities) == 0 {
+	if entity.Identities == nil || len(entity.Identities) == 0 {
 		return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring entry has no identities"))
 	}
-	pk := kr[0].PrimaryKey
+	pk := entity.PrimaryKey
 	p.ID = strconv.FormatUint(pk.KeyId, 16)
 	p.Fingerprint = hex.EncodeToString(pk.Fingerprint[:])
-	switch pk.PubKeyAlgo {
-	case 1, 2, 3:
-		algo = "RSA"
-		p.Type = "rsa"
-	case 17:
-		algo = "DSA"
-		p.Type = "dsa"
-	case 18:
-		algo = "ECDH"
-		p.Type = "ecdh"
-	case 19:
-		algo = "ECDSA"
-		p.Type = "ecdsa"
-	default:
-		return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring entry has unsupported public key algo %v", pk.PubKeyAlgo))
+	if len(entity.Revocations) > 0 {
+		return errors.ErrPublicKeyRevoked.WithArgs(p.ID)
 	}
-	for _, u := range kr[0].Identities {
-		user = u.Name
-		break
+	algo, keyType, err := getPGPKeyType(pk.PubKeyAlgo)
+	if err != nil {
+		return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring entry has %v", err))
 	}
-	comment = fmt.Sprintf("%s, algo %s, created %s", user, algo, pk.CreationTime.UTC())
+	p.Type = keyType
+	flags, err := getPGPKeyFlags(p.Payload)
+	if err != nil {
+		return errors.ErrPublicKeyParse.WithArgs(err)
+	}
+
+	// Sort the identities, because the identities of an entity are a map.
+	var names []string
+	for name := range entity.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var primaryIdentity *openpgp.Identity
+	for _, name := range names {
+		u := entity.Identities[name]
+		identity := &PublicKeyIdentity{
+			Name:    u.UserId.Name,
+			Comment: u.UserId.Comment,
+			Email:   u.UserId.Email,
+		}
+		if u.SelfSignature != nil && u.SelfSignature.IsPrimaryId != nil && *u.SelfSignature.IsPrimaryId {
+			if primaryIdentity == nil {
+				primaryIdentity = u
+				identity.Primary = true
+			}
+		}
+		p.Identities = append(p.Identities, identity)
+	}
+	if primaryIdentity == nil {
+		primaryIdentity = entity.Identities[names[0]]
+		p.Identities[0].Primary = true
+	}
+
+	p.ExpiredAt = getPGPKeyExpiry(pk, primaryIdentity.SelfSignature)
+	if !p.ExpiredAt.IsZero() && time.Now().After(p.ExpiredAt) {
+		return errors.ErrPublicKeyExpired.WithArgs(p.ID, p.ExpiredAt)
+	}
+	keyFlags, found := flags[pk.KeyId]
+	p.Capabilities = getPGPKeyCapabilities(pk, keyFlags, found, true)
+
+	for _, k := range entity.Subkeys {
+		if k.PublicKey == nil || k.Sig == nil {
+			continue
+		}
+		if k.Sig.SigType == packet.SigTypeSubkeyRevocation {
+			continue
+		}
+		subkey := &PublicSubkey{
+			ID:          strconv.FormatUint(k.PublicKey.KeyId, 16),
+			Fingerprint: hex.EncodeToString(k.PublicKey.Fingerprint[:]),
+			CreatedAt:   k.PublicKey.CreationTime.UTC(),
+			ExpiredAt:   getPGPKeyExpiry(k.PublicKey, k.Sig),
+		}
+		if _, subkey.Type, err = getPGPKeyType(k.PublicKey.PubKeyAlgo); err != nil {
+			return errors.ErrPublicKeyParse.WithArgs(fmt.Errorf("PGP keyring entry subkey has %v", err))
+		}
+		keyFlags, found := flags[k.PublicKey.KeyId]
+		subkey.Capabilities = getPGPKeyCapabilities(k.PublicKey, keyFlags, found, false)
+		p.Subkeys = append(p.Subkeys, subkey)
+	}
+
+	comment := fmt.Sprintf("%s, algo %s, created %s", primaryIdentity.Name, algo, pk.CreationTime.UTC())
 	if p.Comment != "" {
 		p.Comment = fmt.Sprintf("%s (%s)", p.Comment, comment)
 	} else {
@@ -245,7 +538,7 @@ func (p *PublicKey) parsePublicKeyPGP() error {
 	return nil
 }
 
-func (p *PublicKey) parsePublicKeyRSA() error {
+func (p *PublicKey) parsePublicKeyPEM() error {
 	// Processing PEM file format
 	if p.Usage != "ssh" {
 		return errors.ErrPublicKeyUsagePayloadMismatch.WithArgs(p.Usage)
@@ -254,7 +547,7 @@ func (p *PublicKey) parsePublicKeyRSA() error {
 	if block == nil {
 		return errors.ErrPublicKeyBlockType.WithArgs("")
 	}
-	if block.Type != "RSA PUBLIC KEY" {
+	if block.Type != "RSA PUBLIC KEY" && block.Type != "PUBLIC KEY" {
 		return errors.ErrPublicKeyBlockType.WithArgs(block.Type)
 	}
 	publicKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
@@ -270,6 +563,6 @@ func (p *PublicKey) parsePublicKeyRSA() error {
 	p.Fingerprint = ssh.FingerprintSHA256(publicKey)
 	p.Fingerprint = strings.ReplaceAll(p.Fingerprint, "SHA256:", "")
 	p.OpenSSH = string(ssh.MarshalAuthorizedKey(publicKey))
-	p.OpenSSH = strings.TrimLeft(p.OpenSSH, p.Type+" ")
+	p.OpenSSH = strings.TrimPrefix(p.OpenSSH, p.Type+" ")
 	return nil
 }
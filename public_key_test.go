@@ -29,6 +29,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func readPEMFile(fp string) string {
@@ -250,3 +251,221 @@ func TestNewPublicKey(t *testing.T) {
 		})
 	}
 }
+
+func TestNewOpenSSHPublicKey(t *testing.T) {
+	testcases := []struct {
+		name      string
+		algo      string
+		keyType   string
+		payload   string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:    "test openssh ed25519 key",
+			algo:    "ed25519",
+			keyType: "openssh",
+			want: map[string]interface{}{
+				"type":  "ssh-ed25519",
+				"block": "-----BEGIN PUBLIC KEY-----",
+			},
+		},
+		{
+			name:    "test openssh ecdsa key",
+			algo:    "ecdsa",
+			keyType: "openssh",
+			want: map[string]interface{}{
+				"type":  "ecdsa-sha2-nistp256",
+				"block": "-----BEGIN PUBLIC KEY-----",
+			},
+		},
+		{
+			name:    "test pem ed25519 key",
+			algo:    "ed25519",
+			keyType: "pem",
+			want: map[string]interface{}{
+				"type":  "ssh-ed25519",
+				"block": "-----BEGIN PUBLIC KEY-----",
+			},
+		},
+		{
+			name:    "test openssh rsa key",
+			algo:    "rsa",
+			keyType: "openssh",
+			want: map[string]interface{}{
+				"type":  "ssh-rsa",
+				"block": "-----BEGIN RSA PUBLIC KEY-----",
+			},
+		},
+		{
+			name:    "test security key backed ed25519 key",
+			payload: "sk-ssh-ed25519@openssh.com AAAAGnNrLXNzaC1lZDI1NTE5QG9wZW5zc2guY29tAAAAIMxFtDBa8xyF2mn81+TFeCkXmLC8iwsG6Eo9O6GuHS0GAAAABHNzaDo= jsmith@yubikey",
+			want: map[string]interface{}{
+				"type":  "sk-ssh-ed25519@openssh.com",
+				"block": "sk-ssh-ed25519@openssh.com AAAAGnNrLXNzaC1lZDI1NTE5QG9wZW5zc2guY29tAAAAIMxFtDBa8xyF2mn81+TFeCkXmLC8iwsG6Eo9O6GuHS0GAAAABHNzaDo=",
+			},
+		},
+		{
+			name:    "test security key backed ecdsa key",
+			payload: "sk-ecdsa-sha2-nistp256@openssh.com AAAAInNrLWVjZHNhLXNoYTItbmlzdHAyNTZAb3BlbnNzaC5jb20AAAAIbmlzdHAyNTYAAABBBL/cuiqEyW7LTY66SYNiVvJKZqcIOF9AkHcUg9PmbGWkqE2GgTeSLOn40eoOj9x05/QOCXhYp+HXlZY7DYRIdEMAAAAEc3NoOg== jsmith@yubikey",
+			want: map[string]interface{}{
+				"type":  "sk-ecdsa-sha2-nistp256@openssh.com",
+				"block": "sk-ecdsa-sha2-nistp256@openssh.com AAAAInNrLWVjZHNhLXNoYTItbmlzdHAyNTZAb3BlbnNzaC5jb20AAAAIbmlzdHAyNTYAAABBBL/cuiqEyW7LTY66SYNiVvJKZqcIOF9AkHcUg9PmbGWkqE2GgTeSLOn40eoOj9x05/QOCXhYp+HXlZY7DYRIdEMAAAAEc3NoOg==",
+			},
+		},
+		{
+			name:      "test openssh key with mismatched type",
+			payload:   "ssh-ed25519 AAAAGnNrLXNzaC1lZDI1NTE5QG9wZW5zc2guY29tAAAAIMxFtDBa8xyF2mn81+TFeCkXmLC8iwsG6Eo9O6GuHS0GAAAABHNzaDo=",
+			shouldErr: true,
+			err:       errors.ErrPublicKeyParse.WithArgs(`key type "sk-ssh-ed25519@openssh.com" does not match "ssh-ed25519" preamble`),
+		},
+		{
+			name:      "test openssh certificate",
+			payload:   "ssh-ed25519-cert-v01@openssh.com AAAA",
+			shouldErr: true,
+			err:       errors.ErrPublicKeyUsageUnsupported.WithArgs("ssh"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			payload := tc.payload
+			if payload == "" {
+				_, payload = tests.GetCryptoKeyPair(t, tc.algo, tc.keyType)
+			}
+			key, err := NewPublicKey(&requests.Request{Key: requests.Key{Usage: "ssh", Payload: payload}})
+			if tests.EvalErrWithLog(t, err, "new public key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["type"] = key.Type
+			got["block"] = strings.Split(key.Payload, "\n")[0]
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+
+			if tc.keyType == "pem" {
+				return
+			}
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests.EvalObjectsWithLog(t, "fingerprint", ssh.FingerprintSHA256(publicKey), key.Fingerprint, msgs)
+		})
+	}
+}
+
+func TestNewPGPPublicKey(t *testing.T) {
+	testcases := []struct {
+		name      string
+		file      string
+		user      *User
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test gpg public key with identities and subkeys",
+			file: "testdata/gpg/jsmith_gpg_pub.pem",
+			user: NewUser("jsmith"),
+			want: map[string]interface{}{
+				"id":           "d58faec8bb7d2aa5",
+				"type":         "rsa",
+				"capabilities": []string{"certify", "sign"},
+				"expired_at":   "2099-01-01T12:00:00Z",
+				"identities": []string{
+					"John Smith <john.smith@contoso.com>, verified: false",
+					"John Smith <jsmith@gmail.com>, verified: true",
+				},
+				"subkeys": []string{
+					"52e1fc5ab7f78eac, rsa, [encrypt], expires 2099-01-01T12:00:00Z",
+					"b471ba950dbd124d, rsa, [auth], expires 2098-01-01T12:00:00Z",
+				},
+			},
+		},
+		{
+			name: "test gpg public key with elgamal subkey and without expiry",
+			file: "testdata/gpg/linux_gpg_pub.pem",
+			want: map[string]interface{}{
+				"id":           "a040830f7fac5991",
+				"type":         "dsa",
+				"capabilities": []string{"certify", "sign"},
+				"expired_at":   "0001-01-01T00:00:00Z",
+				"identities": []string{
+					"Google, Inc. Linux Package Signing Key <linux-packages-keymaster@google.com>, verified: false",
+				},
+				"subkeys": []string{
+					"4f30b6b4c07cb649, elgamal, [encrypt], expires 0001-01-01T00:00:00Z",
+				},
+			},
+		},
+		{
+			name:      "test gpg public key with identities not matching user email addresses",
+			file:      "testdata/gpg/jsmith_gpg_pub.pem",
+			user:      NewUser("bjones"),
+			shouldErr: true,
+			err: errors.ErrAddPublicKey.WithArgs("gpg",
+				errors.ErrPublicKeyEmailMismatch.WithArgs("d58faec8bb7d2aa5"),
+			),
+		},
+		{
+			name:      "test revoked gpg public key",
+			file:      "testdata/gpg/bjones_revoked_gpg_pub.pem",
+			shouldErr: true,
+			err:       errors.ErrPublicKeyRevoked.WithArgs("627011b31c66b4a6"),
+		},
+		{
+			name:      "test expired gpg public key",
+			file:      "testdata/gpg/bjones_expired_gpg_pub.pem",
+			shouldErr: true,
+			err: errors.ErrPublicKeyExpired.WithArgs("1db9a997eb780a18",
+				time.Date(2016, time.January, 1, 12, 0, 0, 0, time.UTC),
+			),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			var key *PublicKey
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			r := &requests.Request{
+				Key: requests.Key{
+					Usage:   "gpg",
+					Payload: readPEMFile(tc.file),
+				},
+			}
+			if tc.user != nil {
+				if err := tc.user.AddEmailAddress(tc.user.Username + "@gmail.com"); err != nil {
+					t.Fatalf("failed adding email address: %v", err)
+				}
+				err = tc.user.AddPublicKey(r)
+				if err == nil {
+					key = tc.user.PublicKeys[len(tc.user.PublicKeys)-1]
+				}
+			} else {
+				key, err = NewPublicKey(r)
+			}
+			if tests.EvalErrWithLog(t, err, "new public key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+
+			got := make(map[string]interface{})
+			got["id"] = key.ID
+			got["type"] = key.Type
+			got["capabilities"] = key.Capabilities
+			got["expired_at"] = key.ExpiredAt.Format(time.RFC3339)
+			identities := []string{}
+			for _, identity := range key.Identities {
+				identities = append(identities, fmt.Sprintf("%s <%s>, verified: %t", identity.Name, identity.Email, identity.Verified))
+			}
+			got["identities"] = identities
+			subkeys := []string{}
+			for _, subkey := range key.Subkeys {
+				subkeys = append(subkeys, fmt.Sprintf("%s, %s, %v, expires %s", subkey.ID, subkey.Type, subkey.Capabilities, subkey.ExpiredAt.Format(time.RFC3339)))
+			}
+			got["subkeys"] = subkeys
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
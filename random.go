@@ -15,41 +15,121 @@
 package identity
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"io"
+	"math/big"
+	"sync"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyz" +
 	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-var seed *rand.Rand = rand.New(
-	rand.NewSource(time.Now().UnixNano()),
+var (
+	randomMu     sync.Mutex
+	randomSource io.Reader = rand.Reader
 )
 
-func gen(length int, charset string) string {
+// SetRandomSource sets the source of randomness used to generate random
+// strings, e.g. API keys and IDs. The nil source resets it to crypto/rand.
+// The function is intended for deterministic tests.
+func SetRandomSource(r io.Reader) {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+	if r == nil {
+		r = rand.Reader
+	}
+	randomSource = r
+}
+
+// readRandomBytes fills a slice with the bytes from the source of
+// randomness.
+func readRandomBytes(b []byte) error {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+	_, err := io.ReadFull(randomSource, b)
+	return err
+}
+
+// getRandomInt returns a uniformly distributed random number in the
+// range of [0, n).
+func getRandomInt(n int) (int, error) {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+	i, err := rand.Int(randomSource, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, errors.ErrRandomSource.WithArgs(err)
+	}
+	return int(i.Int64()), nil
+}
+
+// gen returns a random string of the characters from a character set. The
+// random bytes exceeding the largest multiple of the character set length
+// are discarded to avoid modulo bias.
+func gen(length int, charset string) (string, error) {
 	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seed.Intn(len(charset))]
+	limit := 256 - (256 % len(charset))
+	buf := make([]byte, length)
+	for i := 0; i < length; {
+		if err := readRandomBytes(buf); err != nil {
+			return "", errors.ErrRandomSource.WithArgs(err)
+		}
+		for _, c := range buf {
+			if int(c) >= limit {
+				continue
+			}
+			b[i] = charset[int(c)%len(charset)]
+			i++
+			if i == length {
+				break
+			}
+		}
 	}
-	return string(b)
+	return string(b), nil
 }
 
-// GetRandomString returns X character long random string.
-func GetRandomString(i int) string {
+// mustGen returns a random string of the characters from a character set.
+// It panics when the source of randomness fails.
+func mustGen(length int, charset string) string {
+	s, err := gen(length, charset)
+	if err != nil {
+		panic(err.Error())
+	}
+	return s
+}
+
+// GenerateRandomString returns X character long random string. It returns
+// an error when the source of randomness fails.
+func GenerateRandomString(i int) (string, error) {
 	if i < 1 {
 		i = 40
 	}
 	return gen(i, charset)
 }
 
+// GetRandomString returns X character long random string. It panics when
+// the source of randomness fails, see GenerateRandomString.
+func GetRandomString(i int) string {
+	if i < 1 {
+		i = 40
+	}
+	return mustGen(i, charset)
+}
+
 // GetRandomStringFromRange generates random string of a random length. The
-// random lenght is bounded by a and b.
+// random lenght is bounded by a and b. It panics when the source of
+// randomness fails.
 func GetRandomStringFromRange(a, b int) string {
-	var i int
 	if a > b {
-		i = rand.Intn(a-b) + b
-	} else {
-		i = rand.Intn(b-a) + a
+		a, b = b, a
 	}
-	return gen(i, charset)
+	i := a
+	if a < b {
+		n, err := getRandomInt(b - a)
+		if err != nil {
+			panic(err.Error())
+		}
+		i += n
+	}
+	return mustGen(i, charset)
 }
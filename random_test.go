@@ -0,0 +1,171 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+)
+
+func TestRandomString(t *testing.T) {
+	testcases := []struct {
+		name      string
+		source    []byte
+		fn        func() string
+		want      map[string]interface{}
+		shouldErr bool
+	}{
+		{
+			name:   "generate random string with deterministic source",
+			source: []byte{0, 248, 61, 62, 255, 100, 0, 0},
+			fn:     func() string { return GetRandomString(4) },
+			want: map[string]interface{}{
+				"output": "a9aM",
+			},
+		},
+		{
+			name:   "generate lowercase random string with deterministic source",
+			source: []byte{35, 252, 36, 71, 1, 0, 0, 0},
+			fn:     func() string { return NewRandomString(4) },
+			want: map[string]interface{}{
+				"output": "9a9b",
+			},
+		},
+		{
+			name:   "generate random string of random length with deterministic source",
+			source: []byte{1, 1, 2, 3, 4},
+			fn:     func() string { return GetRandomStringFromRange(5, 3) },
+			want: map[string]interface{}{
+				"output": "bcde",
+			},
+		},
+		{
+			name:   "generate random string of fixed length with deterministic source",
+			source: []byte{1, 2, 3},
+			fn:     func() string { return GetRandomStringFromRange(3, 3) },
+			want: map[string]interface{}{
+				"output": "bcd",
+			},
+		},
+		{
+			name:      "generate random string with exhausted source",
+			source:    []byte{0, 1},
+			fn:        func() string { return GetRandomString(4) },
+			shouldErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			SetRandomSource(bytes.NewReader(tc.source))
+			defer SetRandomSource(nil)
+			defer func() {
+				r := recover()
+				if tc.shouldErr && r == nil {
+					t.Fatalf("expected panic, but got success")
+				}
+				if !tc.shouldErr && r != nil {
+					t.Fatalf("unexpected panic: %v", r)
+				}
+			}()
+			got := make(map[string]interface{})
+			got["output"] = tc.fn()
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestGenerateRandomString(t *testing.T) {
+	testcases := []struct {
+		name      string
+		source    []byte
+		fn        func() (string, error)
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:   "generate random string with deterministic source",
+			source: []byte{0, 248, 61, 62, 255, 100, 0, 0},
+			fn:     func() (string, error) { return GenerateRandomString(4) },
+			want: map[string]interface{}{
+				"output": "a9aM",
+			},
+		},
+		{
+			name:      "generate random string with exhausted source",
+			source:    []byte{0, 1},
+			fn:        func() (string, error) { return GenerateRandomString(4) },
+			shouldErr: true,
+			err:       errors.ErrRandomSource.WithArgs(io.ErrUnexpectedEOF),
+		},
+		{
+			name: "add api key with exhausted source",
+			fn: func() (string, error) {
+				SetRandomSource(nil)
+				db, err := createTestDatabase("TestGenerateRandomString")
+				if err != nil {
+					return "", err
+				}
+				r := &requests.Request{
+					User: requests.User{Username: testUser1, Email: testEmail1},
+					Key:  requests.Key{Usage: "api", Comment: "exhausted"},
+				}
+				SetRandomSource(bytes.NewReader(nil))
+				err = db.AddAPIKey(r)
+				return "", err
+			},
+			shouldErr: true,
+			err:       errors.ErrAddAPIKey.WithArgs("api", errors.ErrRandomSource.WithArgs(io.EOF)),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			SetRandomSource(bytes.NewReader(tc.source))
+			defer SetRandomSource(nil)
+			s, err := tc.fn()
+			if tests.EvalErrWithLog(t, err, "generate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["output"] = s
+			tests.EvalObjectsWithLog(t, "output", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestRandomStringCharset(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		s := GetRandomStringFromRange(72, 96)
+		if len(s) < 72 || len(s) >= 96 {
+			t.Fatalf("unexpected random string length: %d", len(s))
+		}
+		if !regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString(s) {
+			t.Fatalf("unexpected random string characters: %s", s)
+		}
+		s = NewRandomString(0)
+		if !regexp.MustCompile(`^[a-z0-9]{32}$`).MatchString(s) {
+			t.Fatalf("unexpected random string: %s", s)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"github.com/greenpau/go-identity/pkg/errors"
+	"strings"
+)
+
+// The types of user identities.
+const (
+	UserTypeHuman   = "human"
+	UserTypeService = "service"
+)
+
+// The types of service account owners.
+const (
+	ServiceAccountOwnerUser  = "user"
+	ServiceAccountOwnerGroup = "group"
+)
+
+// ServiceAccountOwner is the human user or the group responsible for a
+// service account.
+type ServiceAccountOwner struct {
+	Type string `json:"type,omitempty" xml:"type,omitempty" yaml:"type,omitempty"`
+	ID   string `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	Name string `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// NewServiceAccount returns an instance of User representing a non-human
+// identity. The service account has neither passwords nor email addresses
+// and authenticates with API keys or public keys only.
+func NewServiceAccount(username string, owner *ServiceAccountOwner, roles []string) (*User, error) {
+	user := NewUser(username)
+	user.Type = UserTypeService
+	user.Enabled = true
+	user.Owner = owner
+	if err := user.AddRoles(roles); err != nil {
+		return nil, err
+	}
+	if err := user.Valid(); err != nil {
+		return nil, err
+	}
+	user.Revision = 0
+	return user, nil
+}
+
+// Valid returns an error if the owner of a service account is malformed.
+func (o *ServiceAccountOwner) Valid() error {
+	switch o.Type {
+	case ServiceAccountOwnerUser:
+		if o.ID == "" {
+			return errors.ErrServiceAccountOwnerNotFound
+		}
+	case ServiceAccountOwnerGroup:
+	default:
+		return errors.ErrServiceAccountOwnerTypeInvalid.WithArgs(o.Type)
+	}
+	if strings.TrimSpace(o.Name) == "" {
+		return errors.ErrServiceAccountOwnerNotFound
+	}
+	return nil
+}
+
+// IsServiceAccount returns true if a user is a service account.
+func (user *User) IsServiceAccount() bool {
+	return user.Type == UserTypeService
+}
+
+// GetType returns the type of a user, i.e. human or service.
+func (user *User) GetType() string {
+	if user.IsServiceAccount() {
+		return UserTypeService
+	}
+	return UserTypeHuman
+}
+
+// validServiceAccount returns an error if a service account has
+// credentials other than API keys and public keys.
+func (user *User) validServiceAccount() error {
+	if user.Owner == nil {
+		return errors.ErrServiceAccountOwnerNotFound
+	}
+	if err := user.Owner.Valid(); err != nil {
+		return err
+	}
+	if len(user.Passwords) > 0 {
+		return errors.ErrServiceAccountPassword
+	}
+	if user.EmailAddress != nil || len(user.EmailAddresses) > 0 {
+		return errors.ErrServiceAccountEmailAddress
+	}
+	if len(user.MfaTokens) > 0 {
+		return errors.ErrServiceAccountMfaToken
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+)
+
+func TestNewServiceAccount(t *testing.T) {
+	testcases := []struct {
+		name      string
+		username  string
+		owner     *ServiceAccountOwner
+		roles     []string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:     "test service account owned by user",
+			username: "ci-runner",
+			owner: &ServiceAccountOwner{
+				Type: ServiceAccountOwnerUser,
+				ID:   "000000000000000000000000000000000001",
+				Name: "jsmith",
+			},
+			roles: []string{"viewer"},
+			want: map[string]interface{}{
+				"type":  "service",
+				"roles": []string{"viewer"},
+				"owner": "jsmith",
+			},
+		},
+		{
+			name:     "test service account owned by group",
+			username: "backup",
+			owner: &ServiceAccountOwner{
+				Type: ServiceAccountOwnerGroup,
+				Name: "ops",
+			},
+			want: map[string]interface{}{
+				"type":  "service",
+				"roles": []string(nil),
+				"owner": "ops",
+			},
+		},
+		{
+			name:      "test service account without owner",
+			username:  "backup",
+			shouldErr: true,
+			err:       errors.ErrServiceAccountOwnerNotFound,
+		},
+		{
+			name:     "test service account owned by user without id",
+			username: "backup",
+			owner: &ServiceAccountOwner{
+				Type: ServiceAccountOwnerUser,
+				Name: "jsmith",
+			},
+			shouldErr: true,
+			err:       errors.ErrServiceAccountOwnerNotFound,
+		},
+		{
+			name:     "test service account with invalid owner type",
+			username: "backup",
+			owner: &ServiceAccountOwner{
+				Type: "team",
+				Name: "ops",
+			},
+			shouldErr: true,
+			err:       errors.ErrServiceAccountOwnerTypeInvalid.WithArgs("team"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			user, err := NewServiceAccount(tc.username, tc.owner, tc.roles)
+			if tests.EvalErrWithLog(t, err, "new service account", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["type"] = user.GetMetadata().Type
+			got["roles"] = user.GetRolesClaim()
+			got["owner"] = user.GetMetadata().Owner
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestServiceAccountCredentials(t *testing.T) {
+	user, err := NewServiceAccount("backup", &ServiceAccountOwner{Type: ServiceAccountOwnerGroup, Name: "ops"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		name   string
+		modify func(*User)
+		err    error
+	}{
+		{
+			name: "test service account with password",
+			modify: func(u *User) {
+				u.Passwords = []*Password{{}}
+			},
+			err: errors.ErrServiceAccountPassword,
+		},
+		{
+			name: "test service account with email address",
+			modify: func(u *User) {
+				u.EmailAddresses = []*EmailAddress{{Address: "backup@localhost"}}
+			},
+			err: errors.ErrServiceAccountEmailAddress,
+		},
+		{
+			name: "test service account with mfa token",
+			modify: func(u *User) {
+				u.MfaTokens = []*MfaToken{{}}
+			},
+			err: errors.ErrServiceAccountMfaToken,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			account := *user
+			tc.modify(&account)
+			tests.EvalErrWithLog(t, account.Valid(), "valid", true, tc.err, msgs)
+		})
+	}
+}
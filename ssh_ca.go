@@ -0,0 +1,211 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/greenpau/go-identity/internal/utils"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSSHCertificateValidity is the default validity period of SSH
+	// certificates, in seconds.
+	defaultSSHCertificateValidity = 3600
+	// sshCertificateClockSkew is the period of time the certificates are
+	// backdated by to tolerate clock skew between hosts.
+	sshCertificateClockSkew = 5 * time.Minute
+)
+
+// defaultSSHCertificateExtensions are the extensions OpenSSH grants to the
+// certificates issued by ssh-keygen by default.
+var defaultSSHCertificateExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// SSHCertificateAuthority issues OpenSSH user certificates for the SSH
+// public keys of users.
+type SSHCertificateAuthority struct {
+	// DefaultValidity is the validity period, in seconds, of the
+	// certificates issued without explicit validity.
+	DefaultValidity int `json:"default_validity,omitempty" xml:"default_validity,omitempty" yaml:"default_validity,omitempty"`
+	// MaxValidity is the maximum validity period of certificates, in
+	// seconds. The value of 0 disables the limit.
+	MaxValidity int `json:"max_validity,omitempty" xml:"max_validity,omitempty" yaml:"max_validity,omitempty"`
+	// RolePrincipals maps the roles of users to the additional principals
+	// of the certificates issued to them, e.g. "admin" to "root". The roles
+	// without mapping are not principals.
+	RolePrincipals map[string]string `json:"role_principals,omitempty" xml:"role_principals,omitempty" yaml:"role_principals,omitempty"`
+	signer         ssh.Signer
+}
+
+// NewSSHCertificateAuthority returns an instance of SSHCertificateAuthority
+// with the private key loaded from a file. The key is either in OpenSSH or
+// PEM format.
+func NewSSHCertificateAuthority(fp string) (*SSHCertificateAuthority, error) {
+	b, err := utils.ReadFileBytes(fp)
+	if err != nil {
+		return nil, errors.ErrSSHCertificateAuthorityLoad.WithArgs(fp, err)
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, errors.ErrSSHCertificateAuthorityLoad.WithArgs(fp, err)
+	}
+	ca := &SSHCertificateAuthority{
+		DefaultValidity: defaultSSHCertificateValidity,
+		signer:          signer,
+	}
+	return ca, nil
+}
+
+// GetPublicKey returns the public key of the certificate authority in
+// authorized keys format, e.g. for TrustedUserCAKeys of sshd.
+func (ca *SSHCertificateAuthority) GetPublicKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.signer.PublicKey())))
+}
+
+// IssueUserCertificate signs the SSH public key of a user into an OpenSSH
+// user certificate. The principal of the certificate is the username, and
+// the principals the roles of the user are mapped to with RolePrincipals.
+func (ca *SSHCertificateAuthority) IssueUserCertificate(user *User, key *PublicKey, r *requests.Request) (*ssh.Certificate, error) {
+	if !key.isAuthorized() {
+		return nil, errors.ErrSSHCertificateKeyNotAuthorized
+	}
+	publicKey, err := key.getSSHPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	validity := r.Certificate.Validity
+	if validity == 0 {
+		validity = ca.DefaultValidity
+	}
+	if validity < 0 {
+		return nil, errors.ErrSSHCertificateValidity.WithArgs(validity)
+	}
+	if ca.MaxValidity > 0 && validity > ca.MaxValidity {
+		return nil, errors.ErrSSHCertificateValidityExceeded.WithArgs(validity, ca.MaxValidity)
+	}
+
+	principals := ca.getPrincipals(user)
+	if len(principals) == 0 {
+		return nil, errors.ErrSSHCertificateNoPrincipals
+	}
+
+	if err := validateSSHCertificateCriticalOptions(r.Certificate.CriticalOptions); err != nil {
+		return nil, err
+	}
+
+	extensions := r.Certificate.Extensions
+	if extensions == nil {
+		extensions = make(map[string]string)
+		for k, v := range defaultSSHCertificateExtensions {
+			extensions[k] = v
+		}
+	}
+
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	validBefore := now.Add(time.Duration(validity) * time.Second)
+	if !key.ExpiredAt.IsZero() && key.ExpiredAt.Before(validBefore) {
+		// The certificate does not outlive the key.
+		validBefore = key.ExpiredAt
+	}
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        ssh.UserCert,
+		KeyId:           user.Username,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-sshCertificateClockSkew).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: r.Certificate.CriticalOptions,
+			Extensions:      extensions,
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca.signer); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// validateSSHCertificateCriticalOptions validates the critical options of
+// SSH certificates. The options other than force-command, source-address,
+// and verify-required are rejected, because sshd refuses the certificates
+// with unrecognized critical options.
+func validateSSHCertificateCriticalOptions(options map[string]string) error {
+	for k, v := range options {
+		switch k {
+		case "force-command":
+			if v == "" {
+				return errors.ErrSSHCertificateCriticalOptionValue.WithArgs(k, v)
+			}
+		case "source-address":
+			if v == "" {
+				return errors.ErrSSHCertificateCriticalOptionValue.WithArgs(k, v)
+			}
+			for _, addr := range strings.Split(v, ",") {
+				if net.ParseIP(addr) != nil {
+					continue
+				}
+				if _, _, err := net.ParseCIDR(addr); err != nil {
+					return errors.ErrSSHCertificateCriticalOptionValue.WithArgs(k, v)
+				}
+			}
+		case "verify-required":
+			if v != "" {
+				return errors.ErrSSHCertificateCriticalOptionValue.WithArgs(k, v)
+			}
+		default:
+			return errors.ErrSSHCertificateCriticalOptionUnsupported.WithArgs(k)
+		}
+	}
+	return nil
+}
+
+// getPrincipals returns the principals of the certificates issued to a
+// user, i.e. the username followed by the principals the roles of the user
+// are mapped to.
+func (ca *SSHCertificateAuthority) getPrincipals(user *User) []string {
+	var principals []string
+	seen := make(map[string]bool)
+	candidates := []string{user.Username}
+	for _, role := range user.GetRolesClaim() {
+		candidates = append(candidates, ca.RolePrincipals[role])
+	}
+	for _, s := range candidates {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		principals = append(principals, s)
+	}
+	return principals
+}
@@ -0,0 +1,289 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewSSHCertificateAuthority(t *testing.T) {
+	tmpDir, err := tests.TempDir("TestNewSSHCertificateAuthority")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	caKey, _ := tests.GetCryptoKeyPair(t, "ed25519", "pem")
+	testcases := []struct {
+		name      string
+		content   string
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:    "load ed25519 ca key",
+			content: caKey,
+		},
+		{
+			name:      "load malformed ca key",
+			content:   "foobar",
+			shouldErr: true,
+			err:       errors.ErrSSHCertificateAuthorityLoad.WithArgs(filepath.Join(tmpDir, "load_malformed_ca_key"), "ssh: no key found"),
+		},
+	}
+	for i, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			fp := filepath.Join(tmpDir, strings.ReplaceAll(tc.name, " ", "_"))
+			if err := ioutil.WriteFile(fp, []byte(tc.content), 0600); err != nil {
+				t.Fatalf("test %d: %v", i, err)
+			}
+			ca, err := NewSSHCertificateAuthority(fp)
+			if tests.EvalErrWithLog(t, err, "new ssh ca", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "default validity", defaultSSHCertificateValidity, ca.DefaultValidity, msgs)
+		})
+	}
+}
+
+func TestDatabaseIssueSSHCertificate(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseIssueSSHCertificate")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user := requests.User{Username: testUser1, Email: testEmail1}
+	keyIDs := make(map[string]string)
+	for _, algo := range []string{"ed25519", "rsa", "ecdsa"} {
+		_, publicKey := tests.GetCryptoKeyPair(t, algo, "openssh")
+		if err := db.AddPublicKey(&requests.Request{User: user, Key: requests.Key{Usage: "ssh", Payload: publicKey}}); err != nil {
+			t.Fatal(err)
+		}
+		u, _ := db.getUser(testUser1)
+		keyIDs[algo] = u.PublicKeys[len(u.PublicKeys)-1].ID
+	}
+	if err := db.DisablePublicKey(&requests.Request{User: user, Key: requests.Key{ID: keyIDs["rsa"]}}); err != nil {
+		t.Fatal(err)
+	}
+	// The certificates issued for the ecdsa key expire together with the key.
+	u, _ := db.getUser(testUser1)
+	expiringKey := u.PublicKeys[len(u.PublicKeys)-1]
+	expiringKey.ExpiredAt = time.Now().UTC().Add(30 * time.Minute).Truncate(time.Second)
+
+	// The certificates cannot be issued without certificate authority.
+	err = db.IssueSSHCertificate(&requests.Request{User: user, Key: requests.Key{ID: keyIDs["ed25519"]}})
+	tests.EvalErrWithLog(t, err, "issue", true,
+		errors.ErrIssueSSHCertificate.WithArgs(keyIDs["ed25519"], errors.ErrSSHCertificateAuthorityNotConfigured),
+		[]string{"test name: issue ssh certificate without ca"},
+	)
+
+	tmpDir, err := tests.TempDir("TestDatabaseIssueSSHCertificate")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	caKey, _ := tests.GetCryptoKeyPair(t, "ed25519", "pem")
+	caKeyPath := filepath.Join(tmpDir, "ca_key")
+	if err := ioutil.WriteFile(caKeyPath, []byte(caKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewSSHCertificateAuthority(caKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.MaxValidity = 86400
+	db.SetSSHCertificateAuthority(ca)
+	caPublicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(ca.GetPublicKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name           string
+		keyID          string
+		certificate    requests.Certificate
+		rolePrincipals map[string]string
+		want           map[string]interface{}
+		shouldErr      bool
+		err            error
+	}{
+		{
+			name:  "issue certificate with defaults",
+			keyID: keyIDs["ed25519"],
+			want: map[string]interface{}{
+				"key_id":     testUser1,
+				"principals": []string{testUser1},
+				"validity":   3600,
+				"options":    map[string]string{},
+				"extensions": defaultSSHCertificateExtensions,
+			},
+		},
+		{
+			name:           "issue certificate with role principals",
+			keyID:          keyIDs["ed25519"],
+			rolePrincipals: map[string]string{"admin": "root", "editor": "deploy", "auditor": "audit"},
+			want: map[string]interface{}{
+				"key_id":     testUser1,
+				"principals": []string{testUser1, "deploy", "root"},
+				"validity":   3600,
+				"options":    map[string]string{},
+				"extensions": defaultSSHCertificateExtensions,
+			},
+		},
+		{
+			name:  "issue certificate with custom options",
+			keyID: keyIDs["ed25519"],
+			certificate: requests.Certificate{
+				Validity:        600,
+				CriticalOptions: map[string]string{"force-command": "/usr/bin/backup"},
+				Extensions:      map[string]string{"permit-pty": ""},
+			},
+			want: map[string]interface{}{
+				"key_id":     testUser1,
+				"principals": []string{testUser1},
+				"validity":   600,
+				"options":    map[string]string{"force-command": "/usr/bin/backup"},
+				"extensions": map[string]string{"permit-pty": ""},
+			},
+		},
+		{
+			name:  "issue certificate with source address",
+			keyID: keyIDs["ed25519"],
+			certificate: requests.Certificate{
+				CriticalOptions: map[string]string{"source-address": "10.0.0.0/8,192.168.1.10", "verify-required": ""},
+			},
+			want: map[string]interface{}{
+				"key_id":     testUser1,
+				"principals": []string{testUser1},
+				"validity":   3600,
+				"options":    map[string]string{"source-address": "10.0.0.0/8,192.168.1.10", "verify-required": ""},
+				"extensions": defaultSSHCertificateExtensions,
+			},
+		},
+		{
+			name:  "issue certificate for key expiring before certificate",
+			keyID: keyIDs["ecdsa"],
+			want: map[string]interface{}{
+				"key_id":       testUser1,
+				"principals":   []string{testUser1},
+				"valid_before": expiringKey.ExpiredAt.Unix(),
+				"options":      map[string]string{},
+				"extensions":   defaultSSHCertificateExtensions,
+			},
+		},
+		{
+			name:  "issue certificate with unsupported critical option",
+			keyID: keyIDs["ed25519"],
+			certificate: requests.Certificate{
+				CriticalOptions: map[string]string{"no-touch-required": ""},
+			},
+			shouldErr: true,
+			err: errors.ErrIssueSSHCertificate.WithArgs(keyIDs["ed25519"],
+				errors.ErrSSHCertificateCriticalOptionUnsupported.WithArgs("no-touch-required"),
+			),
+		},
+		{
+			name:  "issue certificate with malformed source address",
+			keyID: keyIDs["ed25519"],
+			certificate: requests.Certificate{
+				CriticalOptions: map[string]string{"source-address": "10.0.0.0/8,foobar"},
+			},
+			shouldErr: true,
+			err: errors.ErrIssueSSHCertificate.WithArgs(keyIDs["ed25519"],
+				errors.ErrSSHCertificateCriticalOptionValue.WithArgs("source-address", "10.0.0.0/8,foobar"),
+			),
+		},
+		{
+			name:  "issue certificate with empty force command",
+			keyID: keyIDs["ed25519"],
+			certificate: requests.Certificate{
+				CriticalOptions: map[string]string{"force-command": ""},
+			},
+			shouldErr: true,
+			err: errors.ErrIssueSSHCertificate.WithArgs(keyIDs["ed25519"],
+				errors.ErrSSHCertificateCriticalOptionValue.WithArgs("force-command", ""),
+			),
+		},
+		{
+			name:  "issue certificate exceeding maximum validity",
+			keyID: keyIDs["ed25519"],
+			certificate: requests.Certificate{
+				Validity: 604800,
+			},
+			shouldErr: true,
+			err: errors.ErrIssueSSHCertificate.WithArgs(keyIDs["ed25519"],
+				errors.ErrSSHCertificateValidityExceeded.WithArgs(604800, 86400),
+			),
+		},
+		{
+			name:      "issue certificate for disabled key",
+			keyID:     keyIDs["rsa"],
+			shouldErr: true,
+			err:       errors.ErrIssueSSHCertificate.WithArgs(keyIDs["rsa"], errors.ErrSSHCertificateKeyNotAuthorized),
+		},
+		{
+			name:      "issue certificate for unknown key",
+			keyID:     "foobar",
+			shouldErr: true,
+			err:       errors.ErrIssueSSHCertificate.WithArgs("foobar", "not found"),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			ca.RolePrincipals = tc.rolePrincipals
+			r := &requests.Request{User: user, Key: requests.Key{ID: tc.keyID}, Certificate: tc.certificate}
+			err := db.IssueSSHCertificate(r)
+			if tests.EvalErrWithLog(t, err, "issue", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(r.Response.Payload.(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := publicKey.(*ssh.Certificate)
+			checker := &ssh.CertChecker{
+				IsUserAuthority: func(k ssh.PublicKey) bool {
+					return bytes.Equal(k.Marshal(), caPublicKey.Marshal())
+				},
+				SupportedCriticalOptions: []string{"force-command", "source-address", "verify-required"},
+			}
+			if err := checker.CheckCert(testUser1, cert); err != nil {
+				t.Fatalf("failed validating certificate: %v", err)
+			}
+			validAfter := time.Unix(int64(cert.ValidAfter), 0)
+			validBefore := time.Unix(int64(cert.ValidBefore), 0)
+			got := make(map[string]interface{})
+			got["key_id"] = cert.KeyId
+			got["principals"] = cert.ValidPrincipals
+			if _, exists := tc.want["valid_before"]; exists {
+				got["valid_before"] = validBefore.Unix()
+			} else {
+				got["validity"] = int(validBefore.Sub(validAfter.Add(sshCertificateClockSkew)).Seconds())
+			}
+			got["options"] = cert.CriticalOptions
+			got["extensions"] = cert.Extensions
+			tests.EvalObjectsWithLog(t, "certificate", tc.want, got, msgs)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/base64"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"time"
+)
+
+const (
+	// sshChallengeLifetime is the period of time the nonces issued for SSH
+	// challenge-response authentication remain valid.
+	sshChallengeLifetime = 60 * time.Second
+	// maxSSHChallengesPerUser is the maximum number of outstanding nonces
+	// issued to a username.
+	maxSSHChallengesPerUser = 5
+	// maxSSHChallenges is the maximum number of nonces issued within the
+	// lifetime of a nonce.
+	maxSSHChallenges = 100000
+	// sshChallengeNamespace and sshChallengeHashAlgorithm are the namespace
+	// and the hash algorithm of the signed data of SSH challenge responses.
+	sshChallengeNamespace     = "go-identity-auth"
+	sshChallengeHashAlgorithm = "sha512"
+)
+
+// SSHChallenge is a single-use nonce issued to a user for SSH
+// challenge-response authentication. The user signs the data returned by
+// SignedData with the private key of one of the registered SSH keys, e.g.
+// with ssh.Signer. The signed data is that of OpenSSH signatures in the
+// go-identity-auth namespace with sha512 hash, so that the signatures made
+// for other purposes are not accepted. The RSA keys must sign with
+// rsa-sha2-256 or rsa-sha2-512 algorithm, i.e. with SignWithAlgorithm of
+// ssh.AlgorithmSigner, because the signatures with SHA-1 are rejected.
+type SSHChallenge struct {
+	Nonce     string    `json:"nonce,omitempty" xml:"nonce,omitempty" yaml:"nonce,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	username  string
+}
+
+// SignedData returns the data signed in response to SSH challenge.
+func (c *SSHChallenge) SignedData() []byte {
+	return GetSSHChallengeSignedData([]byte(c.Nonce))
+}
+
+// GetSSHChallengeSignedData returns the data signed in response to the
+// nonce of SSH challenge.
+func GetSSHChallengeSignedData(nonce []byte) []byte {
+	return getSSHSignedData(nonce, sshChallengeNamespace, sshChallengeHashAlgorithm)
+}
+
+// VerifySSHChallengeResponse verifies the signature of the nonce with the
+// enabled ssh public keys of a user. The signature is base64 encoded SSH
+// signature in wire format, i.e. ssh.Marshal of ssh.Signature, of the data
+// returned by GetSSHChallengeSignedData.
+func (user *User) VerifySSHChallengeResponse(nonce []byte, signature string) (*PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return nil, errors.ErrSSHChallengeResponseInvalid.WithArgs(err)
+	}
+	sig := &ssh.Signature{}
+	if err := ssh.Unmarshal(b, sig); err != nil {
+		return nil, errors.ErrSSHChallengeResponseInvalid.WithArgs(err)
+	}
+	if sig.Format == ssh.KeyAlgoRSA {
+		// The signatures with SHA-1 are rejected by OpenSSH.
+		return nil, errors.ErrSSHChallengeResponseInvalid.WithArgs("signature format " + sig.Format + " is unsupported")
+	}
+	data := GetSSHChallengeSignedData(nonce)
+	for _, k := range user.PublicKeys {
+		if !k.isAuthorized() {
+			continue
+		}
+		publicKey, err := k.getSSHPublicKey()
+		if err != nil {
+			continue
+		}
+		if err := publicKey.Verify(data, sig); err == nil {
+			return k, nil
+		}
+	}
+	return nil, errors.ErrSSHChallengeResponseInvalid.WithArgs("no matching key")
+}
@@ -0,0 +1,300 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDatabaseSSHChallengeAuthentication(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseSSHChallengeAuthentication")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	signers := make(map[string]ssh.Signer)
+	keyIDs := make(map[string]string)
+	for _, algo := range []string{"ed25519", "rsa", "ecdsa"} {
+		privateKey, publicKey := tests.GetCryptoKeyPair(t, algo, "openssh")
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			t.Fatalf("failed parsing private key: %v", err)
+		}
+		signers[algo] = signer
+		if algo == "ecdsa" {
+			// The key is not registered.
+			continue
+		}
+		if err := db.AddPublicKey(&requests.Request{
+			User: requests.User{Username: testUser1, Email: testEmail1},
+			Key:  requests.Key{Usage: "ssh", Payload: publicKey},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		u, _ := db.getUser(testUser1)
+		keyIDs[algo] = u.PublicKeys[len(u.PublicKeys)-1].ID
+	}
+
+	issueChallenge := func(username string) string {
+		r := &requests.Request{User: requests.User{Username: username}}
+		if err := db.IssueSSHChallenge(r); err != nil {
+			t.Fatalf("failed issuing ssh challenge: %v", err)
+		}
+		return r.Response.Payload.(*SSHChallenge).Nonce
+	}
+	sign := func(algo, sigAlgo, nonce string) string {
+		var sig *ssh.Signature
+		var err error
+		if sigAlgo == "" {
+			sig, err = signers[algo].Sign(rand.Reader, GetSSHChallengeSignedData([]byte(nonce)))
+		} else {
+			sig, err = signers[algo].(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, GetSSHChallengeSignedData([]byte(nonce)), sigAlgo)
+		}
+		if err != nil {
+			t.Fatalf("failed signing nonce: %v", err)
+		}
+		return base64.StdEncoding.EncodeToString(ssh.Marshal(sig))
+	}
+	replayedNonce := issueChallenge(testUser1)
+	expiredNonce := issueChallenge(testUser1)
+
+	testcases := []struct {
+		name      string
+		algo      string
+		sigAlgo   string
+		nonce     string
+		issueFor  string
+		raw       bool
+		expire    bool
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:  "test ed25519 key signature",
+			algo:  "ed25519",
+			nonce: replayedNonce,
+			want: map[string]interface{}{
+				"key_id": keyIDs["ed25519"],
+			},
+		},
+		{
+			name:     "test rsa key signature with sha256",
+			algo:     "rsa",
+			sigAlgo:  ssh.SigAlgoRSASHA2256,
+			issueFor: testUser1,
+			want: map[string]interface{}{
+				"key_id": keyIDs["rsa"],
+			},
+		},
+		{
+			name:      "test rsa key signature with sha1",
+			algo:      "rsa",
+			issueFor:  testUser1,
+			shouldErr: true,
+			err: errors.ErrAuthFailed.WithArgs(
+				errors.ErrSSHChallengeResponseInvalid.WithArgs("signature format ssh-rsa is unsupported"),
+			),
+		},
+		{
+			name:     "test nonce issued to email address of user",
+			algo:     "ed25519",
+			issueFor: strings.ToUpper(testEmail1),
+			want: map[string]interface{}{
+				"key_id": keyIDs["ed25519"],
+			},
+		},
+		{
+			name:      "test signature of raw nonce",
+			algo:      "ed25519",
+			issueFor:  testUser1,
+			raw:       true,
+			shouldErr: true,
+			err: errors.ErrAuthFailed.WithArgs(
+				errors.ErrSSHChallengeResponseInvalid.WithArgs("no matching key"),
+			),
+		},
+		{
+			name:      "test replayed nonce",
+			algo:      "ed25519",
+			nonce:     replayedNonce,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrSSHChallengeNotFound),
+		},
+		{
+			name:      "test expired nonce",
+			algo:      "ed25519",
+			nonce:     expiredNonce,
+			expire:    true,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrSSHChallengeExpired),
+		},
+		{
+			name:      "test nonce issued to another user",
+			algo:      "ed25519",
+			issueFor:  testUser2,
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrSSHChallengeNotFound),
+		},
+		{
+			name:      "test nonce not issued",
+			algo:      "ed25519",
+			nonce:     "foobar",
+			shouldErr: true,
+			err:       errors.ErrAuthFailed.WithArgs(errors.ErrSSHChallengeNotFound),
+		},
+		{
+			name:      "test signature by unregistered key",
+			algo:      "ecdsa",
+			issueFor:  testUser1,
+			shouldErr: true,
+			err: errors.ErrAuthFailed.WithArgs(
+				errors.ErrSSHChallengeResponseInvalid.WithArgs("no matching key"),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			nonce := tc.nonce
+			if tc.issueFor != "" {
+				nonce = issueChallenge(tc.issueFor)
+			}
+			if tc.expire {
+				db.sshChallenges[nonce].ExpiresAt = time.Now().Add(-time.Second)
+			}
+			signature := sign(tc.algo, tc.sigAlgo, nonce)
+			if tc.raw {
+				sig, err := signers[tc.algo].Sign(rand.Reader, []byte(nonce))
+				if err != nil {
+					t.Fatal(err)
+				}
+				signature = base64.StdEncoding.EncodeToString(ssh.Marshal(sig))
+			}
+			r := &requests.Request{
+				User: requests.User{Username: testUser1},
+				Signature: requests.Signature{
+					Data:    []byte(nonce),
+					Payload: signature,
+				},
+			}
+			err := db.AuthenticateUser(r)
+			if tests.EvalErrWithLog(t, err, "authenticate", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["key_id"] = r.Key.ID
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseSSHChallengeServiceAccount(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseSSHChallengeServiceAccount")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	if err := db.AddServiceAccount(&requests.Request{
+		User: requests.User{Username: "backup", OwnerGroup: "ops"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	privateKey, publicKey := tests.GetCryptoKeyPair(t, "ed25519", "openssh")
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		t.Fatalf("failed parsing private key: %v", err)
+	}
+	if err := db.AddPublicKey(&requests.Request{
+		User: requests.User{Username: "backup"},
+		Key:  requests.Key{Usage: "ssh", Payload: publicKey},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r := &requests.Request{User: requests.User{Username: "backup"}}
+	if err := db.IssueSSHChallenge(r); err != nil {
+		t.Fatal(err)
+	}
+	challenge := r.Response.Payload.(*SSHChallenge)
+	nonce := challenge.Nonce
+	sig, err := signer.Sign(rand.Reader, challenge.SignedData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = &requests.Request{
+		User: requests.User{Username: "backup"},
+		Signature: requests.Signature{
+			Data:    []byte(nonce),
+			Payload: base64.StdEncoding.EncodeToString(ssh.Marshal(sig)),
+		},
+	}
+	msgs := []string{"test name: test service account ed25519 key signature"}
+	if err := db.AuthenticateUser(r); err != nil {
+		t.Fatalf("%s: unexpected error: %v", msgs[0], err)
+	}
+	tests.EvalObjectsWithLog(t, "response code", 200, r.Response.Code, msgs)
+
+	// The service accounts cannot authenticate with passwords.
+	r = &requests.Request{User: requests.User{Username: "backup", Password: "foobar"}}
+	err = db.AuthenticateUser(r)
+	tests.EvalErrWithLog(t, err, "authenticate", true,
+		errors.ErrAuthFailed.WithArgs(errors.ErrServiceAccountInteractiveLogin.WithArgs("backup")),
+		[]string{"test name: test service account password"},
+	)
+}
+
+func TestDatabaseSSHChallengeLimit(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseSSHChallengeLimit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	for i := 0; i < maxSSHChallengesPerUser; i++ {
+		if err := db.IssueSSHChallenge(&requests.Request{User: requests.User{Username: "foobar"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.IssueSSHChallenge(&requests.Request{User: requests.User{Username: "FooBar"}})
+	tests.EvalErrWithLog(t, err, "issue", true, errors.ErrIssueSSHChallenge.WithArgs(errors.ErrSSHChallengeLimit),
+		[]string{"test name: test outstanding challenges of username"},
+	)
+
+	// The expired challenges no longer count.
+	for _, c := range db.sshChallengeQueue {
+		c.ExpiresAt = time.Now().Add(-time.Second)
+	}
+	if err := db.IssueSSHChallenge(&requests.Request{User: requests.User{Username: "foobar"}}); err != nil {
+		t.Fatalf("failed issuing challenge after expiry: %v", err)
+	}
+	msgs := []string{"test name: test expired challenges"}
+	tests.EvalObjectsWithLog(t, "outstanding", 1, len(db.sshChallenges), msgs)
+	tests.EvalObjectsWithLog(t, "queue", 1, len(db.sshChallengeQueue), msgs)
+
+	db.sshChallengeQueue = make([]*SSHChallenge, maxSSHChallenges)
+	for i := range db.sshChallengeQueue {
+		db.sshChallengeQueue[i] = &SSHChallenge{ExpiresAt: time.Now().Add(time.Minute)}
+	}
+	err = db.IssueSSHChallenge(&requests.Request{User: requests.User{Username: testUser1}})
+	tests.EvalErrWithLog(t, err, "issue", true, errors.ErrIssueSSHChallenge.WithArgs(errors.ErrSSHChallengeLimit),
+		[]string{"test name: test outstanding challenges"},
+	)
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"fmt"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"strings"
+)
+
+// sshSignatureMagic is the preamble of OpenSSH signatures, see PROTOCOL.sshsig
+// in OpenSSH source code.
+const sshSignatureMagic = "SSHSIG"
+
+// sshSignatureHashes are the hash algorithms of OpenSSH signatures.
+var sshSignatureHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// parseSSHSignature parses an armored OpenSSH signature. It returns the public
+// key, the namespace, the hash algorithm, and the signature.
+func parseSSHSignature(s string) (ssh.PublicKey, string, string, *ssh.Signature, error) {
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	block, _ := pem.Decode([]byte(strings.TrimSpace(s)))
+	if block == nil {
+		return nil, "", "", nil, fmt.Errorf("SSH SIGNATURE block not found")
+	}
+	if block.Type != "SSH SIGNATURE" {
+		return nil, "", "", nil, fmt.Errorf("unexpected block type %q", block.Type)
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sshSignatureMagic)) {
+		return nil, "", "", nil, fmt.Errorf("signature preamble not found")
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(sshSignatureMagic):], &sig); err != nil {
+		return nil, "", "", nil, err
+	}
+	if sig.Version != 1 {
+		return nil, "", "", nil, fmt.Errorf("signature version %d is unsupported", sig.Version)
+	}
+	if sig.Reserved != "" {
+		return nil, "", "", nil, fmt.Errorf("signature reserved field is unsupported")
+	}
+	if _, exists := sshSignatureHashes[sig.HashAlgorithm]; !exists {
+		return nil, "", "", nil, fmt.Errorf("signature hash algorithm %q is unsupported", sig.HashAlgorithm)
+	}
+	publicKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	signature := &ssh.Signature{}
+	if err := ssh.Unmarshal(sig.Signature, signature); err != nil {
+		return nil, "", "", nil, err
+	}
+	if publicKey.Type() == ssh.KeyAlgoRSA && signature.Format == ssh.KeyAlgoRSA {
+		// The signatures with SHA-1 are rejected by OpenSSH.
+		return nil, "", "", nil, fmt.Errorf("signature format %q is unsupported", signature.Format)
+	}
+	return publicKey, sig.Namespace, sig.HashAlgorithm, signature, nil
+}
+
+// getSSHSignedData returns the data signed by an OpenSSH signature.
+func getSSHSignedData(data []byte, namespace, hashAlgorithm string) []byte {
+	h := sshSignatureHashes[hashAlgorithm]()
+	h.Write(data)
+	return append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{namespace, "", hashAlgorithm, h.Sum(nil)})...)
+}
+
+// VerifySSHSignature verifies an armored OpenSSH signature, i.e. the output
+// of "ssh-keygen -Y sign", of the data in a namespace, e.g. git or file, with
+// the enabled ssh public keys of a user.
+func (user *User) VerifySSHSignature(data []byte, signature, namespace string) (*VerifiedSignature, error) {
+	if namespace == "" {
+		return nil, errors.ErrPublicKeyNamespaceInvalid.WithArgs(namespace)
+	}
+	publicKey, sigNamespace, hashAlgorithm, sig, err := parseSSHSignature(signature)
+	if err != nil {
+		return nil, errors.ErrPublicKeySignatureInvalid.WithArgs(err)
+	}
+	if sigNamespace != namespace {
+		return nil, errors.ErrPublicKeySignatureNamespace.WithArgs(sigNamespace, namespace)
+	}
+	var key *PublicKey
+	for _, k := range user.PublicKeys {
+		if !k.isAuthorized() {
+			continue
+		}
+		sshKey, err := k.getSSHPublicKey()
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(sshKey.Marshal(), publicKey.Marshal()) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, errors.ErrPublicKeySignatureKeyNotFound.WithArgs(ssh.FingerprintSHA256(publicKey))
+	}
+	if err := publicKey.Verify(getSSHSignedData(data, namespace, hashAlgorithm), sig); err != nil {
+		return nil, errors.ErrPublicKeySignatureInvalid.WithArgs(err)
+	}
+	return &VerifiedSignature{
+		Usage:       key.Usage,
+		KeyID:       key.ID,
+		Fingerprint: key.Fingerprint,
+		Namespace:   namespace,
+	}, nil
+}
+
+// GetAllowedSigners returns the entries of allowed_signers file, see
+// ssh-keygen(1), for the enabled ssh public keys of a user. The principals of
+// the entries are the email addresses of the user. The entries are limited
+// to the comma-separated namespaces, when provided. The namespaces must not
+// contain quotes, backslashes, whitespace, or line breaks.
+func (user *User) GetAllowedSigners(namespaces string) ([]string, error) {
+	var entries []string
+	if err := validateAllowedSignersNamespaces(namespaces); err != nil {
+		return nil, err
+	}
+	var principals []string
+	for _, email := range user.EmailAddresses {
+		principals = append(principals, email.Address)
+	}
+	if len(principals) == 0 {
+		return entries, nil
+	}
+	for _, k := range user.PublicKeys {
+		if !k.isAuthorized() {
+			continue
+		}
+		publicKey, err := k.getSSHPublicKey()
+		if err != nil {
+			// The malformed key must not prevent the use of the other keys.
+			continue
+		}
+		var options []string
+		if namespaces != "" {
+			options = append(options, "namespaces=\""+namespaces+"\"")
+		}
+		if !k.ExpiredAt.IsZero() {
+			options = append(options, "valid-before=\""+k.ExpiredAt.UTC().Format("20060102150405")+"Z\"")
+		}
+		entry := strings.Join(principals, ",")
+		if len(options) > 0 {
+			entry += " " + strings.Join(options, ",")
+		}
+		entry += " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// validateAllowedSignersNamespaces checks that the namespaces do not break
+// out of the quoted namespaces option of allowed_signers entries.
+func validateAllowedSignersNamespaces(namespaces string) error {
+	if strings.ContainsAny(namespaces, "\"\\ \t\r\n") {
+		return errors.ErrPublicKeyNamespaceInvalid.WithArgs(namespaces)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDatabaseVerifySSHSignature(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseVerifySSHSignature")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	user := requests.User{Username: testUser1, Email: testEmail1}
+	keyIDs := make(map[string]string)
+	for _, algo := range []string{"ed25519", "rsa"} {
+		if err := db.AddPublicKey(&requests.Request{
+			User: user,
+			Key: requests.Key{
+				Usage:   "ssh",
+				Payload: readPEMFile("testdata/ssh/jsmith_" + algo + ".pub"),
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		u, _ := db.getUser(testUser1)
+		keyIDs[algo] = u.PublicKeys[len(u.PublicKeys)-1].ID
+	}
+	data := []byte("go-identity v1.0.0 release artifact\n")
+	edSignature := readPEMFile("testdata/ssh/jsmith_ed25519.sig")
+	rsaSignature := readPEMFile("testdata/ssh/jsmith_rsa.sig")
+	edKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(readPEMFile("testdata/ssh/jsmith_ed25519.pub")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name      string
+		user      requests.User
+		data      []byte
+		signature string
+		namespace string
+		disable   string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name:      "test valid ed25519 signature",
+			user:      user,
+			data:      data,
+			signature: edSignature,
+			namespace: "git",
+			want: map[string]interface{}{
+				"usage":     "ssh",
+				"key_id":    keyIDs["ed25519"],
+				"namespace": "git",
+			},
+		},
+		{
+			name:      "test valid rsa signature",
+			user:      user,
+			data:      data,
+			signature: rsaSignature,
+			namespace: "git",
+			want: map[string]interface{}{
+				"usage":     "ssh",
+				"key_id":    keyIDs["rsa"],
+				"namespace": "git",
+			},
+		},
+		{
+			name:      "test signature of tampered data",
+			user:      user,
+			data:      []byte("go-identity v1.0.1 release artifact\n"),
+			signature: edSignature,
+			namespace: "git",
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("ssh",
+				errors.ErrPublicKeySignatureInvalid.WithArgs("ssh: signature did not verify"),
+			),
+		},
+		{
+			name:      "test signature in another namespace",
+			user:      user,
+			data:      data,
+			signature: edSignature,
+			namespace: "file",
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("ssh",
+				errors.ErrPublicKeySignatureNamespace.WithArgs("git", "file"),
+			),
+		},
+		{
+			name:      "test signature without namespace",
+			user:      user,
+			data:      data,
+			signature: edSignature,
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("ssh",
+				errors.ErrPublicKeyNamespaceInvalid.WithArgs(""),
+			),
+		},
+		{
+			name:      "test signature made by another user",
+			user:      requests.User{Username: testUser2, Email: testEmail2},
+			data:      data,
+			signature: edSignature,
+			namespace: "git",
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("ssh",
+				errors.ErrPublicKeySignatureKeyNotFound.WithArgs(ssh.FingerprintSHA256(edKey)),
+			),
+		},
+		{
+			name:      "test signature made by disabled key",
+			user:      user,
+			data:      data,
+			signature: edSignature,
+			namespace: "git",
+			disable:   keyIDs["ed25519"],
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("ssh",
+				errors.ErrPublicKeySignatureKeyNotFound.WithArgs(ssh.FingerprintSHA256(edKey)),
+			),
+		},
+		{
+			name:      "test malformed signature",
+			user:      user,
+			data:      data,
+			signature: "foobar",
+			namespace: "git",
+			shouldErr: true,
+			err: errors.ErrVerifySignature.WithArgs("ssh",
+				errors.ErrPublicKeySignatureInvalid.WithArgs("SSH SIGNATURE block not found"),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			if tc.disable != "" {
+				if err := db.DisablePublicKey(&requests.Request{User: tc.user, Key: requests.Key{ID: tc.disable}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := &requests.Request{
+				User: tc.user,
+				Signature: requests.Signature{
+					Data:      tc.data,
+					Payload:   tc.signature,
+					Namespace: tc.namespace,
+				},
+			}
+			err := db.VerifySSHSignature(r)
+			if tests.EvalErrWithLog(t, err, "verify signature", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			signature := r.Response.Payload.(*VerifiedSignature)
+			got := make(map[string]interface{})
+			got["usage"] = signature.Usage
+			got["key_id"] = signature.KeyID
+			got["namespace"] = signature.Namespace
+			tests.EvalObjectsWithLog(t, "signature", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseAllowedSigners(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseAllowedSigners")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	var entries []string
+	for _, algo := range []string{"ed25519", "rsa"} {
+		publicKey := readPEMFile("testdata/ssh/jsmith_" + algo + ".pub")
+		if err := db.AddPublicKey(&requests.Request{
+			User: requests.User{Username: testUser1, Email: testEmail1},
+			Key:  requests.Key{Usage: "ssh", Payload: publicKey},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, strings.TrimSpace(publicKey))
+	}
+
+	testcases := []struct {
+		name      string
+		namespace string
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test allowed signers without namespace",
+			want: map[string]interface{}{
+				"payload": testEmail1 + " " + entries[0] + "\n" +
+					testEmail1 + " " + entries[1] + "\n",
+			},
+		},
+		{
+			name:      "test allowed signers with namespaces",
+			namespace: "git,file",
+			want: map[string]interface{}{
+				"payload": testEmail1 + ` namespaces="git,file" ` + entries[0] + "\n" +
+					testEmail1 + ` namespaces="git,file" ` + entries[1] + "\n",
+			},
+		},
+		{
+			name:      "test allowed signers with malformed namespace",
+			namespace: `git" cert-authority`,
+			shouldErr: true,
+			err: errors.ErrGetAllowedSigners.WithArgs(
+				errors.ErrPublicKeyNamespaceInvalid.WithArgs(`git" cert-authority`),
+			),
+		},
+		{
+			name:      "test allowed signers with line break in namespace",
+			namespace: "git\nfoo@example.com ssh-ed25519",
+			shouldErr: true,
+			err: errors.ErrGetAllowedSigners.WithArgs(
+				errors.ErrPublicKeyNamespaceInvalid.WithArgs("git\nfoo@example.com ssh-ed25519"),
+			),
+		},
+		{
+			name:      "test allowed signers with backslash in namespace",
+			namespace: `git\`,
+			shouldErr: true,
+			err: errors.ErrGetAllowedSigners.WithArgs(
+				errors.ErrPublicKeyNamespaceInvalid.WithArgs(`git\`),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			r := &requests.Request{Signature: requests.Signature{Namespace: tc.namespace}}
+			err := db.GetAllowedSigners(r)
+			if tests.EvalErrWithLog(t, err, "get allowed signers", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["payload"] = r.Response.Payload.(string)
+			tests.EvalObjectsWithLog(t, "allowed signers", tc.want, got, msgs)
+		})
+	}
+
+	// The namespaces are validated for a single user too.
+	user, err := db.getUser(testUser1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = user.GetAllowedSigners("git\r")
+	tests.EvalErrWithLog(t, err, "get allowed signers", true, errors.ErrPublicKeyNamespaceInvalid.WithArgs("git\r"),
+		[]string{"test name: test user allowed signers with carriage return in namespace"},
+	)
+}
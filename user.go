@@ -25,6 +25,8 @@ import (
 type UserMetadata struct {
 	ID           string    `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
 	Enabled      bool      `json:"enabled,omitempty" xml:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Type         string    `json:"type,omitempty" xml:"type,omitempty" yaml:"type,omitempty"`
+	Owner        string    `json:"owner,omitempty" xml:"owner,omitempty" yaml:"owner,omitempty"`
 	Username     string    `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
 	Title        string    `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty"`
 	Name         string    `json:"name,omitempty" xml:"name,omitempty" yaml:"name,omitempty"`
@@ -65,6 +67,12 @@ type User struct {
 	LastModified   time.Time       `json:"last_modified,omitempty" xml:"last_modified,omitempty" yaml:"last_modified,omitempty"`
 	Revision       int             `json:"revision,omitempty" xml:"revision,omitempty" yaml:"revision,omitempty"`
 	Roles          []*Role         `json:"roles,omitempty" xml:"roles,omitempty" yaml:"roles,omitempty"`
+
+	// Type is the type of the identity, e.g. service. The empty type stands
+	// for a human user.
+	Type string `json:"type,omitempty" xml:"type,omitempty" yaml:"type,omitempty"`
+	// Owner is the user or the group responsible for a service account.
+	Owner *ServiceAccountOwner `json:"owner,omitempty" xml:"owner,omitempty" yaml:"owner,omitempty"`
 }
 
 // NewUserMetadataBundle returns an instance of UserMetadataBundle.
@@ -103,10 +111,16 @@ func NewUser(s string) *User {
 
 // NewUserWithRoles returns User with additional fields.
 func NewUserWithRoles(username, password, email, fullName string, roles []string) (*User, error) {
-	user := NewUser(username)
-	if err := user.AddPassword(password, 0); err != nil {
+	p, err := NewPassword(password)
+	if err != nil {
 		return nil, err
 	}
+	return newUserWithRoles(username, p, email, fullName, roles)
+}
+
+func newUserWithRoles(username string, password *Password, email, fullName string, roles []string) (*User, error) {
+	user := NewUser(username)
+	user.addPassword(password, 0)
 	if err := user.AddEmailAddress(email); err != nil {
 		return nil, err
 	}
@@ -139,6 +153,9 @@ func (user *User) Valid() error {
 	if user.Username == "" {
 		return errors.ErrUsernameEmpty
 	}
+	if user.IsServiceAccount() {
+		return user.validServiceAccount()
+	}
 	if len(user.Passwords) < 1 {
 		return errors.ErrUserPasswordNotFound
 	}
@@ -147,11 +164,16 @@ func (user *User) Valid() error {
 
 // AddPassword returns creates and adds password for a user identity.
 func (user *User) AddPassword(s string, keepVersions int) error {
-	var passwords []*Password
 	password, err := NewPassword(s)
 	if err != nil {
 		return err
 	}
+	user.addPassword(password, keepVersions)
+	return nil
+}
+
+func (user *User) addPassword(password *Password, keepVersions int) {
+	var passwords []*Password
 	if keepVersions < 1 {
 		keepVersions = 9
 	}
@@ -169,7 +191,6 @@ func (user *User) AddPassword(s string, keepVersions int) error {
 	}
 	user.Passwords = passwords
 	user.Revise()
-	return nil
 }
 
 // AddEmailAddress returns creates and adds password for a user identity.
@@ -261,18 +282,40 @@ func (user *User) AddRole(s string) error {
 
 // VerifyPassword verifies provided password matches to the one in the database.
 func (user *User) VerifyPassword(s string) error {
+	_, err := user.verifyPassword(s, nil)
+	return err
+}
+
+// verifyPassword returns the password of a user matching the provided one.
+// The peppered passwords are matched with the peppers.
+func (user *User) verifyPassword(s string, peppers *PasswordPeppers) (*Password, error) {
 	if len(user.Passwords) == 0 {
-		return errors.ErrUserPasswordNotFound
+		return nil, errors.ErrUserPasswordNotFound
 	}
 	for _, p := range user.Passwords {
 		if p.Disabled || p.Expired {
 			continue
 		}
-		if p.Match(s) {
-			return nil
+		if peppers != nil && peppers.Match(p, s) {
+			return p, nil
+		}
+		if peppers == nil && p.Match(s) {
+			return p, nil
 		}
 	}
-	return errors.ErrUserPasswordInvalid
+	return nil, errors.ErrUserPasswordInvalid
+}
+
+// mustChangePassword returns true when the current password of the user
+// must be changed.
+func (user *User) mustChangePassword() bool {
+	for _, p := range user.Passwords {
+		if p.Disabled || p.Expired {
+			continue
+		}
+		return p.MustChange
+	}
+	return false
 }
 
 // VerifyWebAuthnRequest authenticated WebAuthn requests.
@@ -309,6 +352,73 @@ func (user *User) VerifyWebAuthnRequest(r *requests.Request) error {
 	return errors.ErrWebAuthnVerifyRequest
 }
 
+// VerifyMfaPasscode validates the passcode of the TOTP or HOTP token of a
+// user. If the request has token id, only that token is tried. The skew is
+// the number of TOTP time steps before and after the current one within
+// which the passcodes are accepted. It returns the token accepting the
+// passcode.
+func (user *User) VerifyMfaPasscode(r *requests.Request, skew int) (*MfaToken, error) {
+	verifyErr := errors.ErrMfaTokenInvalidPasscode.WithArgs("failed")
+	var failed []*MfaToken
+	for _, token := range user.MfaTokens {
+		if token.Disabled {
+			continue
+		}
+		if token.Type != "totp" && token.Type != "hotp" {
+			continue
+		}
+		if r.MfaToken.ID != "" && r.MfaToken.ID != token.ID {
+			continue
+		}
+		var err error
+		if token.Type == "totp" {
+			err = token.ValidateCodeWithSkew(r.MfaToken.Passcode, time.Now().UTC(), skew)
+		} else {
+			attempts := token.FailedAttempts
+			err = token.ValidateCode(r.MfaToken.Passcode)
+			if token.FailedAttempts > attempts {
+				failed = append(failed, token)
+			}
+		}
+		if err != nil {
+			verifyErr = err
+			continue
+		}
+		// The passcode of another token is not a failed attempt.
+		for _, t := range failed {
+			t.FailedAttempts--
+		}
+		return token, nil
+	}
+	return nil, verifyErr
+}
+
+// getMfaTokenStates returns the persisted verification state of the MFA
+// tokens of a user, i.e. the counter, the last time step, and the number of
+// failed attempts of each token.
+func (user *User) getMfaTokenStates() []uint64 {
+	var states []uint64
+	for _, token := range user.MfaTokens {
+		states = append(states, token.Counter, token.LastTimeStep, uint64(token.FailedAttempts))
+	}
+	return states
+}
+
+// isMfaTokenStateChanged returns true when the verification state of the
+// MFA tokens of a user differs from the provided one.
+func (user *User) isMfaTokenStateChanged(states []uint64) bool {
+	current := user.getMfaTokenStates()
+	if len(current) != len(states) {
+		return true
+	}
+	for i := range current {
+		if current[i] != states[i] {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMailClaim returns primary email address.
 func (user *User) GetMailClaim() string {
 	if len(user.EmailAddresses) == 0 {
@@ -345,6 +455,19 @@ func (user *User) GetRolesClaim() []string {
 	return roles
 }
 
+// getPasswordStrengthInputs returns username, email addresses and names
+// of a user, i.e. the words the password of the user should not be based on.
+func (user *User) getPasswordStrengthInputs() []string {
+	inputs := []string{user.Username}
+	for _, email := range user.EmailAddresses {
+		inputs = append(inputs, email.Address)
+	}
+	for _, name := range user.Names {
+		inputs = append(inputs, name.First, name.Last, name.Middle, name.Preferred)
+	}
+	return inputs
+}
+
 // GetFullName returns the primary full name for a user.
 func (user *User) GetFullName() string {
 	if user.Name == nil {
@@ -376,6 +499,12 @@ func (user *User) AddPublicKey(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
 	}
+	return user.addPublicKey(r, key)
+}
+
+// addPublicKey adds the public key created from the request to a user
+// identity.
+func (user *User) addPublicKey(r *requests.Request, key *PublicKey) error {
 	for _, k := range user.PublicKeys {
 		if k.Type != key.Type {
 			continue
@@ -383,13 +512,52 @@ func (user *User) AddPublicKey(r *requests.Request) error {
 		if k.Fingerprint != key.Fingerprint {
 			continue
 		}
+		if key.Usage == "x509" && (k.Issuer != key.Issuer || k.SerialNumber != key.SerialNumber) {
+			// The renewed certificates keep the key of the certificate.
+			continue
+		}
 		return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, "already exists")
 	}
+	if key.Usage == "gpg" {
+		if err := user.verifyPublicKeyIdentities(key); err != nil {
+			return errors.ErrAddPublicKey.WithArgs(r.Key.Usage, err)
+		}
+	}
 	user.PublicKeys = append(user.PublicKeys, key)
 	user.Revise()
 	return nil
 }
 
+// verifyPublicKeyIdentities marks the identities of a PGP key having the
+// email address of the user as verified. The key must have at least one.
+func (user *User) verifyPublicKeyIdentities(key *PublicKey) error {
+	var verified bool
+	for _, identity := range key.Identities {
+		identity.Verified = false
+		for _, email := range user.EmailAddresses {
+			if strings.EqualFold(identity.Email, email.Address) {
+				identity.Verified = true
+				verified = true
+				break
+			}
+		}
+	}
+	if !verified {
+		return errors.ErrPublicKeyEmailMismatch.WithArgs(key.ID)
+	}
+	return nil
+}
+
+// getPublicKey returns a public key associated with a user by key id.
+func (user *User) getPublicKey(s string) *PublicKey {
+	for _, k := range user.PublicKeys {
+		if k.ID == s {
+			return k
+		}
+	}
+	return nil
+}
+
 // DeletePublicKey deletes a public key associated with a user.
 func (user *User) DeletePublicKey(r *requests.Request) error {
 	var found bool
@@ -415,8 +583,32 @@ func (user *User) AddAPIKey(r *requests.Request) error {
 	if err != nil {
 		return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, err)
 	}
+	ownerRoles := user.GetRolesClaim()
+	for _, role := range key.Roles {
+		var found bool
+		for _, ownerRole := range ownerRoles {
+			if role == ownerRole {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.ErrAddAPIKey.WithArgs(r.Key.Usage, errors.ErrAPIKeyRoleNotAssigned.WithArgs(role))
+		}
+	}
 	user.APIKeys = append(user.APIKeys, key)
 	user.Revise()
+	r.Key.ID = key.ID
+	return nil
+}
+
+// getAPIKey returns API key by key id.
+func (user *User) getAPIKey(s string) *APIKey {
+	for _, k := range user.APIKeys {
+		if k.ID == s {
+			return k
+		}
+	}
 	return nil
 }
 
@@ -440,11 +632,34 @@ func (user *User) DeleteAPIKey(r *requests.Request) error {
 	return nil
 }
 
-// LookupAPIKey performs the lookup of API key.
+// LookupAPIKey performs the lookup of API key. Upon the successful lookup,
+// the request holds the ID and scopes of the key and the roles granted to it.
 func (user *User) LookupAPIKey(r *requests.Request) error {
+	return user.lookupAPIKey(r, func(k *APIKey) bool {
+		return k.Match(r.Key.Payload)
+	})
+}
+
+// lookupAPIKey performs the lookup of API key by prefix and matches it with
+// the provided function.
+func (user *User) lookupAPIKey(r *requests.Request, match func(*APIKey) bool) error {
 	for _, k := range user.APIKeys {
 		if k.Prefix == r.Key.Prefix {
-			if k.Match(r.Key.Payload) {
+			if match(k) {
+				if k.Disabled {
+					return errors.ErrLookupAPIKeyDisabled
+				}
+				if !k.IsValid() {
+					return errors.ErrLookupAPIKeyExpired
+				}
+				if err := k.Authorize(r.Upstream.GetAddress(), r.Upstream.GetMethod()); err != nil {
+					r.Response.Code = 403
+					return err
+				}
+				r.Key.ID = k.ID
+				r.Key.Scopes = k.Scopes
+				r.Key.Roles = k.GetRoles(user.GetRolesClaim())
+				r.User.Roles = r.Key.Roles
 				return nil
 			}
 			return errors.ErrLookupAPIKeyFailed
@@ -455,6 +670,9 @@ func (user *User) LookupAPIKey(r *requests.Request) error {
 
 // AddMfaToken adds MFA token to a user identity.
 func (user *User) AddMfaToken(r *requests.Request) error {
+	if user.IsServiceAccount() {
+		return errors.ErrAddMfaToken.WithArgs(errors.ErrServiceAccountMfaToken)
+	}
 	token, err := NewMfaToken(r)
 	if err != nil {
 		return errors.ErrAddMfaToken.WithArgs(err)
@@ -472,6 +690,16 @@ func (user *User) AddMfaToken(r *requests.Request) error {
 	return nil
 }
 
+// getMfaToken returns MFA token associated with a user by token id.
+func (user *User) getMfaToken(s string) *MfaToken {
+	for _, k := range user.MfaTokens {
+		if k.ID == s {
+			return k
+		}
+	}
+	return nil
+}
+
 // DeleteMfaToken deletes MFA token associated with a user.
 func (user *User) DeleteMfaToken(r *requests.Request) error {
 	var found bool
@@ -509,12 +737,26 @@ func (user *User) GetFlags(r *requests.Request) {
 
 // ChangePassword changes user password.
 func (user *User) ChangePassword(r *requests.Request, keepVersions int) error {
-	if err := user.VerifyPassword(r.User.OldPassword); err != nil {
+	return user.changePassword(r, keepVersions, nil)
+}
+
+// changePassword changes user password. The new password is peppered with
+// the active pepper.
+func (user *User) changePassword(r *requests.Request, keepVersions int, peppers *PasswordPeppers) error {
+	if _, err := user.verifyPassword(r.User.OldPassword, peppers); err != nil {
 		return errors.ErrChangeUserPassword.WithArgs(err)
 	}
-	if err := user.AddPassword(r.User.Password, keepVersions); err != nil {
+	var password *Password
+	var err error
+	if peppers != nil {
+		password, err = peppers.NewPassword(r.User.Password)
+	} else {
+		password, err = NewPassword(r.User.Password)
+	}
+	if err != nil {
 		return errors.ErrChangeUserPassword.WithArgs(err)
 	}
+	user.addPassword(password, keepVersions)
 	return nil
 }
 
@@ -523,12 +765,16 @@ func (user *User) GetMetadata() *UserMetadata {
 	m := &UserMetadata{
 		ID:           user.ID,
 		Enabled:      user.Enabled,
+		Type:         user.GetType(),
 		Username:     user.Username,
 		Title:        user.Title,
 		Created:      user.Created,
 		LastModified: user.LastModified,
 		Revision:     user.Revision,
 	}
+	if user.Owner != nil {
+		m.Owner = user.Owner.Name
+	}
 	if user.Avatar != nil {
 		m.Avatar = user.Avatar.Path
 	}
@@ -16,8 +16,6 @@ package identity
 
 import (
 	"github.com/satori/go.uuid"
-	"math/rand"
-	"strings"
 )
 
 // NewID returns a random ID to be used for user identification.
@@ -25,15 +23,11 @@ func NewID() string {
 	return uuid.NewV4().String()
 }
 
-// NewRandomString returns a random string.
+// NewRandomString returns a random string. It panics when the source of
+// randomness fails.
 func NewRandomString(length int) string {
-	chars := []rune("abcdefghijklmnopqrstuvwxyz0123456789")
 	if length == 0 {
 		length = 32
 	}
-	var b strings.Builder
-	for i := 0; i < length; i++ {
-		b.WriteRune(chars[rand.Intn(len(chars))])
-	}
-	return b.String()
+	return mustGen(length, "abcdefghijklmnopqrstuvwxyz0123456789")
 }
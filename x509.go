@@ -0,0 +1,123 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/greenpau/go-identity/internal/utils"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"strings"
+	"time"
+)
+
+// NewX509CertificatePool returns the pool of the certificate authorities
+// loaded from PEM files. The pool verifies the chains of client certificates.
+func NewX509CertificatePool(fps ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, fp := range fps {
+		b, err := utils.ReadFileBytes(fp)
+		if err != nil {
+			return nil, errors.ErrX509CertificateAuthorityLoad.WithArgs(fp, err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.ErrX509CertificateAuthorityLoad.WithArgs(fp, "no certificates found")
+		}
+	}
+	return pool, nil
+}
+
+// parseX509Certificate parses PEM encoded X.509 certificate.
+func parseX509Certificate(s string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(s)))
+	if block == nil {
+		return nil, errors.ErrPublicKeyBlockType.WithArgs("")
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil, errors.ErrPublicKeyBlockType.WithArgs(block.Type)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.ErrPublicKeyParse.WithArgs(err)
+	}
+	return cert, nil
+}
+
+// getX509CertificateFingerprint returns the SHA-256 fingerprint of the
+// subject public key info of X.509 certificate.
+func getX509CertificateFingerprint(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(h[:])
+}
+
+// verifyX509Certificate verifies the validity period of X.509 certificate
+// and, when the pool is provided, its chain for client authentication.
+func verifyX509Certificate(cert *x509.Certificate, pool *x509.CertPool, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		return errors.ErrX509CertificateNotYetValid.WithArgs(cert.NotBefore.UTC())
+	}
+	if now.After(cert.NotAfter) {
+		return errors.ErrX509CertificateExpired.WithArgs(cert.NotAfter.UTC())
+	}
+	if pool == nil {
+		return nil
+	}
+	opts := x509.VerifyOptions{
+		Roots:       pool,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return errors.ErrX509CertificateChain.WithArgs(err)
+	}
+	return nil
+}
+
+func (p *PublicKey) parsePublicKeyX509() error {
+	if p.Usage != "x509" {
+		return errors.ErrPublicKeyUsagePayloadMismatch.WithArgs(p.Usage)
+	}
+	p.Payload = strings.TrimSpace(p.Payload)
+	cert, err := parseX509Certificate(p.Payload)
+	if err != nil {
+		return err
+	}
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA, x509.DSA, x509.ECDSA, x509.Ed25519:
+		p.Type = strings.ToLower(cert.PublicKeyAlgorithm.String())
+	default:
+		return errors.ErrPublicKeyTypeUnsupported.WithArgs(cert.PublicKeyAlgorithm.String())
+	}
+	p.Fingerprint = getX509CertificateFingerprint(cert)
+	p.Subject = cert.Subject.String()
+	p.Issuer = cert.Issuer.String()
+	p.SerialNumber = cert.SerialNumber.String()
+	p.EmailAddresses = cert.EmailAddresses
+	p.NotBefore = cert.NotBefore.UTC()
+	p.ExpiredAt = cert.NotAfter.UTC()
+	if time.Now().After(p.ExpiredAt) {
+		return errors.ErrPublicKeyExpired.WithArgs(p.Fingerprint, p.ExpiredAt)
+	}
+	comment := fmt.Sprintf("%s, issuer %s, serial %s", p.Subject, p.Issuer, p.SerialNumber)
+	if p.Comment != "" {
+		p.Comment = fmt.Sprintf("%s (%s)", p.Comment, comment)
+	} else {
+		p.Comment = comment
+	}
+	return nil
+}
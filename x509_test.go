@@ -0,0 +1,409 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-identity/internal/tests"
+	"github.com/greenpau/go-identity/pkg/errors"
+	"github.com/greenpau/go-identity/pkg/requests"
+)
+
+// newTestX509Certificate returns X.509 certificate, signed by the parent
+// certificate, or self-signed, when the parent is nil.
+func newTestX509Certificate(t *testing.T, tmpl, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating ecdsa key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("failed parsing certificate: %v", err)
+	}
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b}))
+}
+
+func newTestX509CertificateTemplate(serial int64, cn string, notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Contoso"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+}
+
+func TestNewX509PublicKey(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	caTmpl := newTestX509CertificateTemplate(1, "Contoso CA", now.Add(-time.Hour), now.Add(24*time.Hour))
+	caTmpl.IsCA = true
+	caTmpl.BasicConstraintsValid = true
+	caTmpl.KeyUsage = x509.KeyUsageCertSign
+	caCert, caKey, _ := newTestX509Certificate(t, caTmpl, nil, nil)
+
+	tmpl := newTestX509CertificateTemplate(4242, "jsmith", now.Add(-time.Hour), now.Add(time.Hour))
+	tmpl.EmailAddresses = []string{"jsmith@gmail.com"}
+	cert, _, certPEM := newTestX509Certificate(t, tmpl, caCert, caKey)
+	fingerprint := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	expiredTmpl := newTestX509CertificateTemplate(4243, "jsmith", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	expiredCert, _, expiredPEM := newTestX509Certificate(t, expiredTmpl, caCert, caKey)
+	_, sshPublicKey := tests.GetCryptoKeyPair(t, "ed25519", "openssh")
+
+	testcases := []struct {
+		name      string
+		req       *requests.Request
+		want      map[string]interface{}
+		shouldErr bool
+		err       error
+	}{
+		{
+			name: "test x509 certificate",
+			req: &requests.Request{
+				Key: requests.Key{Usage: "x509", Payload: certPEM},
+			},
+			want: map[string]interface{}{
+				"type":            "ecdsa",
+				"fingerprint":     hex.EncodeToString(fingerprint[:]),
+				"subject":         "CN=jsmith,O=Contoso",
+				"issuer":          "CN=Contoso CA,O=Contoso",
+				"serial_number":   "4242",
+				"email_addresses": []string{"jsmith@gmail.com"},
+				"not_before":      now.Add(-time.Hour),
+				"expired_at":      now.Add(time.Hour),
+				"comment":         "CN=jsmith,O=Contoso, issuer CN=Contoso CA,O=Contoso, serial 4242",
+			},
+		},
+		{
+			name: "test x509 certificate with ssh usage",
+			req: &requests.Request{
+				Key: requests.Key{Usage: "ssh", Payload: certPEM},
+			},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyUsagePayloadMismatch.WithArgs("ssh"),
+		},
+		{
+			name: "test ssh public key with x509 usage",
+			req: &requests.Request{
+				Key: requests.Key{Usage: "x509", Payload: sshPublicKey},
+			},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyUsagePayloadMismatch.WithArgs("x509"),
+		},
+		{
+			name: "test ssh public key with gpg usage",
+			req: &requests.Request{
+				Key: requests.Key{Usage: "gpg", Payload: sshPublicKey},
+			},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyUsagePayloadMismatch.WithArgs("gpg"),
+		},
+		{
+			name: "test gpg public key with x509 usage",
+			req: &requests.Request{
+				Key: requests.Key{Usage: "x509", Payload: readPEMFile("testdata/gpg/linux_gpg_pub.pem")},
+			},
+			shouldErr: true,
+			err:       errors.ErrPublicKeyUsagePayloadMismatch.WithArgs("x509"),
+		},
+		{
+			name: "test expired x509 certificate",
+			req: &requests.Request{
+				Key: requests.Key{Usage: "x509", Payload: expiredPEM},
+			},
+			shouldErr: true,
+			err: errors.ErrPublicKeyExpired.WithArgs(
+				getX509CertificateFingerprint(expiredCert), now.Add(-time.Hour),
+			),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			key, err := NewPublicKey(tc.req)
+			if tests.EvalErrWithLog(t, err, "new public key", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["type"] = key.Type
+			got["fingerprint"] = key.Fingerprint
+			got["subject"] = key.Subject
+			got["issuer"] = key.Issuer
+			got["serial_number"] = key.SerialNumber
+			got["email_addresses"] = key.EmailAddresses
+			got["not_before"] = key.NotBefore
+			got["expired_at"] = key.ExpiredAt
+			got["comment"] = key.Comment
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+}
+
+func TestDatabaseLookupX509Certificate(t *testing.T) {
+	db, err := createTestDatabase("TestDatabaseLookupX509Certificate")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	now := time.Now().UTC()
+	var caCerts []*x509.Certificate
+	var caKeys []crypto.Signer
+	var caPEMs []string
+	for i, cn := range []string{"Contoso CA", "Untrusted CA"} {
+		tmpl := newTestX509CertificateTemplate(int64(i+1), cn, now.Add(-time.Hour), now.Add(24*time.Hour))
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		cert, key, certPEM := newTestX509Certificate(t, tmpl, nil, nil)
+		caCerts = append(caCerts, cert)
+		caKeys = append(caKeys, key)
+		caPEMs = append(caPEMs, certPEM)
+	}
+	dir, err := tests.TempDir("TestDatabaseLookupX509Certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caPath, []byte(caPEMs[0]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewX509CertificatePool(caPath + ".missing"); err == nil {
+		t.Fatalf("expected error when loading missing certificate authority file")
+	}
+	pool, err := NewX509CertificatePool(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certPEMs []string
+	var certKeys []crypto.Signer
+	users := []requests.User{
+		{Username: testUser1, Email: testEmail1},
+		{Username: testUser2, Email: testEmail2},
+	}
+	for i, u := range users {
+		tmpl := newTestX509CertificateTemplate(int64(100+i), u.Username, now.Add(-time.Hour), now.Add(time.Hour))
+		_, certKey, certPEM := newTestX509Certificate(t, tmpl, caCerts[i], caKeys[i])
+		if err := db.AddPublicKey(&requests.Request{User: u, Key: requests.Key{Usage: "x509", Payload: certPEM}}); err != nil {
+			t.Fatal(err)
+		}
+		certPEMs = append(certPEMs, certPEM)
+		certKeys = append(certKeys, certKey)
+	}
+
+	// The renewed certificate of the first user keeps the key of the
+	// certificate. It cannot be registered twice, or by another user.
+	renewedTmpl := newTestX509CertificateTemplate(300, testUser1, now.Add(-time.Minute), now.Add(2*time.Hour))
+	b, err := x509.CreateCertificate(rand.Reader, renewedTmpl, caCerts[0], certKeys[0].Public(), caKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewedPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b}))
+	if err := db.AddPublicKey(&requests.Request{User: users[0], Key: requests.Key{Usage: "x509", Payload: renewedPEM}}); err != nil {
+		t.Fatalf("failed adding renewed certificate: %v", err)
+	}
+	err = db.AddPublicKey(&requests.Request{User: users[0], Key: requests.Key{Usage: "x509", Payload: renewedPEM}})
+	tests.EvalErrWithLog(t, err, "add", true, errors.ErrAddPublicKey.WithArgs("x509", "already exists"),
+		[]string{"test name: test add renewed certificate twice"},
+	)
+	renewedCert, err := parseX509Certificate(renewedPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddPublicKey(&requests.Request{User: users[1], Key: requests.Key{Usage: "x509", Payload: renewedPEM}})
+	tests.EvalErrWithLog(t, err, "add", true, errors.ErrAddPublicKey.WithArgs("x509",
+		errors.ErrPublicKeyRegistered.WithArgs(getX509CertificateFingerprint(renewedCert)),
+	), []string{"test name: test add renewed certificate of another user"})
+	user1, _ := db.getUser(testUser1)
+	key1 := user1.PublicKeys[len(user1.PublicKeys)-1]
+	_, _, unknownPEM := newTestX509Certificate(t,
+		newTestX509CertificateTemplate(200, "unknown", now.Add(-time.Hour), now.Add(time.Hour)), caCerts[0], caKeys[0],
+	)
+
+	testcases := []struct {
+		name        string
+		payload     string
+		fingerprint string
+		pool        *x509.CertPool
+		want        map[string]interface{}
+		shouldErr   bool
+		err         error
+	}{
+		{
+			name:    "test lookup by certificate",
+			payload: certPEMs[0],
+			pool:    pool,
+			want: map[string]interface{}{
+				"username": testUser1,
+				"email":    testEmail1,
+				"key_id":   key1.ID,
+			},
+		},
+		{
+			name:        "test lookup by fingerprint",
+			fingerprint: strings.ToUpper(key1.Fingerprint),
+			pool:        pool,
+			want: map[string]interface{}{
+				"username": testUser1,
+				"email":    testEmail1,
+				"key_id":   key1.ID,
+			},
+		},
+		{
+			name:      "test lookup by certificate issued by untrusted authority",
+			payload:   certPEMs[1],
+			pool:      pool,
+			shouldErr: true,
+			err: errors.ErrLookupX509Certificate.WithArgs(
+				errors.ErrX509CertificateChain.WithArgs(x509.UnknownAuthorityError{}),
+			),
+		},
+		{
+			name:    "test lookup by certificate without certificate authorities",
+			payload: certPEMs[1],
+			want: map[string]interface{}{
+				"username": testUser2,
+				"email":    testEmail2,
+			},
+		},
+		{
+			name:      "test lookup by unknown certificate",
+			payload:   unknownPEM,
+			pool:      pool,
+			shouldErr: true,
+			err:       errors.ErrLookupX509Certificate.WithArgs("not found"),
+		},
+		{
+			name:      "test lookup without certificate and fingerprint",
+			shouldErr: true,
+			err:       errors.ErrLookupX509CertificateEmptyPayload,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			db.SetX509CertificateAuthorities(tc.pool)
+			r := &requests.Request{Key: requests.Key{Payload: tc.payload, Fingerprint: tc.fingerprint}}
+			err := db.LookupX509Certificate(r)
+			if tests.EvalErrWithLog(t, err, "lookup", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			got := make(map[string]interface{})
+			got["username"] = r.User.Username
+			got["email"] = r.User.Email
+			if _, exists := tc.want["key_id"]; exists {
+				got["key_id"] = r.Key.ID
+			}
+			tests.EvalObjectsWithLog(t, "eval", tc.want, got, msgs)
+		})
+	}
+
+	// The registrations of the first user expire. The certificate of the
+	// registered key, issued by the registered issuer, renews them.
+	expiredAt := now.Add(-time.Minute)
+	for _, k := range user1.PublicKeys {
+		if k.Usage == "x509" {
+			k.ExpiredAt = expiredAt
+		}
+	}
+	bothCAPath := filepath.Join(dir, "ca_bundle.pem")
+	if err := ioutil.WriteFile(bothCAPath, []byte(caPEMs[0]+caPEMs[1]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bothPool, err := NewX509CertificatePool(bothCAPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var presentedPEMs []string
+	for i := range caCerts {
+		tmpl := newTestX509CertificateTemplate(int64(400+i), testUser1, now.Add(-time.Minute), now.Add(time.Hour))
+		b, err := x509.CreateCertificate(rand.Reader, tmpl, caCerts[i], certKeys[0].Public(), caKeys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		presentedPEMs = append(presentedPEMs, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})))
+	}
+	expiredErr := errors.ErrLookupX509Certificate.WithArgs(errors.ErrPublicKeyExpired.WithArgs(key1.Fingerprint, expiredAt))
+
+	expiredTestcases := []struct {
+		name        string
+		payload     string
+		fingerprint string
+		pool        *x509.CertPool
+		shouldErr   bool
+		err         error
+	}{
+		{
+			name:        "test lookup expired registration by fingerprint",
+			fingerprint: key1.Fingerprint,
+			pool:        pool,
+			shouldErr:   true,
+			err:         expiredErr,
+		},
+		{
+			name:      "test lookup expired registration by renewed certificate without certificate authorities",
+			payload:   presentedPEMs[0],
+			shouldErr: true,
+			err:       expiredErr,
+		},
+		{
+			name:      "test lookup expired registration by certificate of another issuer",
+			payload:   presentedPEMs[1],
+			pool:      bothPool,
+			shouldErr: true,
+			err:       expiredErr,
+		},
+		{
+			name:    "test lookup expired registration by renewed certificate",
+			payload: presentedPEMs[0],
+			pool:    pool,
+		},
+	}
+	for _, tc := range expiredTestcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := []string{fmt.Sprintf("test name: %s", tc.name)}
+			db.SetX509CertificateAuthorities(tc.pool)
+			r := &requests.Request{Key: requests.Key{Payload: tc.payload, Fingerprint: tc.fingerprint}}
+			err := db.LookupX509Certificate(r)
+			if tests.EvalErrWithLog(t, err, "lookup", tc.shouldErr, tc.err, msgs) {
+				return
+			}
+			tests.EvalObjectsWithLog(t, "username", testUser1, r.User.Username, msgs)
+		})
+	}
+}